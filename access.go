@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// accessError reports the exact permission a request is missing
+type accessError struct {
+	attrs  authorizationv1.ResourceAttributes
+	reason string
+}
+
+func (e *accessError) Error() string {
+	msg := "forbidden: cannot " + describeAccess(e.attrs)
+	if e.reason != "" {
+		msg += " (" + e.reason + ")"
+	}
+	return msg
+}
+
+// describeAccess renders attributes like kubectl auth can-i: `get pods/log in namespace "prod"`
+func describeAccess(attrs authorizationv1.ResourceAttributes) string {
+	resource := attrs.Resource
+	if attrs.Subresource != "" {
+		resource += "/" + attrs.Subresource
+	}
+	if attrs.Group != "" {
+		resource += "." + attrs.Group
+	}
+	if attrs.Name != "" {
+		resource += " " + attrs.Name
+	}
+	if attrs.Namespace == "" {
+		return fmt.Sprintf("%s %s at cluster scope", attrs.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %q", attrs.Verb, resource, attrs.Namespace)
+}
+
+// canI asks the API server whether the current identity may perform an action
+func canI(ctx context.Context, clientset kubernetes.Interface, attrs authorizationv1.ResourceAttributes) (bool, string, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attrs},
+	}
+	resp, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("access review failed: %w", err)
+	}
+	reason := resp.Status.Reason
+	if resp.Status.EvaluationError != "" && reason == "" {
+		reason = resp.Status.EvaluationError
+	}
+	return resp.Status.Allowed, reason, nil
+}
+
+// checkAccess returns an *accessError for every denied action. When the review itself
+// cannot be made (old server, no authorization API) the check passes and the real request decides.
+func checkAccess(ctx context.Context, clientset kubernetes.Interface, checks ...authorizationv1.ResourceAttributes) error {
+	var denied []string
+	var first *accessError
+	for _, attrs := range checks {
+		allowed, reason, err := canI(ctx, clientset, attrs)
+		if err != nil {
+			debugLog("Skipping pre-flight check for %s: %v", describeAccess(attrs), err)
+			continue
+		}
+		if !allowed {
+			if first == nil {
+				first = &accessError{attrs: attrs, reason: reason}
+			}
+			denied = append(denied, describeAccess(attrs))
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	if len(denied) > 1 {
+		return fmt.Errorf("forbidden: cannot %s", strings.Join(denied, "; cannot "))
+	}
+	return first
+}
+
+// Actions the UI can hide when the current identity is not allowed to perform them
+var uiActions = map[string]authorizationv1.ResourceAttributes{
+	"streamLogs":  {Verb: "get", Resource: "pods", Subresource: "log"},
+	"listPods":    {Verb: "list", Resource: "pods"},
+	"listEvents":  {Verb: "list", Resource: "events"},
+	"viewSecrets": {Verb: "get", Resource: "secrets"},
+	"exec":        {Verb: "create", Resource: "pods", Subresource: "exec"},
+	"portForward": {Verb: "create", Resource: "pods", Subresource: "portforward"},
+	"deletePods":  {Verb: "delete", Resource: "pods"},
+	"restart":     {Verb: "patch", Group: "apps", Resource: "deployments"},
+	"scale":       {Verb: "update", Group: "apps", Resource: "deployments", Subresource: "scale"},
+	"cordonNodes": {Verb: "patch", Resource: "nodes"},
+}
+
+// getCanI answers a single access question (verb + resource) or, without a verb,
+// returns the UI action map and the rules the identity holds in the namespace
+func getCanI(c *gin.Context) {
+	ctxName := c.Query("context")
+	namespace := c.Query("namespace")
+	verb := strings.TrimSpace(c.Query("verb"))
+
+	clientset, _, err := createKubeClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	if verb != "" {
+		attrs := authorizationv1.ResourceAttributes{
+			Verb:        verb,
+			Group:       c.Query("group"),
+			Resource:    c.Query("resource"),
+			Subresource: c.Query("subresource"),
+			Name:        c.Query("name"),
+			Namespace:   namespace,
+		}
+		if attrs.Resource == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource is required with verb"})
+			return
+		}
+		allowed, reason, err := canI(ctx, clientset, attrs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"allowed": allowed, "reason": reason, "check": describeAccess(attrs)})
+		return
+	}
+
+	actions := make(map[string]bool, len(uiActions))
+	for name, attrs := range uiActions {
+		attrs.Namespace = namespace
+		allowed, _, err := canI(ctx, clientset, attrs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		actions[name] = allowed
+	}
+
+	rulesNamespace := namespace
+	if rulesNamespace == "" {
+		rulesNamespace = "default"
+	}
+	rules, err := clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: rulesNamespace},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rules review failed: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"namespace":  rulesNamespace,
+		"actions":    actions,
+		"rules":      rules.Status.ResourceRules,
+		"incomplete": rules.Status.Incomplete,
+	})
+}
+
+// rulesAllow reports whether resource rules from a SelfSubjectRulesReview grant verb on a
+// resource; rules limited to resource names grant no list
+func rulesAllow(rules []authorizationv1.ResourceRule, verb, group, resource string) bool {
+	matches := func(values []string, value string) bool {
+		return slices.Contains(values, "*") || slices.Contains(values, value)
+	}
+	for _, rule := range rules {
+		if len(rule.ResourceNames) == 0 && matches(rule.Verbs, verb) && matches(rule.APIGroups, group) && matches(rule.Resources, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// preflight runs access checks for a handler and answers 403 naming the missing permission.
+// It returns false when the request should stop.
+func preflight(c *gin.Context, contextName string, checks ...authorizationv1.ResourceAttributes) bool {
+	clientset, _, err := createKubeClient(contextName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := checkAccess(c.Request.Context(), clientset, checks...); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// logAccessChecks lists the permissions stern needs to tail pods in the given namespaces
+func logAccessChecks(namespaces []string) []authorizationv1.ResourceAttributes {
+	var checks []authorizationv1.ResourceAttributes
+	for _, ns := range namespaces {
+		checks = append(checks,
+			authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods", Namespace: ns},
+			authorizationv1.ResourceAttributes{Verb: "watch", Resource: "pods", Namespace: ns},
+			authorizationv1.ResourceAttributes{Verb: "get", Resource: "pods", Subresource: "log", Namespace: ns},
+		)
+	}
+	return checks
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeAccessClient answers SelfSubjectAccessReviews with allow(attrs)
+func fakeAccessClient(allow func(authorizationv1.ResourceAttributes) bool) *fake.Clientset {
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		review.Status.Allowed = allow(*review.Spec.ResourceAttributes)
+		if !review.Status.Allowed {
+			review.Status.Reason = "no RBAC rule"
+		}
+		return true, review, nil
+	})
+	return clientset
+}
+
+// TestDescribeAccess verifies errors name the verb, resource and namespace
+func TestDescribeAccess(t *testing.T) {
+	assert.Equal(t, `get pods/log in namespace "prod"`, describeAccess(authorizationv1.ResourceAttributes{Verb: "get", Resource: "pods", Subresource: "log", Namespace: "prod"}))
+	assert.Equal(t, "list nodes at cluster scope", describeAccess(authorizationv1.ResourceAttributes{Verb: "list", Resource: "nodes"}))
+	assert.Equal(t, `patch deployments.apps web in namespace "prod"`, describeAccess(authorizationv1.ResourceAttributes{Verb: "patch", Group: "apps", Resource: "deployments", Name: "web", Namespace: "prod"}))
+}
+
+// TestCheckAccess verifies denied actions are reported and allowed ones pass
+func TestCheckAccess(t *testing.T) {
+	clientset := fakeAccessClient(func(attrs authorizationv1.ResourceAttributes) bool {
+		return attrs.Subresource != "log"
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, checkAccess(ctx, clientset, authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods", Namespace: "prod"}))
+
+	err := checkAccess(ctx, clientset, logAccessChecks([]string{"prod"})...)
+	var accessErr *accessError
+	assert.True(t, errors.As(err, &accessErr))
+	assert.Equal(t, `forbidden: cannot get pods/log in namespace "prod" (no RBAC rule)`, err.Error())
+
+	err = checkAccess(ctx, clientset, logAccessChecks([]string{"a", "b"})...)
+	assert.EqualError(t, err, `forbidden: cannot get pods/log in namespace "a"; cannot get pods/log in namespace "b"`)
+}
+
+// TestCheckAccessReviewUnavailable verifies checks degrade when the review API fails
+func TestCheckAccessReviewUnavailable(t *testing.T) {
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("the server could not find the requested resource")
+	})
+
+	assert.NoError(t, checkAccess(context.Background(), clientset, authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods"}))
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// How long a confirmation token issued by a preview stays valid
+const actionTokenTTL = 2 * time.Minute
+
+// Annotation kubectl rollout restart sets on the pod template
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Annotation marking static (mirror) pods, which cannot be evicted
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// actionRequest is the body of POST /api/clusters/actions
+type actionRequest struct {
+	Action             string `json:"action"` // restart, scale, delete-pod, cordon, uncordon, drain
+	Kind               string `json:"kind,omitempty"`
+	Namespace          string `json:"namespace,omitempty"`
+	Name               string `json:"name"`
+	Replicas           *int32 `json:"replicas,omitempty"`
+	GracePeriodSeconds *int64 `json:"gracePeriodSeconds,omitempty"`
+	Force              bool   `json:"force,omitempty"`
+	ConfirmationToken  string `json:"confirmationToken,omitempty"`
+}
+
+// target renders the object an action applies to, e.g. deployment prod/web or node worker-1
+func (r actionRequest) target() string {
+	switch {
+	case r.Kind == "node":
+		return "node " + r.Name
+	case r.Namespace != "":
+		return r.Kind + " " + r.Namespace + "/" + r.Name
+	default:
+		return r.Kind + " " + r.Name
+	}
+}
+
+// fingerprint identifies everything a confirmation token approves, including who may redeem it
+func (r actionRequest) fingerprint(owner, contextName string) string {
+	replicas, grace := "", ""
+	if r.Replicas != nil {
+		replicas = fmt.Sprint(*r.Replicas)
+	}
+	if r.GracePeriodSeconds != nil {
+		grace = fmt.Sprint(*r.GracePeriodSeconds)
+	}
+	return strings.Join([]string{owner, contextName, r.Action, r.Kind, r.Namespace, r.Name, replicas, grace, fmt.Sprint(r.Force)}, "|")
+}
+
+// Kinds each action accepts; the node actions imply kind node
+var actionKinds = map[string][]string{
+	"restart":    {"deployment", "statefulset", "daemonset"},
+	"scale":      {"deployment", "statefulset"},
+	"delete-pod": {"pod"},
+	"cordon":     {"node"},
+	"uncordon":   {"node"},
+	"drain":      {"node"},
+}
+
+// normalizeAction validates the request and fills in the implied kind
+func normalizeAction(req *actionRequest) error {
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	kinds, ok := actionKinds[req.Action]
+	if !ok {
+		return fmt.Errorf("unknown action %q (restart, scale, delete-pod, cordon, uncordon, drain)", req.Action)
+	}
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if alias, ok := workloadKindAliases[kind]; ok {
+		kind = alias
+	}
+	if kind == "" && len(kinds) == 1 {
+		kind = kinds[0]
+	}
+	supported := false
+	for _, k := range kinds {
+		if k == kind {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("action %s supports kinds %s", req.Action, strings.Join(kinds, ", "))
+	}
+	req.Kind = kind
+
+	if kind == "node" {
+		req.Namespace = ""
+	} else if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if req.Action == "scale" && (req.Replicas == nil || *req.Replicas < 0) {
+		return fmt.Errorf("scale requires replicas >= 0")
+	}
+	return nil
+}
+
+// actionAccess lists the permissions an action needs
+func actionAccess(req actionRequest) []authorizationv1.ResourceAttributes {
+	group := "apps"
+	resource := req.Kind + "s"
+	switch req.Action {
+	case "restart":
+		return []authorizationv1.ResourceAttributes{{Verb: "patch", Group: group, Resource: resource, Name: req.Name, Namespace: req.Namespace}}
+	case "scale":
+		return []authorizationv1.ResourceAttributes{{Verb: "update", Group: group, Resource: resource, Subresource: "scale", Name: req.Name, Namespace: req.Namespace}}
+	case "delete-pod":
+		return []authorizationv1.ResourceAttributes{{Verb: "delete", Resource: "pods", Name: req.Name, Namespace: req.Namespace}}
+	case "drain":
+		return []authorizationv1.ResourceAttributes{
+			{Verb: "patch", Resource: "nodes", Name: req.Name},
+			{Verb: "list", Resource: "pods"},
+			{Verb: "create", Resource: "pods", Subresource: "eviction"},
+		}
+	default:
+		return []authorizationv1.ResourceAttributes{{Verb: "patch", Resource: "nodes", Name: req.Name}}
+	}
+}
+
+// drainablePods splits the pods on a node into those drain evicts and those it leaves alone.
+// DaemonSet and mirror pods are skipped like kubectl drain does; unmanaged pods block the drain unless forced.
+func drainablePods(ctx context.Context, clientset kubernetes.Interface, node string, force bool) ([]corev1.Pod, []string, error) {
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + node})
+	if err != nil {
+		return nil, nil, err
+	}
+	var evict []corev1.Pod
+	var blocking []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			evict = append(evict, pod)
+			continue
+		}
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+		owner := metav1.GetControllerOf(&pod)
+		if owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		if owner == nil && !force {
+			blocking = append(blocking, pod.Namespace+"/"+pod.Name)
+			continue
+		}
+		evict = append(evict, pod)
+	}
+	return evict, blocking, nil
+}
+
+// describeAction checks the target exists and explains what confirming the action will do
+func describeAction(ctx context.Context, clientset kubernetes.Interface, req actionRequest) (string, error) {
+	apps := clientset.AppsV1()
+	switch req.Action {
+	case "restart":
+		var err error
+		switch req.Kind {
+		case "deployment":
+			_, err = apps.Deployments(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		case "statefulset":
+			_, err = apps.StatefulSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		case "daemonset":
+			_, err = apps.DaemonSets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Rolling restart of %s: every pod will be replaced", req.target()), nil
+
+	case "scale":
+		var current int32
+		if req.Kind == "deployment" {
+			scale, err := apps.Deployments(req.Namespace).GetScale(ctx, req.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			current = scale.Spec.Replicas
+		} else {
+			scale, err := apps.StatefulSets(req.Namespace).GetScale(ctx, req.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			current = scale.Spec.Replicas
+		}
+		return fmt.Sprintf("Scale %s from %d to %d replicas", req.target(), current, *req.Replicas), nil
+
+	case "delete-pod":
+		pod, err := clientset.CoreV1().Pods(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			return fmt.Sprintf("Delete %s; its %s %s will recreate it", req.target(), owner.Kind, owner.Name), nil
+		}
+		return fmt.Sprintf("Delete %s; it has no controller and will not be recreated", req.target()), nil
+
+	case "cordon", "uncordon":
+		node, err := clientset.CoreV1().Nodes().Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if node.Spec.Unschedulable == (req.Action == "cordon") {
+			return fmt.Sprintf("%s is already %sed; nothing will change", req.target(), req.Action), nil
+		}
+		if req.Action == "cordon" {
+			return fmt.Sprintf("Mark %s unschedulable; running pods are not affected", req.target()), nil
+		}
+		return fmt.Sprintf("Mark %s schedulable again", req.target()), nil
+
+	case "drain":
+		if _, err := clientset.CoreV1().Nodes().Get(ctx, req.Name, metav1.GetOptions{}); err != nil {
+			return "", err
+		}
+		evict, blocking, err := drainablePods(ctx, clientset, req.Name, req.Force)
+		if err != nil {
+			return "", err
+		}
+		if len(blocking) > 0 {
+			return "", actionRefused(fmt.Sprintf("pods not managed by a controller would be lost: %s (retry with force)", strings.Join(blocking, ", ")))
+		}
+		return fmt.Sprintf("Cordon %s and evict %d pod(s); DaemonSet and mirror pods are left running", req.target(), len(evict)), nil
+	}
+	return "", fmt.Errorf("unknown action %q", req.Action)
+}
+
+// runAction performs a confirmed action and returns a one-line result
+func runAction(ctx context.Context, clientset kubernetes.Interface, req actionRequest) (string, error) {
+	apps := clientset.AppsV1()
+	switch req.Action {
+	case "restart":
+		patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, time.Now().Format(time.RFC3339)))
+		var err error
+		switch req.Kind {
+		case "deployment":
+			_, err = apps.Deployments(req.Namespace).Patch(ctx, req.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		case "statefulset":
+			_, err = apps.StatefulSets(req.Namespace).Patch(ctx, req.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		case "daemonset":
+			_, err = apps.DaemonSets(req.Namespace).Patch(ctx, req.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		}
+		if err != nil {
+			return "", err
+		}
+		return req.target() + " restarted", nil
+
+	case "scale":
+		if req.Kind == "deployment" {
+			scale, err := apps.Deployments(req.Namespace).GetScale(ctx, req.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			scale.Spec.Replicas = *req.Replicas
+			if _, err := apps.Deployments(req.Namespace).UpdateScale(ctx, req.Name, scale, metav1.UpdateOptions{}); err != nil {
+				return "", err
+			}
+		} else {
+			scale, err := apps.StatefulSets(req.Namespace).GetScale(ctx, req.Name, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			scale.Spec.Replicas = *req.Replicas
+			if _, err := apps.StatefulSets(req.Namespace).UpdateScale(ctx, req.Name, scale, metav1.UpdateOptions{}); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%s scaled to %d", req.target(), *req.Replicas), nil
+
+	case "delete-pod":
+		err := clientset.CoreV1().Pods(req.Namespace).Delete(ctx, req.Name, metav1.DeleteOptions{GracePeriodSeconds: req.GracePeriodSeconds})
+		if err != nil {
+			return "", err
+		}
+		return req.target() + " deleted", nil
+
+	case "cordon", "uncordon":
+		if err := setUnschedulable(ctx, clientset, req.Name, req.Action == "cordon"); err != nil {
+			return "", err
+		}
+		return req.target() + " " + req.Action + "ed", nil
+
+	case "drain":
+		if err := setUnschedulable(ctx, clientset, req.Name, true); err != nil {
+			return "", err
+		}
+		evict, blocking, err := drainablePods(ctx, clientset, req.Name, req.Force)
+		if err != nil {
+			return "", err
+		}
+		if len(blocking) > 0 {
+			return "", actionRefused(fmt.Sprintf("node cordoned but not drained: unmanaged pods %s (retry with force)", strings.Join(blocking, ", ")))
+		}
+		var failed []string
+		for _, pod := range evict {
+			err := clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+				ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+				DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: req.GracePeriodSeconds},
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				// 429 means a PodDisruptionBudget refused the eviction
+				failed = append(failed, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+			}
+		}
+		if len(failed) > 0 {
+			return "", actionRefused(fmt.Sprintf("node cordoned, %d of %d evictions failed: %s", len(failed), len(evict), strings.Join(failed, "; ")))
+		}
+		return fmt.Sprintf("%s drained (%d pod(s) evicted)", req.target(), len(evict)), nil
+	}
+	return "", fmt.Errorf("unknown action %q", req.Action)
+}
+
+func setUnschedulable(ctx context.Context, clientset kubernetes.Interface, node string, unschedulable bool) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable))
+	_, err := clientset.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// actionTokens holds previews awaiting confirmation; each token is single-use and bound to the exact request
+type actionTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]actionToken
+}
+
+type actionToken struct {
+	fingerprint string
+	expires     time.Time
+}
+
+var actionTokens = &actionTokenStore{tokens: map[string]actionToken{}}
+
+func (s *actionTokenStore) issue(fingerprint string, now time.Time) (string, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tokens {
+		if now.After(t.expires) {
+			delete(s.tokens, id)
+		}
+	}
+	id := randomID(16)
+	expires := now.Add(actionTokenTTL)
+	s.tokens[id] = actionToken{fingerprint: fingerprint, expires: expires}
+	return id, expires
+}
+
+// redeem consumes a token; it fails when the token is unknown, expired or was issued for another request
+func (s *actionTokenStore) redeem(id, fingerprint string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return fmt.Errorf("unknown or already used confirmation token")
+	}
+	delete(s.tokens, id)
+	if now.After(t.expires) {
+		return fmt.Errorf("confirmation token expired")
+	}
+	if t.fingerprint != fingerprint {
+		return fmt.Errorf("confirmation token was issued for a different action")
+	}
+	return nil
+}
+
+// runClusterAction previews an action and issues a confirmation token, or, when the
+// body carries a token from a previous preview, performs it and records an audit line
+func runClusterAction(c *gin.Context) {
+	ctxName := c.Query("context")
+
+	var req actionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	if err := normalizeAction(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkPolicy(c, actionCapability(policyBody{Action: req.Action}), ctxName, req.Namespace); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+
+	clientset, _, err := createKubeClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := checkAccess(ctx, clientset, actionAccess(req)...); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	fingerprint := req.fingerprint(requestOwner(c), ctxName)
+	if req.ConfirmationToken == "" {
+		summary, err := describeAction(ctx, clientset, req)
+		if err != nil {
+			c.JSON(statusForError(err), gin.H{"error": err.Error()})
+			return
+		}
+		token, expires := actionTokens.issue(fingerprint, time.Now())
+		c.JSON(http.StatusOK, gin.H{
+			"action":            req.Action,
+			"target":            req.target(),
+			"summary":           summary,
+			"confirmationToken": token,
+			"expiresAt":         expires,
+		})
+		return
+	}
+
+	if err := actionTokens.redeem(req.ConfirmationToken, fingerprint, time.Now()); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := runAction(ctx, clientset, req)
+	event := auditEvent{
+		Verb:      req.Action,
+		Context:   currentContextName(ctxName),
+		Namespace: req.Namespace,
+		Objects:   []auditObject{{Kind: req.Kind, Namespace: req.Namespace, Name: req.Name}},
+	}
+	if req.Replicas != nil {
+		event.Details = map[string]string{"replicas": strconv.Itoa(int(*req.Replicas))}
+	}
+	if err != nil {
+		event.Result, event.Error = auditFailure, err.Error()
+	}
+	recordAudit(c, event)
+	if err != nil {
+		c.JSON(statusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"action": req.Action, "target": req.target(), "result": result})
+}
+
+// actionRefused is an action stern-ui stopped part-way or would not start, e.g. a drain blocked by unmanaged pods
+type actionRefused string
+
+func (e actionRefused) Error() string { return string(e) }
+
+// statusForError maps Kubernetes API errors to the matching HTTP status
+func statusForError(err error) int {
+	var refused actionRefused
+	switch {
+	case errors.As(err, &refused):
+		return http.StatusConflict
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsConflict(err), apierrors.IsTooManyRequests(err):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
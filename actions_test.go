@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestNormalizeAction verifies kinds are inferred or validated per action
+func TestNormalizeAction(t *testing.T) {
+	req := actionRequest{Action: "Drain", Name: "worker-1", Namespace: "ignored"}
+	require.NoError(t, normalizeAction(&req))
+	assert.Equal(t, "node", req.Kind)
+	assert.Equal(t, "", req.Namespace)
+	assert.Equal(t, "node worker-1", req.target())
+
+	req = actionRequest{Action: "restart", Kind: "sts", Name: "db"}
+	require.NoError(t, normalizeAction(&req))
+	assert.Equal(t, "statefulset default/db", req.target())
+
+	assert.ErrorContains(t, normalizeAction(&actionRequest{Action: "restart", Name: "web"}), "supports kinds deployment, statefulset, daemonset")
+	assert.ErrorContains(t, normalizeAction(&actionRequest{Action: "scale", Kind: "deploy", Name: "web"}), "replicas")
+	assert.ErrorContains(t, normalizeAction(&actionRequest{Action: "scale", Kind: "daemonset", Name: "web"}), "supports kinds")
+	assert.ErrorContains(t, normalizeAction(&actionRequest{Action: "reboot", Name: "x"}), "unknown action")
+}
+
+// TestActionTokens verifies tokens are single-use, expire and are bound to one request and caller
+func TestActionTokens(t *testing.T) {
+	store := &actionTokenStore{tokens: map[string]actionToken{}}
+	now := time.Now()
+	replicas := int32(3)
+	scale := actionRequest{Action: "scale", Kind: "deployment", Namespace: "prod", Name: "web", Replicas: &replicas}
+
+	token, _ := store.issue(scale.fingerprint("user:alice", "prod-cluster"), now)
+	assert.NoError(t, store.redeem(token, scale.fingerprint("user:alice", "prod-cluster"), now))
+	assert.ErrorContains(t, store.redeem(token, scale.fingerprint("user:alice", "prod-cluster"), now), "already used")
+
+	token, _ = store.issue(scale.fingerprint("user:alice", "prod-cluster"), now)
+	other := int32(30)
+	scale.Replicas = &other
+	assert.ErrorContains(t, store.redeem(token, scale.fingerprint("user:alice", "prod-cluster"), now), "different action")
+
+	token, _ = store.issue(scale.fingerprint("user:alice", "prod-cluster"), now)
+	assert.ErrorContains(t, store.redeem(token, scale.fingerprint("user:bob", "prod-cluster"), now), "different action")
+
+	token, _ = store.issue(scale.fingerprint("user:alice", "prod-cluster"), now)
+	assert.ErrorContains(t, store.redeem(token, scale.fingerprint("user:alice", "prod-cluster"), now.Add(actionTokenTTL+time.Second)), "expired")
+}
+
+// TestDrain verifies drain cordons, evicts managed pods and skips DaemonSet and mirror pods
+func TestDrain(t *testing.T) {
+	controller := true
+	pod := func(name string, owner string, annotations map[string]string) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", Annotations: annotations},
+			Spec:       corev1.PodSpec{NodeName: "worker-1"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		if owner != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: owner, Name: name + "-owner", Controller: &controller}}
+		}
+		return p
+	}
+	clientset := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}},
+		pod("web-1", "ReplicaSet", nil),
+		pod("agent-1", "DaemonSet", nil),
+		pod("static-1", "", map[string]string{mirrorPodAnnotation: "x"}),
+		pod("bare-1", "", nil),
+	)
+	var evicted []string
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		evicted = append(evicted, action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName())
+		return true, nil, nil
+	})
+	ctx := context.Background()
+	req := actionRequest{Action: "drain", Kind: "node", Name: "worker-1"}
+
+	_, err := describeAction(ctx, clientset, req)
+	assert.ErrorContains(t, err, "prod/bare-1")
+	assert.Equal(t, http.StatusConflict, statusForError(err))
+
+	req.Force = true
+	summary, err := describeAction(ctx, clientset, req)
+	require.NoError(t, err)
+	assert.Contains(t, summary, "evict 2 pod(s)")
+
+	result, err := runAction(ctx, clientset, req)
+	require.NoError(t, err)
+	assert.Equal(t, "node worker-1 drained (2 pod(s) evicted)", result)
+	assert.ElementsMatch(t, []string{"web-1", "bare-1"}, evicted)
+
+	node, err := clientset.CoreV1().Nodes().Get(ctx, "worker-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.True(t, node.Spec.Unschedulable)
+}
+
+// TestRestartAction verifies a rollout restart stamps the pod template
+func TestRestartAction(t *testing.T) {
+	clientset := fake.NewClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}})
+	ctx := context.Background()
+	req := actionRequest{Action: "restart", Kind: "deployment", Namespace: "prod", Name: "web"}
+
+	result, err := runAction(ctx, clientset, req)
+	require.NoError(t, err)
+	assert.Equal(t, "deployment prod/web restarted", result)
+
+	deploy, err := clientset.AppsV1().Deployments("prod").Get(ctx, "web", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, deploy.Spec.Template.Annotations[restartedAtAnnotation])
+
+	_, err = describeAction(ctx, clientset, actionRequest{Action: "restart", Kind: "deployment", Namespace: "prod", Name: "missing"})
+	assert.Equal(t, http.StatusNotFound, statusForError(err))
+}
+
+// TestClusterActionRejectsInvalidRequest verifies validation happens before touching the cluster
+func TestClusterActionRejectsInvalidRequest(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/clusters/actions", strings.NewReader(`{"action":"scale","kind":"deployment","name":"web"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "scale requires replicas")
+}
@@ -0,0 +1,775 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	stern "github.com/stern/stern/stern"
+	"sigs.k8s.io/yaml"
+)
+
+// File holding alert rules; CRUD endpoints write it back
+var alertRulesPath = func() string {
+	if path := os.Getenv("STERN_UI_ALERT_RULES"); path != "" {
+		return path
+	}
+	return filepath.Join(dataDir, "alert-rules.yaml")
+}()
+
+// Webhook hosts alert rules may post to (comma-separated globs such as *.slack.com). Unset,
+// any host is allowed except loopback, private and link-local addresses.
+var webhookAllow = splitPatterns(os.Getenv("STERN_UI_ALERT_WEBHOOK_ALLOW"))
+
+// Client used to deliver webhook notifications. Without an allowlist it connects directly and
+// refuses internal addresses, whatever the host name resolves to; with one it honours the proxy
+// environment. It never follows redirects.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if len(webhookAllow) == 0 {
+				return nil, nil
+			}
+			return http.ProxyFromEnvironment(req)
+		},
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); len(webhookAllow) == 0 && ip != nil && internalIP(ip) {
+					return fmt.Errorf("webhook address %s is internal", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// internalIP reports loopback, private, link-local (cloud metadata) and unspecified addresses
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// checkWebhook accepts http(s) URLs whose host is in webhookAllow or, without one, is not an
+// internal address
+func checkWebhook(hook string) error {
+	u, err := url.Parse(hook)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return fmt.Errorf("webhook %q must be an http(s) URL", redactWebhook(hook))
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(webhookAllow) > 0 {
+		for _, pattern := range webhookAllow {
+			if ok, _ := path.Match(pattern, host); ok {
+				return nil
+			}
+		}
+		return fmt.Errorf("webhook host %q is not in STERN_UI_ALERT_WEBHOOK_ALLOW", host)
+	}
+	if ip := net.ParseIP(host); (ip != nil && internalIP(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("webhook host %q is an internal address", host)
+	}
+	return nil
+}
+
+// redactWebhook keeps the scheme and host of a webhook URL; Slack and Teams incoming webhooks
+// carry their credential in the path
+func redactWebhook(hook string) string {
+	u, err := url.Parse(hook)
+	if err != nil || u.Host == "" {
+		return "[redacted]"
+	}
+	return u.Scheme + "://" + u.Host + "/[redacted]"
+}
+
+// logLine is one line as rendered by createSternTemplate
+type logLine struct {
+	Namespace     string `json:"namespace"`
+	PodName       string `json:"podName"`
+	ContainerName string `json:"containerName"`
+	NodeName      string `json:"nodeName"`
+	Message       string `json:"message"`
+}
+
+// alertCondition matches a log line: a regex over the message, or a comparison on a JSON field of it
+type alertCondition struct {
+	Regex string `json:"regex,omitempty"`
+	Field string `json:"field,omitempty"` // dotted path into a JSON message, e.g. http.status
+	Op    string `json:"op,omitempty"`    // =, !=, >, >=, <, <=, ~ (regex); default =
+	Value string `json:"value,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// alertRule watches a log stream and notifies webhooks when a condition matches often enough
+type alertRule struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Disabled  bool              `json:"disabled,omitempty"`
+	Context   string            `json:"context,omitempty"`
+	Query     map[string]string `json:"query"` // /ws/logs parameters: namespace, selector, workload, include, ...
+	Condition alertCondition    `json:"condition"`
+	Threshold int               `json:"threshold,omitempty"` // matches within window; default 1
+	Window    string            `json:"window,omitempty"`    // default 1m
+	Cooldown  string            `json:"cooldown,omitempty"`  // default 5m
+	Samples   int               `json:"samples,omitempty"`   // sample lines per notification; default 5
+	Webhooks  []string          `json:"webhooks"`
+	Owner     string            `json:"owner,omitempty"` // requestOwner of the creator; rules without one are managed in the file
+
+	window   time.Duration
+	cooldown time.Duration
+}
+
+type alertRulesFile struct {
+	Rules []*alertRule `json:"rules"`
+}
+
+func parseRuleDuration(raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return d, nil
+}
+
+// validate checks the rule and compiles its condition
+func (r *alertRule) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	cond := &r.Condition
+	switch {
+	case cond.Field == "" && cond.Regex == "":
+		return errors.New("condition needs a regex or a field")
+	case cond.Field != "" && cond.Regex != "":
+		return errors.New("condition takes either a regex or a field, not both")
+	}
+	if cond.Field != "" && cond.Op == "" {
+		cond.Op = "="
+	}
+	pattern := cond.Regex
+	switch cond.Op {
+	case "", "=", "!=":
+	case ">", ">=", "<", "<=":
+		if _, err := strconv.ParseFloat(cond.Value, 64); err != nil {
+			return fmt.Errorf("op %s needs a numeric value", cond.Op)
+		}
+	case "~":
+		pattern = cond.Value
+	default:
+		return fmt.Errorf("unknown op %q", cond.Op)
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		cond.regex = re
+	}
+
+	if r.Threshold <= 0 {
+		r.Threshold = 1
+	}
+	if r.Samples <= 0 {
+		r.Samples = 5
+	}
+	var err error
+	if r.window, err = parseRuleDuration(r.Window, time.Minute); err != nil {
+		return fmt.Errorf("window: %w", err)
+	}
+	if r.cooldown, err = parseRuleDuration(r.Cooldown, 5*time.Minute); err != nil {
+		return fmt.Errorf("cooldown: %w", err)
+	}
+	if len(r.Webhooks) == 0 {
+		return errors.New("at least one webhook is required")
+	}
+	for _, hook := range r.Webhooks {
+		if err := checkWebhook(hook); err != nil {
+			return err
+		}
+	}
+	// The rule only watches new lines; the engine decides tail and since
+	for _, key := range []string{"tail", "since", "sinceTime", "untilTime", "timeRangeMode", "noFollow"} {
+		delete(r.Query, key)
+	}
+	return nil
+}
+
+// lookupField follows a dotted path through decoded JSON
+func lookupField(doc map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// matches reports whether a log message satisfies the condition
+func (cond *alertCondition) matches(message string) bool {
+	if cond.Field == "" {
+		return cond.regex.MatchString(message)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &doc); err != nil {
+		return false
+	}
+	raw, ok := lookupField(doc, cond.Field)
+	if !ok {
+		return false
+	}
+	value := fmt.Sprint(raw)
+	switch cond.Op {
+	case "=":
+		return value == cond.Value
+	case "!=":
+		return value != cond.Value
+	case "~":
+		return cond.regex.MatchString(value)
+	}
+	got, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	want, _ := strconv.ParseFloat(cond.Value, 64)
+	switch cond.Op {
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	case "<":
+		return got < want
+	default:
+		return got <= want
+	}
+}
+
+// alertSample is a distinct matching line and how often it was seen
+type alertSample struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Message   string `json:"message"`
+	Count     int    `json:"count"`
+}
+
+// alertNotification is the webhook payload. text makes it render in Slack and Teams incoming webhooks.
+type alertNotification struct {
+	Text       string        `json:"text"`
+	Rule       string        `json:"rule"`
+	RuleID     string        `json:"ruleId"`
+	Context    string        `json:"context"`
+	Matches    int           `json:"matches"`
+	Window     string        `json:"window"`
+	Suppressed int           `json:"suppressed"`
+	FiredAt    time.Time     `json:"firedAt"`
+	Samples    []alertSample `json:"samples"`
+}
+
+// alertState is the sliding window of matches for one rule
+type alertState struct {
+	mu         sync.Mutex
+	matches    []time.Time
+	samples    []alertSample
+	lastFired  time.Time
+	suppressed int
+	lastError  string
+}
+
+// observe records a line and returns a notification when the rule fires.
+// Matches are counted over the window; after firing the window restarts, and
+// threshold crossings during the cooldown are counted as suppressed instead of sent.
+func (s *alertState) observe(rule *alertRule, line logLine, now time.Time) *alertNotification {
+	if !rule.Condition.matches(line.Message) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := now.Add(-rule.window)
+	kept := s.matches[:0]
+	for _, t := range s.matches {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.matches = append(kept, now)
+	if len(s.matches) == 1 {
+		s.samples = nil
+	}
+
+	// Deduplicate identical lines so one noisy pod does not fill the samples
+	duplicate := false
+	for i := range s.samples {
+		if s.samples[i].Message == line.Message {
+			s.samples[i].Count++
+			duplicate = true
+			break
+		}
+	}
+	if !duplicate && len(s.samples) < rule.Samples {
+		s.samples = append(s.samples, alertSample{Namespace: line.Namespace, Pod: line.PodName, Container: line.ContainerName, Message: line.Message, Count: 1})
+	}
+
+	if len(s.matches) < rule.Threshold {
+		return nil
+	}
+	matches := len(s.matches)
+	samples := s.samples
+	s.matches, s.samples = nil, nil
+	if !s.lastFired.IsZero() && now.Sub(s.lastFired) < rule.cooldown {
+		s.suppressed++
+		return nil
+	}
+
+	n := &alertNotification{
+		Rule:       rule.Name,
+		RuleID:     rule.ID,
+		Context:    rule.Context,
+		Matches:    matches,
+		Window:     rule.window.String(),
+		Suppressed: s.suppressed,
+		FiredAt:    now,
+		Samples:    samples,
+	}
+	s.lastFired = now
+	s.suppressed = 0
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s*: %d matching log lines in %s", rule.Name, matches, rule.window)
+	if rule.Context != "" {
+		fmt.Fprintf(&text, " (context %s)", rule.Context)
+	}
+	if n.Suppressed > 0 {
+		fmt.Fprintf(&text, ", %d alerts suppressed during cooldown", n.Suppressed)
+	}
+	text.WriteString("\n```\n")
+	for _, sample := range samples {
+		fmt.Fprintf(&text, "%s/%s %s\n", sample.Namespace, sample.Pod, sample.Message)
+	}
+	text.WriteString("```")
+	n.Text = text.String()
+	return n
+}
+
+// sendWebhooks posts a notification to every webhook of the rule
+func sendWebhooks(ctx context.Context, rule *alertRule, n *alertNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, hook := range rule.Webhooks {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook, bytes.NewReader(body))
+		if err != nil {
+			failures = append(failures, redactWebhook(hook)+": invalid URL")
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			// The error quotes the URL, which is a credential for most webhooks
+			failures = append(failures, fmt.Sprintf("%s: %v", req.URL.Host, errors.Unwrap(err)))
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			failures = append(failures, fmt.Sprintf("%s: HTTP %d", req.URL.Host, resp.StatusCode))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("webhook delivery failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// alertWriter evaluates the log lines of a rule
+type alertWriter struct {
+	ctx   context.Context
+	rule  *alertRule
+	state *alertState
+}
+
+func (w *alertWriter) observe(line logLine) {
+	n := w.state.observe(w.rule, line, time.Now())
+	if n == nil {
+		return
+	}
+	log.Printf("[INFO] alert %q fired (%d matches)", w.rule.Name, n.Matches)
+	go func() {
+		if err := sendWebhooks(w.ctx, w.rule, n); err != nil {
+			log.Printf("[WARN] alert %q: %v", w.rule.Name, err)
+			w.state.setError(err)
+		}
+	}()
+}
+
+func (s *alertState) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+// runAlertRule keeps a headless stern session open for the rule until ctx ends
+func runAlertRule(ctx context.Context, rule *alertRule, state *alertState) {
+	out := newLineWriter((&alertWriter{ctx: ctx, rule: rule, state: state}).observe)
+	runHeadlessSession(ctx, fmt.Sprintf("alert %q", rule.Name), rule.Context, rule.Query, out, func(config *stern.Config) {
+		// Only new lines count towards the threshold
+		noTail := int64(0)
+		config.TailLines = &noTail
+		config.Since = time.Second
+		config.Follow = true
+	}, state.setError)
+}
+
+// alertEngine owns the rules file and one headless session per enabled rule
+type alertEngine struct {
+	mu      sync.Mutex
+	path    string
+	rules   map[string]*alertRule
+	states  map[string]*alertState
+	cancels map[string]context.CancelFunc
+	run     func(ctx context.Context, rule *alertRule, state *alertState)
+	loadErr error // set when the rules file could not be loaded; the file is then never rewritten
+}
+
+// errAlertRulesReadOnly refuses API changes while the rules file failed to load, since saving
+// would replace the file with the rules that did load
+var errAlertRulesReadOnly = errors.New("alert rules are read-only until the rules file loads")
+
+var alerts = &alertEngine{
+	path:    alertRulesPath,
+	rules:   map[string]*alertRule{},
+	states:  map[string]*alertState{},
+	cancels: map[string]context.CancelFunc{},
+	run:     runAlertRule,
+}
+
+// load reads the rules file (a missing file means no rules) and starts every enabled rule.
+// Every rule is validated before any starts; when one is invalid none run and the engine
+// turns read-only.
+func (e *alertEngine) load() error {
+	rules, err := readAlertRules(e.path)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.loadErr = err
+		return err
+	}
+	for _, rule := range rules {
+		e.rules[rule.ID] = rule
+		e.start(rule)
+	}
+	return nil
+}
+
+// readAlertRules parses and validates the rules file
+func readAlertRules(path string) ([]*alertRule, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file alertRulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, rule := range file.Rules {
+		if rule.ID == "" {
+			rule.ID = randomID(6)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: rule %q: %w", path, rule.Name, err)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("%s: duplicate rule id %q", path, rule.ID)
+		}
+		seen[rule.ID] = true
+	}
+	return file.Rules, nil
+}
+
+// writable returns errAlertRulesReadOnly while the rules file failed to load; callers hold e.mu
+func (e *alertEngine) writable() error {
+	if e.loadErr != nil {
+		return fmt.Errorf("%w: %v", errAlertRulesReadOnly, e.loadErr)
+	}
+	return nil
+}
+
+// save writes all rules back to the rules file; callers hold e.mu
+func (e *alertEngine) save() error {
+	file := alertRulesFile{Rules: e.sorted()}
+	data, err := yaml.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0o700); err != nil {
+		return err
+	}
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
+
+func (e *alertEngine) sorted() []*alertRule {
+	rules := make([]*alertRule, 0, len(e.rules))
+	for _, rule := range e.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// start (re)launches the session of a rule; callers hold e.mu
+func (e *alertEngine) start(rule *alertRule) {
+	e.stop(rule.ID)
+	state := &alertState{}
+	e.states[rule.ID] = state
+	if rule.Disabled {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancels[rule.ID] = cancel
+	go e.run(ctx, rule, state)
+}
+
+func (e *alertEngine) stop(id string) {
+	if cancel, ok := e.cancels[id]; ok {
+		cancel()
+		delete(e.cancels, id)
+	}
+}
+
+// put creates or replaces a rule, persists the file and restarts its session
+func (e *alertEngine) put(rule *alertRule) error {
+	if err := rule.validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.writable(); err != nil {
+		return err
+	}
+	previous, existed := e.rules[rule.ID]
+	e.rules[rule.ID] = rule
+	if err := e.save(); err != nil {
+		if existed {
+			e.rules[rule.ID] = previous
+		} else {
+			delete(e.rules, rule.ID)
+		}
+		return err
+	}
+	e.start(rule)
+	return nil
+}
+
+// remove deletes a rule; it reports false when the rule does not exist
+func (e *alertEngine) remove(id string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.writable(); err != nil {
+		return true, err
+	}
+	rule, ok := e.rules[id]
+	if !ok {
+		return false, nil
+	}
+	delete(e.rules, id)
+	if err := e.save(); err != nil {
+		e.rules[id] = rule
+		return true, err
+	}
+	e.stop(id)
+	delete(e.states, id)
+	return true, nil
+}
+
+// visibleTo returns the rule as owner may see it: the webhooks of other owners' rules and
+// of rules from the file are redacted
+func (r *alertRule) visibleTo(owner string) *alertRule {
+	if r.Owner != "" && r.Owner == owner {
+		return r
+	}
+	redacted := *r
+	redacted.Webhooks = make([]string, len(r.Webhooks))
+	for i, hook := range r.Webhooks {
+		redacted.Webhooks[i] = redactWebhook(hook)
+	}
+	return &redacted
+}
+
+// alertRuleStatus is a rule as returned by the API, with its runtime state
+type alertRuleStatus struct {
+	*alertRule
+	Running   bool       `json:"running"`
+	LastFired *time.Time `json:"lastFired,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+func (e *alertEngine) status(rule *alertRule) alertRuleStatus {
+	st := alertRuleStatus{alertRule: rule}
+	_, st.Running = e.cancels[rule.ID]
+	if state, ok := e.states[rule.ID]; ok {
+		state.mu.Lock()
+		if !state.lastFired.IsZero() {
+			fired := state.lastFired
+			st.LastFired = &fired
+		}
+		st.LastError = state.lastError
+		state.mu.Unlock()
+	}
+	return st
+}
+
+// alertEngineStatus is the HTTP status for an error from put or remove
+func alertEngineStatus(err error) int {
+	if errors.Is(err, errAlertRulesReadOnly) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// startAlertEngine loads the rules file at startup
+func startAlertEngine() {
+	if err := alerts.load(); err != nil {
+		log.Printf("[WARN] alert rules not loaded, no rule runs and the API cannot change rules until the file is fixed and stern-ui restarted: %v", err)
+		return
+	}
+	if n := len(alerts.rules); n > 0 {
+		log.Printf("[INFO] loaded %d alert rule(s) from %s", n, alerts.path)
+	}
+}
+
+// listAlertRules returns the rules whose context and namespaces the caller may read, with their state
+func listAlertRules(c *gin.Context) {
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	result := make([]alertRuleStatus, 0, len(alerts.rules))
+	for _, rule := range alerts.sorted() {
+		if checkQueryPolicy(c, rule.Context, rule.Query) == nil {
+			result = append(result, alerts.status(rule.visibleTo(requestOwner(c))))
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ownedAlertRule returns rule id when the caller may change it: it must be theirs and
+// within their policy. Otherwise it writes the error response and returns nil.
+func ownedAlertRule(c *gin.Context, id string) *alertRule {
+	alerts.mu.Lock()
+	rule, ok := alerts.rules[id]
+	alerts.mu.Unlock()
+	if ok && checkQueryPolicy(c, rule.Context, rule.Query) != nil {
+		ok = false // rules outside the caller's policy are not listed to them either
+	}
+	switch {
+	case !ok:
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert rule not found"})
+		return nil
+	case rule.Owner == "":
+		c.JSON(http.StatusForbidden, gin.H{"error": "alert rule is managed in the rules file"})
+		return nil
+	case rule.Owner != requestOwner(c):
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can change an alert rule"})
+		return nil
+	}
+	return rule
+}
+
+// saveAlertRule creates a rule (POST) or replaces one (PUT /:id)
+func saveAlertRule(c *gin.Context) {
+	var rule alertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	status := http.StatusCreated
+	if id := c.Param("id"); id != "" {
+		existing := ownedAlertRule(c, id)
+		if existing == nil {
+			return
+		}
+		rule.ID, rule.Owner = id, existing.Owner
+		status = http.StatusOK
+	} else {
+		rule.ID, rule.Owner = randomID(6), requestOwner(c)
+	}
+	if err := rule.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkQueryPolicy(c, rule.Context, rule.Query); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+	if !preflightCollectedLogs(c, rule.Context, streamNamespaces(rule.Query["namespace"], rule.Query["allNamespaces"])) {
+		return
+	}
+	if err := alerts.put(&rule); err != nil {
+		c.JSON(alertEngineStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "alert-rule-save", Context: rule.Context, Namespace: rule.Query["namespace"], Details: map[string]string{"id": rule.ID, "name": rule.Name}})
+
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	c.JSON(status, alerts.status(&rule))
+}
+
+// deleteAlertRule removes a rule the caller owns and stops its session
+func deleteAlertRule(c *gin.Context) {
+	if ownedAlertRule(c, c.Param("id")) == nil {
+		return
+	}
+	found, err := alerts.remove(c.Param("id"))
+	switch {
+	case err != nil:
+		c.JSON(alertEngineStatus(err), gin.H{"error": err.Error()})
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "alert rule not found"})
+	default:
+		recordAudit(c, auditEvent{Verb: "alert-rule-delete", Details: map[string]string{"id": c.Param("id")}})
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRule(t *testing.T, cond alertCondition) *alertRule {
+	rule := &alertRule{ID: "r1", Name: "errors", Condition: cond, Threshold: 3, Window: "1m", Cooldown: "10m", Samples: 2, Webhooks: []string{"https://hooks.example.com/x"}}
+	require.NoError(t, rule.validate())
+	return rule
+}
+
+// TestAlertRuleValidate verifies defaults and rejected rules
+func TestAlertRuleValidate(t *testing.T) {
+	rule := &alertRule{Name: "x", Condition: alertCondition{Field: "status", Op: ">=", Value: "500"}, Webhooks: []string{"https://h"}, Query: map[string]string{"namespace": "prod", "tail": "100"}}
+	require.NoError(t, rule.validate())
+	assert.Equal(t, 1, rule.Threshold)
+	assert.Equal(t, time.Minute, rule.window)
+	assert.Equal(t, 5*time.Minute, rule.cooldown)
+	assert.Equal(t, map[string]string{"namespace": "prod"}, rule.Query)
+
+	for want, bad := range map[string]*alertRule{
+		"name is required":        {Condition: alertCondition{Regex: "x"}, Webhooks: []string{"https://h"}},
+		"regex or a field":        {Name: "x", Webhooks: []string{"https://h"}},
+		"numeric value":           {Name: "x", Condition: alertCondition{Field: "f", Op: ">", Value: "high"}, Webhooks: []string{"https://h"}},
+		"invalid regex":           {Name: "x", Condition: alertCondition{Regex: "("}, Webhooks: []string{"https://h"}},
+		"at least one webhook":    {Name: "x", Condition: alertCondition{Regex: "x"}},
+		"must be an http(s) URL":  {Name: "x", Condition: alertCondition{Regex: "x"}, Webhooks: []string{"file:///etc/passwd"}},
+		"window: invalid":         {Name: "x", Condition: alertCondition{Regex: "x"}, Webhooks: []string{"https://h"}, Window: "soon"},
+		"either a regex or a fie": {Name: "x", Condition: alertCondition{Regex: "x", Field: "y"}, Webhooks: []string{"https://h"}},
+	} {
+		assert.ErrorContains(t, bad.validate(), want)
+	}
+}
+
+// TestAlertConditionMatches verifies regex and JSON field conditions
+func TestAlertConditionMatches(t *testing.T) {
+	assert.True(t, testRule(t, alertCondition{Regex: "(?i)panic"}).Condition.matches("PANIC: nil map"))
+
+	status := testRule(t, alertCondition{Field: "http.status", Op: ">=", Value: "500"}).Condition
+	assert.True(t, status.matches(`{"http":{"status":503}}`))
+	assert.False(t, status.matches(`{"http":{"status":200}}`))
+	assert.False(t, status.matches(`not json`))
+
+	level := testRule(t, alertCondition{Field: "level", Value: "error"}).Condition
+	assert.True(t, level.matches(`{"level":"error"}`))
+	assert.False(t, level.matches(`{"level":"info"}`))
+
+	user := testRule(t, alertCondition{Field: "user", Op: "~", Value: "^admin"}).Condition
+	assert.True(t, user.matches(`{"user":"admin-1"}`))
+}
+
+// TestAlertStateObserve verifies threshold, window, sample deduplication and cooldown
+func TestAlertStateObserve(t *testing.T) {
+	rule := testRule(t, alertCondition{Regex: "ERROR"})
+	state := &alertState{}
+	now := time.Now()
+	line := func(pod, msg string) logLine { return logLine{Namespace: "prod", PodName: pod, Message: msg} }
+
+	assert.Nil(t, state.observe(rule, line("a", "INFO ok"), now))
+	assert.Nil(t, state.observe(rule, line("a", "ERROR db down"), now))
+	// The first match slides out of the window
+	assert.Nil(t, state.observe(rule, line("a", "ERROR db down"), now.Add(2*time.Minute)))
+	assert.Nil(t, state.observe(rule, line("b", "ERROR db down"), now.Add(2*time.Minute)))
+
+	n := state.observe(rule, line("c", "ERROR timeout"), now.Add(2*time.Minute))
+	require.NotNil(t, n)
+	assert.Equal(t, 3, n.Matches)
+	require.Len(t, n.Samples, 2)
+	assert.Equal(t, "ERROR db down", n.Samples[0].Message)
+	assert.Equal(t, 2, n.Samples[0].Count)
+	assert.Contains(t, n.Text, "*errors*: 3 matching log lines in 1m0s")
+
+	// Crossing the threshold again during the cooldown is suppressed, then reported
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, state.observe(rule, line("a", "ERROR again"), now.Add(3*time.Minute)))
+	}
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, state.observe(rule, line("a", "ERROR later"), now.Add(13*time.Minute)))
+	}
+	n = state.observe(rule, line("a", "ERROR later"), now.Add(13*time.Minute))
+	require.NotNil(t, n)
+	assert.Equal(t, 1, n.Suppressed)
+}
+
+// TestSendWebhooks verifies the Slack/Teams-compatible payload is posted
+func TestSendWebhooks(t *testing.T) {
+	allow := webhookAllow
+	t.Cleanup(func() { webhookAllow = allow })
+	webhookAllow = []string{"127.0.0.1"}
+	var got alertNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	rule := &alertRule{Name: "errors", Webhooks: []string{server.URL}}
+	require.NoError(t, sendWebhooks(context.Background(), rule, &alertNotification{Text: "hello", Rule: "errors", Matches: 3}))
+	assert.Equal(t, "hello", got.Text)
+	assert.Equal(t, 3, got.Matches)
+
+	rule.Webhooks = append(rule.Webhooks, failing.URL)
+	assert.ErrorContains(t, sendWebhooks(context.Background(), rule, &alertNotification{}), "HTTP 502")
+
+	webhookAllow = nil
+	webhookClient.CloseIdleConnections()
+	rule.Webhooks = []string{server.URL + "/token"}
+	err := sendWebhooks(context.Background(), rule, &alertNotification{})
+	assert.ErrorContains(t, err, "is internal", "the dialer refuses internal addresses without an allowlist")
+	assert.NotContains(t, err.Error(), "/token")
+}
+
+// TestCheckWebhook verifies internal addresses are refused and the allowlist is enforced
+func TestCheckWebhook(t *testing.T) {
+	allow := webhookAllow
+	t.Cleanup(func() { webhookAllow = allow })
+
+	webhookAllow = nil
+	assert.NoError(t, checkWebhook("https://hooks.slack.com/services/T/B/x"))
+	for _, hook := range []string{"ftp://h/x", "https:///x", "http://127.0.0.1:8080/x", "http://169.254.169.254/latest", "http://10.0.0.1/x", "http://[::1]/x", "http://localhost/x"} {
+		assert.Error(t, checkWebhook(hook), hook)
+	}
+
+	webhookAllow = []string{"*.slack.com", "10.0.0.1"}
+	assert.NoError(t, checkWebhook("https://hooks.slack.com/services/T/B/x"))
+	assert.NoError(t, checkWebhook("http://10.0.0.1/alertmanager"))
+	assert.ErrorContains(t, checkWebhook("https://example.com/x"), "not in STERN_UI_ALERT_WEBHOOK_ALLOW")
+
+	assert.Equal(t, "https://hooks.slack.com/[redacted]", redactWebhook("https://hooks.slack.com/services/T/B/x"))
+}
+
+// TestAlertWriter verifies stern output is split into lines and evaluated
+func TestAlertWriter(t *testing.T) {
+	rule := testRule(t, alertCondition{Regex: "ERROR"})
+	rule.Threshold = 100
+	state := &alertState{}
+	w := newLineWriter((&alertWriter{ctx: context.Background(), rule: rule, state: state}).observe)
+
+	_, _ = w.Write([]byte(`{"namespace":"prod","podName":"a","message":"ERROR one"}` + "\n" + `{"namespace":"prod","podName":"a","mess`))
+	_, _ = w.Write([]byte(`age":"ERROR two"}` + "\n"))
+	assert.Len(t, state.matches, 2)
+}
+
+// TestAlertEngine verifies rules are persisted to the file, reloaded and their sessions managed
+func TestAlertEngine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	started := make(chan string, 10)
+	newEngine := func() *alertEngine {
+		return &alertEngine{
+			path: path, rules: map[string]*alertRule{}, states: map[string]*alertState{}, cancels: map[string]context.CancelFunc{},
+			run: func(ctx context.Context, rule *alertRule, state *alertState) { started <- rule.ID },
+		}
+	}
+	engine := newEngine()
+	require.NoError(t, engine.load())
+
+	require.NoError(t, engine.put(testRule(t, alertCondition{Regex: "ERROR"})))
+	disabled := testRule(t, alertCondition{Regex: "WARN"})
+	disabled.ID, disabled.Name, disabled.Disabled = "r2", "warnings", true
+	require.NoError(t, engine.put(disabled))
+	assert.Equal(t, "r1", <-started)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "regex: ERROR")
+
+	reloaded := newEngine()
+	require.NoError(t, reloaded.load())
+	assert.Len(t, reloaded.rules, 2)
+	assert.Equal(t, "r1", <-started)
+	assert.Equal(t, 10*time.Minute, reloaded.rules["r1"].cooldown)
+
+	found, err := reloaded.remove("r1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.NotContains(t, reloaded.cancels, "r1")
+	found, _ = reloaded.remove("r1")
+	assert.False(t, found)
+}
+
+// TestAlertEngineInvalidFile verifies a rules file with an invalid rule starts no rule and is never overwritten
+func TestAlertEngineInvalidFile(t *testing.T) {
+	for name, content := range map[string]string{
+		"invalid rule": "rules:\n- id: a\n  name: good\n  condition: {regex: ERROR}\n  webhooks: ['https://h']\n- id: b\n  name: bad\n  condition: {regex: '('}\n  webhooks: ['https://h']\n",
+		"invalid yaml": "rules: [\n",
+	} {
+		path := filepath.Join(t.TempDir(), "rules.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		started := make(chan string, 10)
+		engine := &alertEngine{
+			path: path, rules: map[string]*alertRule{}, states: map[string]*alertState{}, cancels: map[string]context.CancelFunc{},
+			run: func(ctx context.Context, rule *alertRule, state *alertState) { started <- rule.ID },
+		}
+
+		assert.Error(t, engine.load(), name)
+		assert.Empty(t, engine.rules, name)
+		assert.Empty(t, started, name)
+		assert.ErrorIs(t, engine.put(testRule(t, alertCondition{Regex: "ERROR"})), errAlertRulesReadOnly, name)
+		_, err := engine.remove("a")
+		assert.ErrorIs(t, err, errAlertRulesReadOnly, name)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+}
+
+// TestSaveAlertRuleRejectsInvalidRule verifies validation errors are returned as 400
+func TestSaveAlertRuleRejectsInvalidRule(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/alerts/rules", strings.NewReader(`{"name":"x","condition":{"regex":"("},"webhooks":["https://h"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid regex")
+}
+
+// TestAlertRuleOwnership verifies only the creator changes a rule and rules outside the policy are hidden
+func TestAlertRuleOwnership(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\nbob-token,bob\ncarol-token,carol\n"))
+	testPolicyEngine(t, "rules:\n- users: [alice, bob]\n  contexts: ['*']\n  namespaces: [shop]\n  capabilities: [logs]\n- users: [carol]\n  contexts: ['*']\n  namespaces: [billing]\n  capabilities: [logs]\n")
+	r := setupRouter()
+	serve := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	rule := `{"name":"errors","disabled":true,"context":"dev","query":{"namespace":"shop"},"condition":{"regex":"error"},"webhooks":["https://h/secret"]}`
+
+	w := serve("alice-token", "POST", "/api/alerts/rules", rule)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created alertRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "user:alice", created.Owner)
+	path := "/api/alerts/rules/" + created.ID
+
+	listed := func(token string) *alertRule {
+		var rules []alertRule
+		require.NoError(t, json.Unmarshal(serve(token, "GET", "/api/alerts/rules", "").Body.Bytes(), &rules))
+		for _, rule := range rules {
+			if rule.ID == created.ID {
+				return &rule
+			}
+		}
+		return nil
+	}
+	require.NotNil(t, listed("alice-token"))
+	assert.Equal(t, []string{"https://h/secret"}, listed("alice-token").Webhooks)
+	require.NotNil(t, listed("bob-token"))
+	assert.Equal(t, []string{"https://h/[redacted]"}, listed("bob-token").Webhooks, "webhook credentials are only shown to the owner")
+	assert.Nil(t, listed("carol-token"))
+
+	assert.Equal(t, http.StatusForbidden, serve("bob-token", "PUT", path, rule).Code)
+	assert.Equal(t, http.StatusForbidden, serve("bob-token", "DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve("carol-token", "DELETE", path, "").Code)
+	assert.Equal(t, http.StatusOK, serve("alice-token", "PUT", path, rule).Code)
+	assert.Equal(t, http.StatusNoContent, serve("alice-token", "DELETE", path, "").Code)
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Field manager used for server-side apply (and its dry runs)
+const applyFieldManager = "stern-ui"
+
+// decodeManifest splits a multi-document YAML (or JSON) manifest into objects.
+// List kinds are flattened and empty documents are skipped.
+func decodeManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest), 4096)
+	var objects []*unstructured.Unstructured
+	for doc := 1; ; doc++ {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(raw) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{Object: raw}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("document %d: %w", doc, err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		objects = append(objects, obj)
+	}
+
+	for i, obj := range objects {
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+			return nil, fmt.Errorf("object %d: apiVersion and kind are required", i+1)
+		}
+		if obj.GetName() == "" {
+			return nil, fmt.Errorf("object %d (%s): metadata.name is required", i+1, obj.GetKind())
+		}
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("yaml contains no objects")
+	}
+	return objects, nil
+}
+
+// resourceForObject finds the discovered resource serving an object's group and kind.
+// The object's own version is kept so the server converts it as kubectl would.
+func resourceForObject(resources []apiResource, obj *unstructured.Unstructured) (apiResource, error) {
+	gvk := obj.GroupVersionKind()
+	for _, r := range resources {
+		if r.Group == gvk.Group && r.Kind == gvk.Kind {
+			r.Version = gvk.Version
+			return r, nil
+		}
+	}
+	return apiResource{}, fmt.Errorf("no resource found for %s", gvk.String())
+}
+
+// objectResult is the per-object outcome of a dry run or apply
+type objectResult struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Namespace  string        `json:"namespace,omitempty"`
+	Name       string        `json:"name"`
+	Action     string        `json:"action"` // created, configured, changed, unchanged, pruned, deleted or error
+	Reason     string        `json:"reason,omitempty"`
+	Changes    []fieldChange `json:"changes,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func newObjectResult(obj *unstructured.Unstructured) objectResult {
+	return objectResult{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+// fieldChange is a single differing field between the live and the would-be object
+type fieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// Server-populated fields that change on every write and are noise in a diff
+var ignoredDiffPaths = map[string]bool{
+	"status":                              true,
+	"metadata.managedFields":              true,
+	"metadata.resourceVersion":            true,
+	"metadata.generation":                 true,
+	"metadata.uid":                        true,
+	"metadata.creationTimestamp":          true,
+	"metadata.selfLink":                   true,
+	"metadata.deletionTimestamp":          true,
+	"metadata.deletionGracePeriodSeconds": true,
+}
+
+// diffObjects appends every leaf that differs between old and new. Lists are compared whole.
+func diffObjects(path string, old, new interface{}, changes *[]fieldChange) {
+	if ignoredDiffPaths[path] {
+		return
+	}
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make(map[string]bool, len(oldMap)+len(newMap))
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			diffObjects(child, oldMap[k], newMap[k], changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, fieldChange{Path: path, Old: old, New: new})
+	}
+}
+
+// maskChanges hides Secret values and sensitive ConfigMap values in a diff
+func maskChanges(res apiResource, changes []fieldChange) {
+	for i, ch := range changes {
+		field, key, _ := strings.Cut(ch.Path, ".")
+		sensitive := false
+		switch {
+		case isSecret(res):
+			sensitive = field == "data" || field == "stringData"
+		case isConfigMap(res):
+			sensitive = (field == "data" || field == "binaryData") && (key == "" || isSensitiveKey(key))
+		}
+		if ch.Path == "metadata.annotations."+lastAppliedAnnotation && (isSecret(res) || isConfigMap(res)) {
+			sensitive = true
+		}
+		if !sensitive {
+			continue
+		}
+		if ch.Old != nil {
+			changes[i].Old = maskedValue
+		}
+		if ch.New != nil {
+			changes[i].New = maskedValue
+		}
+	}
+}
+
+// applyOptions controls how manifest objects are applied
+type applyOptions struct {
+	verb         string // apply or delete
+	fieldManager string
+	force        bool // take ownership of fields managed by someone else
+	dryRun       bool
+}
+
+func objectClient(dyn dynamic.Interface, res apiResource, obj *unstructured.Unstructured) dynamic.ResourceInterface {
+	if res.Namespaced {
+		return dyn.Resource(res.gvr()).Namespace(obj.GetNamespace())
+	}
+	return dyn.Resource(res.gvr())
+}
+
+func failResult(result objectResult, err error) objectResult {
+	result.Action = "error"
+	result.Error = err.Error()
+	result.Reason = string(apierrors.ReasonForError(err))
+	return result
+}
+
+// dryRunObject previews one object with server-side dry run and diffs it against live state
+func dryRunObject(ctx context.Context, dyn dynamic.Interface, res apiResource, obj *unstructured.Unstructured, opts applyOptions) objectResult {
+	result := newObjectResult(obj)
+	client := objectClient(dyn, res, obj)
+
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return failResult(result, err)
+	}
+
+	if opts.verb == "delete" {
+		if !exists {
+			result.Action = "unchanged"
+			result.Reason = string(metav1.StatusReasonNotFound)
+			return result
+		}
+		if err := client.Delete(ctx, obj.GetName(), metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}); err != nil {
+			return failResult(result, err)
+		}
+		result.Action = "pruned"
+		return result
+	}
+
+	dry, err := client.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: opts.fieldManager,
+		Force:        opts.force,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		return failResult(result, err)
+	}
+
+	if !exists {
+		result.Action = "created"
+		return result
+	}
+	diffObjects("", live.Object, dry.Object, &result.Changes)
+	maskChanges(res, result.Changes)
+	if len(result.Changes) == 0 {
+		result.Action = "unchanged"
+	} else {
+		result.Action = "changed"
+	}
+	return result
+}
+
+// applyObject server-side applies (or deletes) one object and reports what happened to it
+func applyObject(ctx context.Context, dyn dynamic.Interface, res apiResource, obj *unstructured.Unstructured, opts applyOptions) objectResult {
+	result := newObjectResult(obj)
+	client := objectClient(dyn, res, obj)
+
+	if opts.verb == "delete" {
+		policy := metav1.DeletePropagationBackground
+		err := client.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &policy})
+		switch {
+		case apierrors.IsNotFound(err):
+			result.Action = "unchanged"
+			result.Reason = string(metav1.StatusReasonNotFound)
+		case err != nil:
+			return failResult(result, err)
+		default:
+			result.Action = "deleted"
+		}
+		return result
+	}
+
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return failResult(result, err)
+	}
+
+	applied, err := client.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: opts.fieldManager,
+		Force:        opts.force,
+	})
+	if err != nil {
+		result = failResult(result, err)
+		if apierrors.IsConflict(err) && !opts.force {
+			result.Error += " (retry with force to take ownership of the conflicting fields)"
+		}
+		return result
+	}
+
+	switch {
+	case !exists:
+		result.Action = "created"
+	case applied.GetResourceVersion() == live.GetResourceVersion():
+		result.Action = "unchanged"
+	default:
+		result.Action = "configured"
+	}
+	return result
+}
+
+// prepareObjects resolves each object's resource and defaults the namespace of namespaced objects.
+// Objects that cannot be mapped get an error result at their index instead.
+func prepareObjects(resources []apiResource, objects []*unstructured.Unstructured, defaultNamespace string) ([]apiResource, []*objectResult) {
+	mapped := make([]apiResource, len(objects))
+	failures := make([]*objectResult, len(objects))
+	for i, obj := range objects {
+		res, err := resourceForObject(resources, obj)
+		if err != nil {
+			failure := newObjectResult(obj)
+			failure.Action = "error"
+			failure.Error = err.Error()
+			failure.Reason = "UnknownKind"
+			failures[i] = &failure
+			continue
+		}
+		if res.Namespaced && obj.GetNamespace() == "" {
+			obj.SetNamespace(defaultNamespace)
+		}
+		if !res.Namespaced {
+			obj.SetNamespace("")
+		}
+		mapped[i] = res
+	}
+	return mapped, failures
+}
+
+// mapObjects runs prepareObjects on the cached discovery of a context. A kind missing from the
+// cache may come from a CRD applied since it was filled, so the cache is then refreshed once.
+func mapObjects(contextName string, disco discovery.DiscoveryInterface, objects []*unstructured.Unstructured, defaultNamespace string) ([]apiResource, []*objectResult, error) {
+	resources, err := cachedResources(contextName, disco)
+	if err != nil {
+		return nil, nil, err
+	}
+	mapped, failures := prepareObjects(resources, objects, defaultNamespace)
+	unknown := slices.ContainsFunc(failures, func(f *objectResult) bool { return f != nil && f.Reason == "UnknownKind" })
+	if !unknown {
+		return mapped, failures, nil
+	}
+	if resources, err = refreshResources(contextName, disco); err != nil {
+		return nil, nil, err
+	}
+	mapped, failures = prepareObjects(resources, objects, defaultNamespace)
+	return mapped, failures, nil
+}
+
+// applyVerb is the API verb server-side apply and delete are authorized as
+func applyVerb(verb string) string {
+	if verb == "delete" {
+		return "delete"
+	}
+	return "patch"
+}
+
+// checkObjectAccess records a Forbidden failure for every object the identity may not apply or delete.
+// Applying an object that does not exist yet creates it, which also needs create.
+func checkObjectAccess(ctx context.Context, clientset kubernetes.Interface, dyn dynamic.Interface, objects []*unstructured.Unstructured, mapped []apiResource, failures []*objectResult, verb string) {
+	for i, obj := range objects {
+		if failures[i] != nil {
+			continue
+		}
+		checks := []authorizationv1.ResourceAttributes{{
+			Verb:      applyVerb(verb),
+			Group:     mapped[i].Group,
+			Resource:  mapped[i].Name,
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		}}
+		if verb != "delete" {
+			_, err := objectClient(dyn, mapped[i], obj).Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				checks = append(checks, authorizationv1.ResourceAttributes{
+					Verb:      "create",
+					Group:     mapped[i].Group,
+					Resource:  mapped[i].Name,
+					Namespace: obj.GetNamespace(),
+				})
+			}
+		}
+		if err := checkAccess(ctx, clientset, checks...); err != nil {
+			failure := newObjectResult(obj)
+			failure.Action = "error"
+			failure.Error = err.Error()
+			failure.Reason = string(metav1.StatusReasonForbidden)
+			failures[i] = &failure
+		}
+	}
+}
+
+// checkObjectPolicy marks objects in namespaces the authorization policy does not grant as failed
+func checkObjectPolicy(c *gin.Context, ctxName string, objects []*unstructured.Unstructured, failures []*objectResult, verb string) {
+	capability := applyCapability(policyBody{Verb: verb})
+	for i, obj := range objects {
+		if failures[i] != nil {
+			continue
+		}
+		if err := checkPolicy(c, capability, ctxName, obj.GetNamespace()); err != nil {
+			failure := newObjectResult(obj)
+			failure.Action = "error"
+			failure.Error = err.Error()
+			failure.Reason = string(metav1.StatusReasonForbidden)
+			failures[i] = &failure
+		}
+	}
+}
+
+// applyAuditEvent records the objects an apply or delete touched and how each one went
+func applyAuditEvent(verb, contextName, namespace, manifest string, results []objectResult, summary map[string]int) auditEvent {
+	event := auditEvent{
+		Verb:           verb,
+		Context:        contextName,
+		Namespace:      namespace,
+		ManifestSHA256: manifestHash(manifest),
+		Result:         auditSuccess,
+	}
+	var errs []string
+	for _, r := range results {
+		event.Objects = append(event.Objects, auditObject{APIVersion: r.APIVersion, Kind: r.Kind, Namespace: r.Namespace, Name: r.Name, Result: r.Action})
+		if r.Error != "" {
+			errs = append(errs, r.Name+": "+r.Error)
+		}
+	}
+	switch summary["error"] {
+	case 0:
+	case len(results):
+		event.Result = auditFailure
+	default:
+		event.Result = auditPartial
+	}
+	event.Error = strings.Join(errs, "; ")
+	return event
+}
+
+func summarizeResults(results []objectResult) map[string]int {
+	summary := map[string]int{}
+	for _, r := range results {
+		summary[r.Action]++
+	}
+	return summary
+}
+
+// formatResults renders results the way kubectl prints them, one "kind/name action" line per object
+func formatResults(results []objectResult, dryRun bool) string {
+	var b strings.Builder
+	for _, r := range results {
+		ref := strings.ToLower(r.Kind) + "/" + r.Name
+		if r.Namespace != "" {
+			ref = r.Namespace + "/" + ref
+		}
+		switch {
+		case r.Action == "error":
+			fmt.Fprintf(&b, "%s error: %s\n", ref, r.Error)
+		case dryRun:
+			fmt.Fprintf(&b, "%s %s (server dry run)\n", ref, r.Action)
+		default:
+			fmt.Fprintf(&b, "%s %s\n", ref, r.Action)
+		}
+	}
+	return b.String()
+}
+
+const maxYAMLBytes = 2 * 1024 * 1024 // 2 MB cap
+
+// Default field manager for server-side apply, overridable per request
+var defaultFieldManager = func() string {
+	if fm := strings.TrimSpace(os.Getenv("STERN_UI_FIELD_MANAGER")); fm != "" {
+		return fm
+	}
+	return applyFieldManager
+}()
+
+// applyManifest server-side applies or deletes a YAML manifest against a context,
+// or previews the change with server-side dry run when dryRun is set
+func applyManifest(c *gin.Context) {
+	ctxName := c.Query("context")
+
+	var req struct {
+		Verb         string `json:"verb"`
+		YAML         string `json:"yaml"`
+		DryRun       bool   `json:"dryRun"`
+		FieldManager string `json:"fieldManager"`
+		Force        bool   `json:"force"`
+		Namespace    string `json:"namespace"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+
+	verb := strings.TrimSpace(req.Verb)
+	if verb == "" {
+		verb = "apply"
+	}
+	if verb != "apply" && verb != "delete" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "verb must be 'apply' or 'delete'"})
+		return
+	}
+
+	if len(req.YAML) > maxYAMLBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("yaml too large: %d bytes (max %d)", len(req.YAML), maxYAMLBytes)})
+		return
+	}
+
+	if strings.TrimSpace(req.YAML) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "yaml is empty"})
+		return
+	}
+	objects, err := decodeManifest(req.YAML)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid manifest: " + err.Error()})
+		return
+	}
+
+	opts := applyOptions{
+		verb:         verb,
+		fieldManager: strings.TrimSpace(req.FieldManager),
+		force:        req.Force,
+		dryRun:       req.DryRun,
+	}
+	if opts.fieldManager == "" {
+		opts.fieldManager = defaultFieldManager
+	}
+
+	restConfig, kubeConfig, err := createRestConfig(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create dynamic client: " + err.Error()})
+		return
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create discovery client: " + err.Error()})
+		return
+	}
+
+	namespace := strings.TrimSpace(req.Namespace)
+	if namespace == "" {
+		namespace, _, _ = kubeConfig.Namespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+	mapped, failures, err := mapObjects(ctxName, disco, objects, namespace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The policy goes first, so objects it refuses never reach the cluster. Then pre-flight each
+	// object so a forbidden object names the missing permission and is skipped.
+	checkObjectPolicy(c, ctxName, objects, failures, verb)
+	if clientset, err := kubernetes.NewForConfig(restConfig); err == nil {
+		checkObjectAccess(c.Request.Context(), clientset, dyn, objects, mapped, failures, verb)
+	}
+
+	results := make([]objectResult, 0, len(objects))
+	for i, obj := range objects {
+		switch {
+		case failures[i] != nil:
+			results = append(results, *failures[i])
+		case opts.dryRun:
+			// Preview with server-side dry run and a per-object diff against live state
+			results = append(results, dryRunObject(c.Request.Context(), dyn, mapped[i], obj, opts))
+		default:
+			results = append(results, applyObject(c.Request.Context(), dyn, mapped[i], obj, opts))
+		}
+	}
+
+	summary := summarizeResults(results)
+	status := http.StatusOK
+	if summary["error"] > 0 {
+		status = http.StatusMultiStatus
+	}
+	if !opts.dryRun {
+		recordAudit(c, applyAuditEvent(verb, currentContextName(ctxName), namespace, req.YAML, results, summary))
+	}
+	c.JSON(status, gin.H{
+		"dryRun":  opts.dryRun,
+		"verb":    verb,
+		"objects": results,
+		"summary": summary,
+		"output":  formatResults(results, opts.dryRun),
+	})
+}
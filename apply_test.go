@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestDecodeManifest verifies multi-document decoding and validation
+func TestDecodeManifest(t *testing.T) {
+	objects, err := decodeManifest(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: b
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: c
+    namespace: prod
+`)
+	require.NoError(t, err)
+	require.Len(t, objects, 3)
+	assert.Equal(t, "ConfigMap", objects[0].GetKind())
+	assert.Equal(t, "Service", objects[1].GetKind())
+	assert.Equal(t, "prod", objects[2].GetNamespace())
+
+	_, err = decodeManifest("kind: ConfigMap\nmetadata:\n  name: a\n")
+	assert.ErrorContains(t, err, "apiVersion and kind are required")
+
+	_, err = decodeManifest("apiVersion: v1\nkind: ConfigMap\n")
+	assert.ErrorContains(t, err, "metadata.name is required")
+
+	_, err = decodeManifest("---\n")
+	assert.Error(t, err)
+}
+
+// TestDiffObjects verifies leaf diffs and that server-managed fields are ignored
+func TestDiffObjects(t *testing.T) {
+	live := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "1", "labels": map[string]interface{}{"app": "web"}},
+		"spec":     map[string]interface{}{"replicas": int64(2), "ports": []interface{}{int64(80)}},
+		"status":   map[string]interface{}{"ready": int64(2)},
+	}
+	dry := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "2", "labels": map[string]interface{}{"app": "web", "tier": "fe"}},
+		"spec":     map[string]interface{}{"replicas": int64(3), "ports": []interface{}{int64(80)}},
+		"status":   map[string]interface{}{"ready": int64(0)},
+	}
+
+	var changes []fieldChange
+	diffObjects("", live, dry, &changes)
+
+	assert.Equal(t, []fieldChange{
+		{Path: "metadata.labels.tier", New: "fe"},
+		{Path: "spec.replicas", Old: int64(2), New: int64(3)},
+	}, changes)
+}
+
+// TestMaskChanges verifies Secret values never appear in a diff
+func TestMaskChanges(t *testing.T) {
+	changes := []fieldChange{
+		{Path: "data.password", Old: "b2xk", New: "bmV3"},
+		{Path: "metadata.labels.app", Old: "a", New: "b"},
+	}
+	maskChanges(apiResource{Name: "secrets"}, changes)
+	assert.Equal(t, maskedValue, changes[0].Old)
+	assert.Equal(t, maskedValue, changes[0].New)
+	assert.Equal(t, "b", changes[1].New)
+}
+
+// TestDryRunObject verifies created/changed/unchanged/pruned classification
+func TestDryRunObject(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "prod"},
+		"data":       map[string]interface{}{"LOG_LEVEL": "info"},
+	}}
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+
+	// The fake tracker does not implement server-side apply; echo the applied object back
+	dyn.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		assert.Equal(t, []string{"All"}, patch.PatchOptions.DryRun)
+		return true, obj, nil
+	})
+
+	res := apiResource{Name: "configmaps", Kind: "ConfigMap", Version: "v1", Namespaced: true}
+	desired := func(name, level string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "prod"},
+			"data":       map[string]interface{}{"LOG_LEVEL": level},
+		}}
+	}
+	ctx := context.Background()
+	apply := applyOptions{verb: "apply", fieldManager: applyFieldManager}
+	del := applyOptions{verb: "delete", fieldManager: applyFieldManager}
+
+	assert.Equal(t, "unchanged", dryRunObject(ctx, dyn, res, desired("settings", "info"), apply).Action)
+
+	changed := dryRunObject(ctx, dyn, res, desired("settings", "debug"), apply)
+	assert.Equal(t, "changed", changed.Action)
+	assert.Equal(t, []fieldChange{{Path: "data.LOG_LEVEL", Old: "info", New: "debug"}}, changed.Changes)
+
+	assert.Equal(t, "created", dryRunObject(ctx, dyn, res, desired("new", "info"), apply).Action)
+	assert.Equal(t, "pruned", dryRunObject(ctx, dyn, res, desired("settings", "info"), del).Action)
+
+	missing := dryRunObject(ctx, dyn, res, desired("missing", "info"), del)
+	assert.Equal(t, "unchanged", missing.Action)
+	assert.Equal(t, "NotFound", missing.Reason)
+}
+
+// TestApplyObject verifies apply results and that the field manager and force flag are sent
+func TestApplyObject(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "prod", "resourceVersion": "7"},
+	}}
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+
+	var gotManager string
+	var gotForce bool
+	dyn.PrependReactor("patch", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		gotManager = patch.PatchOptions.FieldManager
+		gotForce = patch.PatchOptions.Force != nil && *patch.PatchOptions.Force
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		if patch.GetName() == "conflict" {
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "conflict", errors.New("field owned by helm"))
+		}
+		rv := "8"
+		if _, ok := obj.Object["data"]; !ok {
+			rv = "7" // nothing changed
+		}
+		obj.SetResourceVersion(rv)
+		return true, obj, nil
+	})
+
+	res := apiResource{Name: "configmaps", Kind: "ConfigMap", Version: "v1", Namespaced: true}
+	object := func(name string, data map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "prod"},
+		}}
+		if data != nil {
+			obj.Object["data"] = data
+		}
+		return obj
+	}
+	ctx := context.Background()
+	opts := applyOptions{verb: "apply", fieldManager: "ci-bot", force: true}
+
+	configured := applyObject(ctx, dyn, res, object("settings", map[string]interface{}{"a": "b"}), opts)
+	assert.Equal(t, "configured", configured.Action)
+	assert.Equal(t, "ci-bot", gotManager)
+	assert.True(t, gotForce)
+
+	assert.Equal(t, "unchanged", applyObject(ctx, dyn, res, object("settings", nil), opts).Action)
+	assert.Equal(t, "created", applyObject(ctx, dyn, res, object("fresh", nil), opts).Action)
+
+	conflict := applyObject(ctx, dyn, res, object("conflict", nil), applyOptions{verb: "apply", fieldManager: "ci-bot"})
+	assert.Equal(t, "error", conflict.Action)
+	assert.Equal(t, "Conflict", conflict.Reason)
+	assert.Contains(t, conflict.Error, "retry with force")
+
+	assert.Equal(t, "deleted", applyObject(ctx, dyn, res, object("settings", nil), applyOptions{verb: "delete"}).Action)
+	assert.Equal(t, "unchanged", applyObject(ctx, dyn, res, object("settings", nil), applyOptions{verb: "delete"}).Action)
+}
+
+// TestCheckObjectAccess verifies applying a new object also needs create
+func TestCheckObjectAccess(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "prod"},
+	}}
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), live)
+	clientset := fakeAccessClient(func(attrs authorizationv1.ResourceAttributes) bool {
+		return attrs.Verb == "patch"
+	})
+	object := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "prod"},
+		}}
+	}
+	res := apiResource{Name: "configmaps", Kind: "ConfigMap", Version: "v1", Namespaced: true}
+	objects := []*unstructured.Unstructured{object("settings"), object("fresh")}
+	mapped := []apiResource{res, res}
+
+	failures := make([]*objectResult, 2)
+	checkObjectAccess(context.Background(), clientset, dyn, objects, mapped, failures, "apply")
+	assert.Nil(t, failures[0], "patching an existing object needs only patch")
+	require.NotNil(t, failures[1])
+	assert.Equal(t, "Forbidden", failures[1].Reason)
+	assert.Contains(t, failures[1].Error, `create configmaps in namespace "prod"`)
+
+	failures = make([]*objectResult, 2)
+	checkObjectAccess(context.Background(), clientset, dyn, objects, mapped, failures, "delete")
+	assert.NotNil(t, failures[0])
+	assert.Contains(t, failures[0].Error, "delete configmaps settings")
+}
+
+// TestPrepareObjects verifies namespace defaulting and unknown kinds
+func TestPrepareObjects(t *testing.T) {
+	resources := []apiResource{
+		{Name: "configmaps", Kind: "ConfigMap", Version: "v1", Namespaced: true},
+		{Name: "clusterroles", Kind: "ClusterRole", Group: "rbac.authorization.k8s.io", Version: "v1"},
+	}
+	objects, err := decodeManifest(`
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata: {name: b, namespace: ignored}
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata: {name: c}
+`)
+	require.NoError(t, err)
+
+	mapped, failures := prepareObjects(resources, objects, "team-a")
+
+	assert.Equal(t, "team-a", objects[0].GetNamespace())
+	assert.Equal(t, "", objects[1].GetNamespace())
+	assert.Equal(t, "clusterroles", mapped[1].Name)
+	assert.Nil(t, failures[0])
+	require.NotNil(t, failures[2])
+	assert.Equal(t, "UnknownKind", failures[2].Reason)
+
+	out := formatResults([]objectResult{
+		{Kind: "ConfigMap", Namespace: "team-a", Name: "a", Action: "created"},
+		*failures[2],
+	}, false)
+	assert.Equal(t, "team-a/configmap/a created\nrollout/c error: no resource found for argoproj.io/v1alpha1, Kind=Rollout\n", out)
+}
+
+// TestMapObjectsRefreshesDiscovery verifies a kind created since discovery was cached is found
+func TestMapObjectsRefreshesDiscovery(t *testing.T) {
+	disco := fakeDiscovery()
+	contextName := "crd-" + randomID(4)
+	t.Cleanup(func() {
+		discoveryMu.Lock()
+		delete(discoveryCache, contextName)
+		discoveryMu.Unlock()
+	})
+	_, err := cachedResources(contextName, disco)
+	require.NoError(t, err)
+
+	disco.Resources = append(disco.Resources, &metav1.APIResourceList{
+		GroupVersion: "argoproj.io/v1alpha1",
+		APIResources: []metav1.APIResource{{Name: "rollouts", SingularName: "rollout", Kind: "Rollout", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}}},
+	})
+	objects, err := decodeManifest("apiVersion: argoproj.io/v1alpha1\nkind: Rollout\nmetadata: {name: web}\n")
+	require.NoError(t, err)
+
+	mapped, failures, err := mapObjects(contextName, disco, objects, "shop")
+	require.NoError(t, err)
+	assert.Nil(t, failures[0])
+	assert.Equal(t, "rollouts", mapped[0].Name)
+	assert.Equal(t, "shop", objects[0].GetNamespace())
+}
+
+// TestApplyManifestRejectsInvalidManifest verifies manifests are decoded before touching the cluster
+func TestApplyManifestRejectsInvalidManifest(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/clusters/apply?context=minikube", strings.NewReader(`{"verb":"apply","dryRun":true,"yaml":"kind: Pod\nmetadata:\n  name: x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "apiVersion and kind are required")
+}
+
+// TestApplyManifestPolicyFirst verifies objects the policy refuses are never looked up or reviewed in the cluster
+func TestApplyManifestPolicyFirst(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	useTestCluster(t, server.URL)
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	testPolicyEngine(t, testPolicy)
+	discoveryMu.Lock()
+	discoveryCache["dev"] = discoveryEntry{
+		resources: []apiResource{{ID: "configmaps", Name: "configmaps", Kind: "ConfigMap", Version: "v1", Namespaced: true, Verbs: []string{"get", "patch"}}},
+		fetched:   time.Now(),
+	}
+	discoveryMu.Unlock()
+	t.Cleanup(func() {
+		discoveryMu.Lock()
+		delete(discoveryCache, "dev")
+		discoveryMu.Unlock()
+	})
+	r := setupRouter()
+
+	body := `{"verb":"apply","dryRun":true,"yaml":"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: prod\n"}`
+	req, _ := http.NewRequest("POST", "/api/clusters/apply?context=dev", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `not allowed to use apply in context \"dev\" namespace \"prod\"`)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(t, requests)
+}
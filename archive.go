@@ -0,0 +1,892 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	stern "github.com/stern/stern/stern"
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// File listing the streams the recorder archives; the recorder only runs when it has streams
+var archiveStreamsPath = func() string {
+	if path := os.Getenv("STERN_UI_ARCHIVE_STREAMS"); path != "" {
+		return path
+	}
+	return filepath.Join(dataDir, "archive-streams.yaml")
+}()
+
+// Archived lines older than this are pruned
+var archiveRetention = envDuration("STERN_UI_ARCHIVE_RETENTION", 7*24*time.Hour)
+
+// Total compressed size of the archive; the oldest segments are pruned beyond it
+var archiveMaxSize = envSize("STERN_UI_ARCHIVE_MAX_SIZE", 1<<30)
+
+// A segment is closed once it holds this many uncompressed bytes or has been open this long
+var (
+	archiveSegmentSize     = envSize("STERN_UI_ARCHIVE_SEGMENT_SIZE", 16<<20)
+	archiveSegmentDuration = envDuration("STERN_UI_ARCHIVE_SEGMENT_DURATION", time.Hour)
+)
+
+// How often open segments are flushed to disk and retention is applied
+const (
+	archiveFlushInterval = 5 * time.Second
+	archivePruneInterval = time.Minute
+)
+
+// Maximum lines returned by one archive query; the newest lines are kept
+const archiveQueryLimit = 10000
+
+// Longer messages are truncated when archived, so that even after JSON escaping (at most six
+// bytes per byte) every segment line fits the maxArchiveLine buffer readSegment scans with
+const (
+	maxArchiveMessage = 128 << 10
+	maxArchiveLine    = 1 << 20
+)
+
+var archiveSegmentsBucket = []byte("archive_segments")
+
+// envSize parses a size environment variable such as 512Mi or 2Gi, falling back to def when unset or invalid
+func envSize(name string, def int64) int64 {
+	if v := os.Getenv(name); v != "" {
+		if q, err := resource.ParseQuantity(v); err == nil && q.Value() > 0 {
+			return q.Value()
+		}
+		log.Printf("[WARN] ignoring invalid %s=%q", name, v)
+	}
+	return def
+}
+
+// archiveRecord is one archived log line
+type archiveRecord struct {
+	Time    time.Time `json:"time"`
+	Context string    `json:"context"`
+	logLine
+}
+
+// archiveSegment indexes one compressed segment file. Queries skip segments whose
+// context, time range, namespaces, pods or containers cannot match.
+type archiveSegment struct {
+	ID         string    `json:"id"`
+	Stream     string    `json:"stream"`
+	Context    string    `json:"context"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Lines      int       `json:"lines"`
+	Bytes      int64     `json:"bytes"` // compressed bytes readable so far
+	Closed     bool      `json:"closed"`
+	Namespaces []string  `json:"namespaces"`
+	Pods       []string  `json:"pods"` // namespace/pod
+	Containers []string  `json:"containers"`
+	Indexed    bool      `json:"indexed"` // has full-text postings; older segments are scanned
+
+	key []byte
+}
+
+// countingWriter tracks how many bytes reached the segment file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// segmentWriter appends records to the open segment of a stream
+type segmentWriter struct {
+	meta       archiveSegment
+	opened     time.Time
+	file       *os.File
+	counter    *countingWriter
+	gz         *gzip.Writer
+	raw        int64
+	namespaces map[string]struct{}
+	pods       map[string]struct{}
+	containers map[string]struct{}
+	postings   map[string][]uint32 // terms of lines written since the last sync
+}
+
+func (w *segmentWriter) write(rec archiveRecord) error {
+	rec.Message = truncateMessage(rec.Message, maxArchiveMessage)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := w.gz.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	w.raw += int64(len(data)) + 1
+	for _, term := range messageTerms(rec.Message) {
+		w.postings[term] = append(w.postings[term], uint32(w.meta.Lines))
+	}
+	w.meta.Lines++
+	if w.meta.Start.IsZero() || rec.Time.Before(w.meta.Start) {
+		w.meta.Start = rec.Time
+	}
+	if rec.Time.After(w.meta.End) {
+		w.meta.End = rec.Time
+	}
+	w.namespaces[rec.Namespace] = struct{}{}
+	w.pods[rec.Namespace+"/"+rec.PodName] = struct{}{}
+	w.containers[rec.ContainerName] = struct{}{}
+	return nil
+}
+
+// truncateMessage cuts message to at most limit bytes without splitting a UTF-8 sequence
+func truncateMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut]
+}
+
+// sync flushes compressed data so everything written so far can be read back, updates the
+// index entry and hands over the postings of the lines it made readable
+func (w *segmentWriter) sync() (map[string][]uint32, error) {
+	if err := w.gz.Flush(); err != nil {
+		return nil, err
+	}
+	w.meta.Bytes = w.counter.n
+	w.meta.Namespaces = sortedKeys(w.namespaces)
+	w.meta.Pods = sortedKeys(w.pods)
+	w.meta.Containers = sortedKeys(w.containers)
+	postings := w.postings
+	w.postings = map[string][]uint32{}
+	return postings, nil
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// logArchive stores recorded lines as gzip-compressed JSON-lines segments under dir,
+// indexed in the bbolt store
+type logArchive struct {
+	mu              sync.Mutex
+	db              *bolt.DB
+	dir             string
+	segmentSize     int64
+	segmentDuration time.Duration
+	retention       time.Duration
+	maxSize         int64
+	open            map[string]*segmentWriter // by stream name
+}
+
+// newLogArchive opens the archive in dir. Segments left open by a previous run are
+// marked closed; their data is readable up to the last flush.
+func newLogArchive(db *bolt.DB, dir string) (*logArchive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create archive directory: %w", err)
+	}
+	a := &logArchive{
+		db:              db,
+		dir:             dir,
+		segmentSize:     archiveSegmentSize,
+		segmentDuration: archiveSegmentDuration,
+		retention:       archiveRetention,
+		maxSize:         archiveMaxSize,
+		open:            map[string]*segmentWriter{},
+	}
+	segments, err := a.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segments {
+		if !seg.Closed {
+			seg.Closed = true
+			if err := a.putSegment(seg, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return a, nil
+}
+
+var (
+	logArchiveOnce sync.Once
+	logArchiveInst *logArchive
+	logArchiveErr  error
+)
+
+// openLogArchive opens the shared archive on first use
+func openLogArchive() (*logArchive, error) {
+	logArchiveOnce.Do(func() {
+		db, err := openStore()
+		if err != nil {
+			logArchiveErr = err
+			return
+		}
+		logArchiveInst, logArchiveErr = newLogArchive(db, filepath.Join(dataDir, "archive"))
+	})
+	return logArchiveInst, logArchiveErr
+}
+
+func (a *logArchive) segmentPath(id string) string {
+	return filepath.Join(a.dir, id+".jsonl.gz")
+}
+
+// putSegment stores the index entry of a segment together with new postings for it
+func (a *logArchive) putSegment(seg archiveSegment, postings map[string][]uint32) error {
+	data, err := json.Marshal(seg)
+	if err != nil {
+		return err
+	}
+	return a.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(archiveSegmentsBucket)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(seg.key, data); err != nil {
+			return err
+		}
+		return appendPostings(tx, seg.key, postings)
+	})
+}
+
+// segments lists the index, oldest first
+func (a *logArchive) segments() ([]archiveSegment, error) {
+	var segments []archiveSegment
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(archiveSegmentsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var seg archiveSegment
+			if err := json.Unmarshal(v, &seg); err != nil {
+				return fmt.Errorf("corrupt archive index entry at %s: %w", keyTime(k[:8]), err)
+			}
+			seg.key = append([]byte(nil), k...)
+			segments = append(segments, seg)
+			return nil
+		})
+	})
+	return segments, err
+}
+
+// append writes a record to the open segment of a stream, rotating it by size and age
+func (a *logArchive) append(stream, contextName string, rec archiveRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	w := a.open[stream]
+	if w != nil && (w.raw >= a.segmentSize || now.Sub(w.opened) >= a.segmentDuration) {
+		if err := a.closeSegment(w); err != nil {
+			return err
+		}
+		w = nil
+	}
+	if w == nil {
+		var err error
+		if w, err = a.openSegment(stream, contextName, now); err != nil {
+			return err
+		}
+	}
+	return w.write(rec)
+}
+
+// openSegment creates a segment file and its index entry; callers hold a.mu
+func (a *logArchive) openSegment(stream, contextName string, now time.Time) (*segmentWriter, error) {
+	id := now.UTC().Format("20060102T150405") + "-" + randomID(4)
+	file, err := os.OpenFile(a.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingWriter{w: file}
+	w := &segmentWriter{
+		meta:       archiveSegment{ID: id, Stream: stream, Context: contextName, Indexed: true, key: append(timeKey(now), id...)},
+		opened:     now,
+		file:       file,
+		counter:    counter,
+		gz:         gzip.NewWriter(counter),
+		namespaces: map[string]struct{}{},
+		pods:       map[string]struct{}{},
+		containers: map[string]struct{}{},
+		postings:   map[string][]uint32{},
+	}
+	a.open[stream] = w
+	return w, nil
+}
+
+// closeSegment finishes the gzip stream and marks the segment closed; callers hold a.mu
+func (a *logArchive) closeSegment(w *segmentWriter) error {
+	delete(a.open, w.meta.Stream)
+	postings, err := w.sync()
+	if closeErr := w.gz.Close(); err == nil {
+		err = closeErr
+	}
+	w.meta.Bytes = w.counter.n
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	w.meta.Closed = true
+	return a.putSegment(w.meta, postings)
+}
+
+// flush makes every open segment readable up to now and records it in the index
+func (a *logArchive) flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, w := range a.open {
+		if w.meta.Lines == 0 {
+			continue
+		}
+		postings, err := w.sync()
+		if err != nil {
+			return err
+		}
+		if err := a.putSegment(w.meta, postings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeStream closes the open segment of a stream, if any
+func (a *logArchive) closeStream(stream string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if w, ok := a.open[stream]; ok {
+		return a.closeSegment(w)
+	}
+	return nil
+}
+
+// prune deletes closed segments past the retention, then the oldest ones beyond the size limit
+func (a *logArchive) prune(now time.Time) error {
+	segments, err := a.segments()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, seg := range segments {
+		total += seg.Bytes
+	}
+	cutoff := now.Add(-a.retention)
+	var expired []archiveSegment
+	for _, seg := range segments {
+		if !seg.Closed {
+			continue
+		}
+		if seg.End.Before(cutoff) || total > a.maxSize {
+			expired = append(expired, seg)
+			total -= seg.Bytes
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	for _, seg := range expired {
+		if err := os.Remove(a.segmentPath(seg.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(archiveSegmentsBucket)
+		terms := tx.Bucket(archiveTermsBucket)
+		for _, seg := range expired {
+			if err := b.Delete(seg.key); err != nil {
+				return err
+			}
+			if terms == nil {
+				continue
+			}
+			if err := terms.DeleteBucket(seg.key); err != nil && !errors.Is(err, bolterrors.ErrBucketNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// lastRecorded returns the newest archived time of a stream
+func (a *logArchive) lastRecorded(stream string) (time.Time, error) {
+	if err := a.flush(); err != nil {
+		return time.Time{}, err
+	}
+	segments, err := a.segments()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, seg := range segments {
+		if seg.Stream == stream && seg.End.After(last) {
+			last = seg.End
+		}
+	}
+	return last, nil
+}
+
+// archiveFilter is a /ws/logs query resolved for archived lines
+type archiveFilter struct {
+	context           string
+	namespaces        []string // "" matches every namespace
+	from, to          time.Time
+	node              string
+	pod               *regexp.Regexp
+	container         *regexp.Regexp
+	excludePods       []*regexp.Regexp
+	excludeContainers []*regexp.Regexp
+	include           []*regexp.Regexp
+	exclude           []*regexp.Regexp
+	tail              int64 // lines per container; -1 keeps all
+}
+
+// newArchiveFilter resolves stream parameters the way prepareSternSession does. Label
+// selectors, workloads and container states need the live pods, so they are rejected.
+func newArchiveFilter(params streamParams, kubeConfig clientcmd.ClientConfig, now time.Time) (*archiveFilter, error) {
+	switch {
+	case params.selector != "":
+		return nil, errors.New("selector is not supported for archived logs")
+	case params.workload != "":
+		return nil, errors.New("workload is not supported for archived logs")
+	case params.containerState != "":
+		return nil, errors.New("containerState is not supported for archived logs")
+	}
+
+	tailLines, sinceDuration, _ := parseNumericParams(params)
+	queryRegex, containerRegex, includeRegexes, excludeRegexes, _, excludeContainerRegexes, excludePodRegexes, err := parseRegexFilters(params)
+	if err != nil {
+		return nil, err
+	}
+	f := &archiveFilter{
+		context:           currentContextName(params.contextName),
+		namespaces:        buildNamespaceList(params, kubeConfig),
+		from:              now.Add(-sinceDuration),
+		to:                now,
+		node:              params.node,
+		pod:               queryRegex,
+		container:         containerRegex,
+		excludePods:       excludePodRegexes,
+		excludeContainers: excludeContainerRegexes,
+		include:           includeRegexes,
+		exclude:           excludeRegexes,
+		tail:              -1,
+	}
+	if tailLines != nil {
+		f.tail = *tailLines
+	}
+	if params.timeRangeMode == "absolute" && params.untilTime != "" {
+		if until, err := time.Parse("2006-01-02T15:04", params.untilTime); err == nil {
+			f.to = until
+		}
+	}
+	return f, nil
+}
+
+func matchesRegexes(regexes []*regexp.Regexp, s string) bool {
+	for _, re := range regexes {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *archiveFilter) namespaceMatches(namespace string) bool {
+	return slices.Contains(f.namespaces, "") || slices.Contains(f.namespaces, namespace)
+}
+
+func (f *archiveFilter) podMatches(namespace, pod string) bool {
+	return f.namespaceMatches(namespace) && f.pod.MatchString(pod) && !matchesRegexes(f.excludePods, pod)
+}
+
+func (f *archiveFilter) containerMatches(container string) bool {
+	return f.container.MatchString(container) && !matchesRegexes(f.excludeContainers, container)
+}
+
+// segmentMatches uses the index to skip segments that cannot contain matching lines
+func (f *archiveFilter) segmentMatches(seg archiveSegment) bool {
+	if seg.Context != f.context || seg.Lines == 0 || seg.End.Before(f.from) || seg.Start.After(f.to) {
+		return false
+	}
+	pod := slices.ContainsFunc(seg.Pods, func(key string) bool {
+		namespace, name, _ := strings.Cut(key, "/")
+		return f.podMatches(namespace, name)
+	})
+	return pod && slices.ContainsFunc(seg.Containers, f.containerMatches)
+}
+
+// matches applies the filters stern applies to live lines
+func (f *archiveFilter) matches(rec archiveRecord) bool {
+	if rec.Time.Before(f.from) || rec.Time.After(f.to) {
+		return false
+	}
+	if f.node != "" && rec.NodeName != f.node {
+		return false
+	}
+	if !f.podMatches(rec.Namespace, rec.PodName) || !f.containerMatches(rec.ContainerName) {
+		return false
+	}
+	if matchesRegexes(f.exclude, rec.Message) {
+		return false
+	}
+	return len(f.include) == 0 || matchesRegexes(f.include, rec.Message)
+}
+
+// readSegment calls fn for every record of a segment, reading only its flushed bytes.
+// When lines is set, only the lines (numbered from 0) it contains are decoded.
+func (a *logArchive) readSegment(seg archiveSegment, lines map[uint32]bool, fn func(archiveRecord)) error {
+	file, err := os.Open(a.segmentPath(seg.ID))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	gz, err := gzip.NewReader(io.LimitReader(file, seg.Bytes))
+	if err != nil {
+		return fmt.Errorf("segment %s: %w", seg.ID, err)
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), maxArchiveLine)
+	for line := uint32(0); scanner.Scan(); line++ {
+		if lines != nil && !lines[line] {
+			continue
+		}
+		var rec archiveRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil {
+			fn(rec)
+		}
+	}
+	// Open segments and segments left open by a crash end without a gzip trailer
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("segment %s: %w", seg.ID, err)
+	}
+	return nil
+}
+
+// query returns the matching lines oldest first, keeping the newest archiveQueryLimit;
+// truncated reports whether older matches were dropped
+func (a *logArchive) query(f *archiveFilter) (lines []archiveRecord, truncated bool, err error) {
+	if err := a.flush(); err != nil {
+		return nil, false, err
+	}
+	segments, err := a.segments()
+	if err != nil {
+		return nil, false, err
+	}
+
+	lines = []archiveRecord{}
+	trim := func() {
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+		if len(lines) > archiveQueryLimit {
+			lines = slices.Delete(lines, 0, len(lines)-archiveQueryLimit)
+			truncated = true
+		}
+	}
+	for _, seg := range segments {
+		if !f.segmentMatches(seg) {
+			continue
+		}
+		err := a.readSegment(seg, nil, func(rec archiveRecord) {
+			if f.matches(rec) {
+				lines = append(lines, rec)
+			}
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(lines) > 2*archiveQueryLimit {
+			trim()
+		}
+	}
+	trim()
+
+	// tail keeps the newest lines of each container, like stern does
+	if f.tail >= 0 {
+		seen := map[string]int64{}
+		kept := make([]archiveRecord, 0, len(lines))
+		for i := len(lines) - 1; i >= 0; i-- {
+			key := lines[i].Namespace + "/" + lines[i].PodName + "/" + lines[i].ContainerName
+			if seen[key] < f.tail {
+				seen[key]++
+				kept = append(kept, lines[i])
+			}
+		}
+		slices.Reverse(kept)
+		lines = kept
+	}
+	return lines, truncated, nil
+}
+
+// archiveStream is a saved /ws/logs query the recorder keeps archiving
+type archiveStream struct {
+	Name     string            `json:"name"`
+	Disabled bool              `json:"disabled,omitempty"`
+	Context  string            `json:"context,omitempty"`
+	Query    map[string]string `json:"query"`
+}
+
+type archiveStreamsFile struct {
+	Streams []*archiveStream `json:"streams"`
+}
+
+// loadArchiveStreams reads the streams file; a missing file means no streams
+func loadArchiveStreams(path string) ([]*archiveStream, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file archiveStreamsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := map[string]bool{}
+	for _, stream := range file.Streams {
+		if strings.TrimSpace(stream.Name) == "" {
+			return nil, fmt.Errorf("%s: every stream needs a name", path)
+		}
+		if names[stream.Name] {
+			return nil, fmt.Errorf("%s: duplicate stream %q", path, stream.Name)
+		}
+		names[stream.Name] = true
+		// The recorder decides tail and since; highlight would store terminal colors
+		for _, key := range []string{"tail", "since", "sinceTime", "untilTime", "timeRangeMode", "noFollow", "highlight", "timestamps"} {
+			delete(stream.Query, key)
+		}
+		stream.Context = currentContextName(stream.Context)
+	}
+	return file.Streams, nil
+}
+
+// archiveStreamState is the runtime state of a recorded stream
+type archiveStreamState struct {
+	mu           sync.Mutex
+	running      bool
+	lines        int64
+	lastRecorded time.Time
+	lastError    string
+}
+
+func (s *archiveStreamState) report(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = err == nil
+	s.lastError = ""
+	if err != nil {
+		s.lastError = err.Error()
+	}
+}
+
+// parseArchivedMessage splits the timestamp stern prefixes to messages when Timestamps is set
+func parseArchivedMessage(message string, now time.Time) (time.Time, string) {
+	if ts, rest, ok := strings.Cut(message, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t, rest
+		}
+	}
+	return now, message
+}
+
+// archiveWriter appends the log lines of a stream to the archive
+type archiveWriter struct {
+	archive *logArchive
+	stream  *archiveStream
+	state   *archiveStreamState
+	after   time.Time // lines at or before this were archived before a restart
+}
+
+func (w *archiveWriter) record(line logLine) {
+	rec := archiveRecord{Context: w.stream.Context, logLine: line}
+	rec.Time, rec.Message = parseArchivedMessage(line.Message, time.Now())
+	if !rec.Time.After(w.after) {
+		return
+	}
+	if err := w.archive.append(w.stream.Name, w.stream.Context, rec); err != nil {
+		log.Printf("[WARN] archive %q: %v", w.stream.Name, err)
+		w.state.report(err)
+		return
+	}
+	w.state.mu.Lock()
+	w.state.lines++
+	w.state.lastRecorded = rec.Time
+	w.state.mu.Unlock()
+}
+
+// recordStream archives a stream until ctx ends. After a restart it asks stern for the
+// lines logged since the last archived one, up to the retention.
+func recordStream(ctx context.Context, archive *logArchive, stream *archiveStream, state *archiveStreamState) {
+	archiver := &archiveWriter{archive: archive, stream: stream, state: state}
+	out := newLineWriter(archiver.record)
+	runHeadlessSession(ctx, fmt.Sprintf("archive %q", stream.Name), stream.Context, stream.Query, out, func(config *stern.Config) {
+		config.Timestamps = true
+		config.TimestampFormat = stern.TimestampFormatDefault
+		config.Follow = true
+		last, err := archive.lastRecorded(stream.Name)
+		if err != nil || last.IsZero() || time.Since(last) > archive.retention {
+			noTail := int64(0)
+			config.TailLines = &noTail
+			config.Since = time.Second
+			return
+		}
+		out.mu.Lock()
+		archiver.after = last
+		out.mu.Unlock()
+		config.TailLines = nil
+		config.Since = time.Since(last) + time.Second
+	}, state.report)
+	if err := archive.closeStream(stream.Name); err != nil {
+		log.Printf("[WARN] archive %q: %v", stream.Name, err)
+	}
+}
+
+// Recorded streams and their state, set once by startLogArchive
+var (
+	archiveStreams      []*archiveStream
+	archiveStreamStates = map[string]*archiveStreamState{}
+)
+
+// startLogArchive starts recording the configured streams and the flush and retention loop
+func startLogArchive() {
+	streams, err := loadArchiveStreams(archiveStreamsPath)
+	if err != nil {
+		log.Printf("[WARN] log archive disabled: %v", err)
+		return
+	}
+	if len(streams) == 0 {
+		return
+	}
+	archive, err := openLogArchive()
+	if err != nil {
+		log.Printf("[WARN] log archive disabled: %v", err)
+		return
+	}
+	archiveStreams = streams
+	for _, stream := range streams {
+		state := &archiveStreamState{}
+		archiveStreamStates[stream.Name] = state
+		if !stream.Disabled {
+			go recordStream(context.Background(), archive, stream, state)
+		}
+	}
+	log.Printf("[INFO] archiving %d log stream(s) from %s to %s", len(streams), archiveStreamsPath, archive.dir)
+
+	go func() {
+		flush := time.NewTicker(archiveFlushInterval)
+		prune := time.NewTicker(archivePruneInterval)
+		for {
+			var err error
+			select {
+			case <-flush.C:
+				err = archive.flush()
+			case now := <-prune.C:
+				err = archive.prune(now)
+			}
+			if err != nil {
+				log.Printf("[WARN] log archive: %v", err)
+			}
+		}
+	}()
+}
+
+// getArchiveStreams returns the recorded streams with their state and the archive's storage usage
+func getArchiveStreams(c *gin.Context) {
+	streams := make([]gin.H, 0, len(archiveStreams))
+	for _, stream := range archiveStreams {
+		state := archiveStreamStates[stream.Name]
+		state.mu.Lock()
+		entry := gin.H{
+			"name":      stream.Name,
+			"context":   stream.Context,
+			"query":     stream.Query,
+			"disabled":  stream.Disabled,
+			"running":   state.running,
+			"lines":     state.lines,
+			"lastError": state.lastError,
+		}
+		if !state.lastRecorded.IsZero() {
+			entry["lastRecorded"] = state.lastRecorded
+		}
+		state.mu.Unlock()
+		streams = append(streams, entry)
+	}
+
+	storage := gin.H{"retention": archiveRetention.String(), "maxSize": archiveMaxSize}
+	if archive, err := openLogArchive(); err == nil {
+		if segments, err := archive.segments(); err == nil {
+			var size int64
+			for _, seg := range segments {
+				size += seg.Bytes
+			}
+			storage["segments"] = len(segments)
+			storage["size"] = size
+			if len(segments) > 0 {
+				storage["oldest"] = segments[0].Start
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"streams": streams, "storage": storage})
+}
+
+// queryArchive returns archived lines matching the /ws/logs parameters of the request
+func queryArchive(c *gin.Context) {
+	params := parseStreamParams(c)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: params.contextName})
+
+	filter, err := newArchiveFilter(params, kubeConfig, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !preflightCollectedLogs(c, filter.context, filter.namespaces) {
+		return
+	}
+	archive, err := openLogArchive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	lines, truncated, err := archive.query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"context":   filter.context,
+		"from":      filter.from,
+		"to":        filter.to,
+		"lines":     lines,
+		"truncated": truncated,
+	})
+}
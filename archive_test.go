@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testArchive(t *testing.T) *logArchive {
+	a, err := newLogArchive(testStore(t), t.TempDir())
+	require.NoError(t, err)
+	return a
+}
+
+func testRecord(at time.Time, contextName, namespace, pod, container, message string) archiveRecord {
+	return archiveRecord{Time: at, Context: contextName, logLine: logLine{Namespace: namespace, PodName: pod, ContainerName: container, Message: message}}
+}
+
+func testArchiveFilter(t *testing.T, query map[string]string) *archiveFilter {
+	f, err := newArchiveFilter(streamParamsFrom(func(key string) string { return query[key] }), nil, time.Now())
+	require.NoError(t, err)
+	return f
+}
+
+// TestLogArchiveQuery verifies rotation, the index and the /ws/logs filters on archived lines
+func TestLogArchiveQuery(t *testing.T) {
+	a := testArchive(t)
+	a.segmentSize = 200
+	now := time.Now()
+	for i, rec := range []archiveRecord{
+		testRecord(now.Add(-3*time.Hour), "prod", "shop", "web-1", "app", "ERROR old"),
+		testRecord(now.Add(-50*time.Minute), "prod", "shop", "web-1", "app", "ERROR db down"),
+		testRecord(now.Add(-40*time.Minute), "prod", "shop", "web-1", "sidecar", "ERROR proxy"),
+		testRecord(now.Add(-30*time.Minute), "prod", "shop", "web-2", "app", "INFO ok"),
+		testRecord(now.Add(-20*time.Minute), "prod", "shop", "web-2", "app", "ERROR timeout"),
+		testRecord(now.Add(-10*time.Minute), "prod", "billing", "api-1", "app", "ERROR billing"),
+	} {
+		stream := "shop"
+		if i == 5 {
+			stream = "billing"
+		}
+		require.NoError(t, a.append(stream, rec.Context, rec))
+	}
+	require.NoError(t, a.append("staging", "staging", testRecord(now, "staging", "shop", "web-1", "app", "ERROR staging")))
+
+	lines, truncated, err := a.query(testArchiveFilter(t, map[string]string{"context": "prod", "namespace": "shop", "since": "1h", "include": "ERROR", "excludeContainer": "sidecar"}))
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "ERROR db down", lines[0].Message)
+	assert.Equal(t, "ERROR timeout", lines[1].Message)
+
+	// tail keeps the newest lines per container; the pod/container form narrows to one container
+	lines, _, err = a.query(testArchiveFilter(t, map[string]string{"context": "prod", "namespace": "shop", "tail": "1"}))
+	require.NoError(t, err)
+	assert.Len(t, lines, 3)
+	lines, _, err = a.query(testArchiveFilter(t, map[string]string{"context": "prod", "allNamespaces": "true", "container": "web-1/app"}))
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "ERROR db down", lines[1].Message)
+
+	segments, err := a.segments()
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 3, "small segment size rotates segments")
+}
+
+// TestLogArchiveRecovery verifies segments left open by a crash stay readable up to the last flush
+func TestLogArchiveRecovery(t *testing.T) {
+	db, dir := testStore(t), t.TempDir()
+	a, err := newLogArchive(db, dir)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, a.append("shop", "prod", testRecord(now, "prod", "shop", "web-1", "app", "flushed")))
+	require.NoError(t, a.flush())
+	require.NoError(t, a.append("shop", "prod", testRecord(now, "prod", "shop", "web-1", "app", "lost")))
+
+	reopened, err := newLogArchive(db, dir)
+	require.NoError(t, err)
+	segments, err := reopened.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.True(t, segments[0].Closed)
+
+	lines, _, err := reopened.query(testArchiveFilter(t, map[string]string{"context": "prod", "allNamespaces": "true"}))
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "flushed", lines[0].Message)
+}
+
+// TestLogArchivePrune verifies time- and size-based retention only removes closed segments
+func TestLogArchivePrune(t *testing.T) {
+	a := testArchive(t)
+	a.segmentSize = 1
+	a.retention = time.Hour
+	now := time.Now()
+	for _, at := range []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Minute), now.Add(-time.Minute), now} {
+		require.NoError(t, a.append("shop", "prod", testRecord(at, "prod", "shop", "web-1", "app", "line")))
+	}
+	require.NoError(t, a.flush())
+
+	require.NoError(t, a.prune(now))
+	segments, err := a.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	_, err = os.Stat(a.segmentPath(segments[0].ID))
+	require.NoError(t, err)
+
+	// Over the size limit the oldest closed segments go; the open one stays
+	a.maxSize = 1
+	require.NoError(t, a.prune(now))
+	segments, err = a.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.False(t, segments[0].Closed)
+	entries, err := os.ReadDir(a.dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestArchiveWriter verifies stern timestamps are split off and lines archived before a restart are skipped
+func TestArchiveWriter(t *testing.T) {
+	a := testArchive(t)
+	stream := &archiveStream{Name: "shop", Context: "prod"}
+	state := &archiveStreamState{}
+	w := newLineWriter((&archiveWriter{archive: a, stream: stream, state: state, after: time.Date(2026, 1, 15, 14, 0, 0, 0, time.UTC)}).record)
+
+	_, _ = w.Write([]byte(`{"namespace":"shop","podName":"web-1","containerName":"app","message":"2026-01-15T13:59:59.000000000Z already archived"}` + "\n"))
+	_, _ = w.Write([]byte(`{"namespace":"shop","podName":"web-1","containerName":"app","message":"2026-01-15T14:00:01.500000000Z new line"}` + "\n"))
+	assert.Equal(t, int64(1), state.lines)
+	assert.Equal(t, time.Date(2026, 1, 15, 14, 0, 1, 5e8, time.UTC), state.lastRecorded.UTC())
+
+	lines, _, err := a.query(testArchiveFilter(t, map[string]string{"context": "prod", "allNamespaces": "true", "timeRangeMode": "absolute", "sinceTime": "2026-01-15T13:00", "untilTime": "2026-01-15T15:00"}))
+	require.NoError(t, err)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "new line", lines[0].Message)
+}
+
+// TestLoadArchiveStreams verifies the streams file is validated and the recorder-owned parameters dropped
+func TestLoadArchiveStreams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "streams.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("streams:\n- name: shop\n  context: prod\n  query: {namespace: shop, tail: \"100\", highlight: x}\n"), 0o600))
+	streams, err := loadArchiveStreams(path)
+	require.NoError(t, err)
+	require.Len(t, streams, 1)
+	assert.Equal(t, map[string]string{"namespace": "shop"}, streams[0].Query)
+
+	require.NoError(t, os.WriteFile(path, []byte("streams:\n- name: shop\n- name: shop\n"), 0o600))
+	_, err = loadArchiveStreams(path)
+	assert.ErrorContains(t, err, "duplicate stream")
+
+	streams, err = loadArchiveStreams(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.NoError(t, err)
+	assert.Empty(t, streams)
+}
+
+// TestQueryArchiveRejectsLiveOnlyFilters verifies filters that need live pods are refused
+func TestQueryArchiveRejectsLiveOnlyFilters(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/api/archive/logs?context=minikube&namespace=shop&selector=app%3Dweb", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "selector is not supported")
+}
+
+// TestLogArchiveLongMessage verifies an oversized message is truncated when archived instead of
+// making its whole segment unreadable
+func TestLogArchiveLongMessage(t *testing.T) {
+	a := testArchive(t)
+	now := time.Now()
+	long := strings.Repeat("\x01", maxArchiveMessage) + "é" + strings.Repeat("x", 2<<20)
+	require.NoError(t, a.append("shop", "prod", testRecord(now.Add(-time.Minute), "prod", "shop", "web-1", "app", long)))
+	require.NoError(t, a.append("shop", "prod", testRecord(now, "prod", "shop", "web-1", "app", "after")))
+
+	lines, _, err := a.query(testArchiveFilter(t, map[string]string{"context": "prod", "namespace": "shop"}))
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Len(t, lines[0].Message, maxArchiveMessage)
+	assert.Equal(t, "after", lines[1].Message)
+	assert.Equal(t, "ab", truncateMessage("abé", 3), "a multi-byte character is not split")
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit results
+const (
+	auditSuccess = "success"
+	auditFailure = "failure"
+	auditPartial = "partial" // some objects of an apply failed
+	auditDenied  = "denied"
+	auditStarted = "started" // long-running sessions (exec) also record how they ended
+)
+
+// Events waiting for the webhook; beyond it events are only written to the file
+const auditWebhookQueue = 256
+
+// auditObject is a Kubernetes object an audited operation touched
+type auditObject struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Result     string `json:"result,omitempty"`
+}
+
+// auditEvent is one line of the audit log
+type auditEvent struct {
+	Time           time.Time         `json:"time"`
+	User           string            `json:"user"`
+	Client         string            `json:"client"`
+	Verb           string            `json:"verb"`
+	Context        string            `json:"context,omitempty"`
+	Namespace      string            `json:"namespace,omitempty"`
+	Objects        []auditObject     `json:"objects,omitempty"`
+	ManifestSHA256 string            `json:"manifestSha256,omitempty"`
+	Result         string            `json:"result"`
+	Error          string            `json:"error,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+}
+
+// target describes the objects of an event for the [AUDIT] log line
+func (e *auditEvent) target() string {
+	refs := make([]string, 0, len(e.Objects))
+	for _, obj := range e.Objects {
+		ref := strings.ToLower(obj.Kind) + "/" + obj.Name
+		if obj.Namespace != "" {
+			ref = obj.Namespace + "/" + ref
+		}
+		refs = append(refs, ref)
+	}
+	return strings.Join(refs, ",")
+}
+
+// auditTrail appends events to a JSON lines file, rotated to <file>.1 at maxSize, and
+// forwards them to an optional webhook
+type auditTrail struct {
+	path    string
+	maxSize int64
+	webhook string
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	queue   chan []byte
+	started sync.Once
+}
+
+var auditLog = &auditTrail{
+	path:    envString("STERN_UI_AUDIT_LOG", filepath.Join(dataDir, "audit.jsonl")),
+	maxSize: envSize("STERN_UI_AUDIT_MAX_SIZE", 64<<20),
+	webhook: os.Getenv("STERN_UI_AUDIT_WEBHOOK"),
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// open opens the log file for appending; callers hold t.mu
+func (t *auditTrail) open() error {
+	if t.file != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	t.file, t.size = file, info.Size()
+	return nil
+}
+
+// rotate moves a full log aside, replacing the previous one; callers hold t.mu
+func (t *auditTrail) rotate() error {
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+	t.file = nil
+	if err := os.Rename(t.path, t.path+".1"); err != nil {
+		return err
+	}
+	return t.open()
+}
+
+func (t *auditTrail) write(line []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.open(); err != nil {
+		return err
+	}
+	if t.size > 0 && t.size+int64(len(line)) > t.maxSize {
+		if err := t.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := t.file.Write(line)
+	t.size += int64(n)
+	return err
+}
+
+// send queues an event for the webhook without blocking the request that caused it
+func (t *auditTrail) send(line []byte) {
+	if t.webhook == "" {
+		return
+	}
+	t.started.Do(func() {
+		t.queue = make(chan []byte, auditWebhookQueue)
+		go t.deliver()
+	})
+	select {
+	case t.queue <- line:
+	default:
+		log.Printf("[WARN] audit webhook queue full, event only written to %s", t.path)
+	}
+}
+
+func (t *auditTrail) deliver() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for line := range t.queue {
+		resp, err := client.Post(t.webhook, "application/json", bytes.NewReader(line))
+		if err != nil {
+			log.Printf("[WARN] audit webhook: %v", err)
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("[WARN] audit webhook: %s", resp.Status)
+		}
+	}
+}
+
+// record writes an event; failing to persist it is logged, not returned, so an unwritable
+// audit log does not undo an operation that already happened
+func (t *auditTrail) record(event auditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[ERROR] audit event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	if err := t.write(line); err != nil {
+		log.Printf("[ERROR] audit log %s: %v", t.path, err)
+	}
+	t.send(line)
+}
+
+// recordAudit completes an event with the caller and time, logs an [AUDIT] line and writes it
+func recordAudit(c *gin.Context, event auditEvent) {
+	event.Time = time.Now().UTC()
+	event.User = policySubject(currentUser(c)).Name
+	event.Client = c.ClientIP()
+	if event.Result == "" {
+		event.Result = auditSuccess
+	}
+	msg := fmt.Sprintf("[AUDIT] %s", event.Verb)
+	if target := event.target(); target != "" {
+		msg += " " + target
+	}
+	msg += fmt.Sprintf(" user=%s context=%s client=%s result=%s", event.User, event.Context, event.Client, event.Result)
+	if event.Error != "" {
+		msg += fmt.Sprintf(" error=%q", event.Error)
+	}
+	log.Print(msg)
+	auditLog.record(event)
+}
+
+// manifestHash identifies an applied manifest without storing it
+func manifestHash(manifest string) string {
+	sum := sha256.Sum256([]byte(manifest))
+	return hex.EncodeToString(sum[:])
+}
+
+// auditFilter selects events for GET /api/audit
+type auditFilter struct {
+	user, verb, context, namespace, result string
+	from, to                               time.Time
+}
+
+func (f *auditFilter) matches(e *auditEvent) bool {
+	switch {
+	case f.user != "" && e.User != f.user,
+		f.verb != "" && e.Verb != f.verb,
+		f.context != "" && e.Context != f.context,
+		f.result != "" && e.Result != f.result,
+		!f.from.IsZero() && e.Time.Before(f.from),
+		!f.to.IsZero() && e.Time.After(f.to):
+		return false
+	}
+	if f.namespace == "" || e.Namespace == f.namespace {
+		return true
+	}
+	return slices.ContainsFunc(e.Objects, func(obj auditObject) bool { return obj.Namespace == f.namespace })
+}
+
+// newAuditFilter reads user, verb, context, namespace and result, and the time range from
+// since (a duration) or from/to (RFC 3339)
+func newAuditFilter(c *gin.Context, now time.Time) (*auditFilter, error) {
+	f := &auditFilter{
+		user:      c.Query("user"),
+		verb:      c.Query("verb"),
+		context:   c.Query("context"),
+		namespace: c.Query("namespace"),
+		result:    c.Query("result"),
+	}
+	if since := c.Query("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %w", err)
+		}
+		f.from = now.Add(-d)
+	}
+	for key, t := range map[string]*time.Time{"from": &f.from, "to": &f.to} {
+		if raw := c.Query(key); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*t = parsed
+		}
+	}
+	return f, nil
+}
+
+// openLogs opens the rotated and current log, each limited to the bytes written so far. Only
+// this takes the lock, so reading the logs does not hold up writers; an open file keeps its
+// contents when a later rotation renames or replaces it.
+func (t *auditTrail) openLogs() ([]io.Reader, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var files []*os.File
+	var readers []io.Reader
+	closeAll := func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}
+	for _, name := range []string{t.path + ".1", t.path} {
+		file, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, file)
+		info, err := file.Stat()
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		readers = append(readers, io.LimitReader(file, info.Size()))
+	}
+	return readers, closeAll, nil
+}
+
+// events returns the events of the rotated and current log matching filter, newest first
+func (t *auditTrail) events(filter *auditFilter) ([]auditEvent, error) {
+	readers, closeAll, err := t.openLogs()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll()
+
+	events := []auditEvent{}
+	for _, r := range readers {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 4<<20)
+		for scanner.Scan() {
+			var event auditEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				continue // a line cut short by a crash
+			}
+			if filter.matches(&event) {
+				events = append(events, event)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	slices.Reverse(events)
+	return events, nil
+}
+
+// getAuditEvents lists audit events, newest first, filtered and paginated
+func getAuditEvents(c *gin.Context) {
+	filter, err := newAuditFilter(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := auditLog.events(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, end, pagination := paginate(c, len(events))
+	c.JSON(http.StatusOK, gin.H{
+		"events":     events[start:end],
+		"pagination": pagination,
+	})
+}
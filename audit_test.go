@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditTrailRotation verifies the log rotates at its size limit and is read newest first across both files
+func TestAuditTrailRotation(t *testing.T) {
+	trail := &auditTrail{path: filepath.Join(t.TempDir(), "audit.jsonl"), maxSize: 300}
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		trail.record(auditEvent{Time: start.Add(time.Duration(i) * time.Minute), User: "alice", Verb: "apply", Result: auditSuccess, Context: "dev"})
+	}
+	_, err := os.Stat(trail.path + ".1")
+	require.NoError(t, err, "rotated file")
+
+	events, err := trail.events(&auditFilter{})
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.Equal(t, start.Add(4*time.Minute), events[0].Time, "newest first")
+	for i := 1; i < len(events); i++ {
+		assert.True(t, events[i].Time.Before(events[i-1].Time))
+	}
+}
+
+// TestAuditTrailOpenLogs verifies reads see the logs as they were when opened while writers carry on, rotation included
+func TestAuditTrailOpenLogs(t *testing.T) {
+	trail := &auditTrail{path: filepath.Join(t.TempDir(), "audit.jsonl"), maxSize: 300}
+	trail.record(auditEvent{User: "alice", Verb: "apply", Result: auditSuccess})
+	readers, closeAll, err := trail.openLogs()
+	require.NoError(t, err)
+	defer closeAll()
+
+	for range 5 {
+		trail.record(auditEvent{User: "bob", Verb: "apply", Result: auditSuccess})
+	}
+	require.Len(t, readers, 1)
+	data, err := io.ReadAll(readers[0])
+	require.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+	assert.Contains(t, string(data), `"user":"alice"`)
+}
+
+// TestAuditFilter verifies the user, verb, result, namespace and time filters
+func TestAuditFilter(t *testing.T) {
+	now := time.Now()
+	event := &auditEvent{
+		Time:    now.Add(-time.Hour),
+		User:    "alice",
+		Verb:    "delete",
+		Context: "prod",
+		Objects: []auditObject{{Kind: "Deployment", Namespace: "shop", Name: "web"}},
+		Result:  auditPartial,
+	}
+	assert.True(t, (&auditFilter{user: "alice", verb: "delete", context: "prod", namespace: "shop", result: auditPartial}).matches(event))
+	assert.True(t, (&auditFilter{from: now.Add(-2 * time.Hour), to: now}).matches(event))
+	assert.False(t, (&auditFilter{user: "bob"}).matches(event))
+	assert.False(t, (&auditFilter{namespace: "billing"}).matches(event))
+	assert.False(t, (&auditFilter{from: now.Add(-30 * time.Minute)}).matches(event))
+}
+
+// TestAuditWebhook verifies events are posted to the webhook as JSON
+func TestAuditWebhook(t *testing.T) {
+	received := make(chan auditEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event auditEvent
+		assert.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		received <- event
+	}))
+	defer server.Close()
+
+	trail := &auditTrail{path: filepath.Join(t.TempDir(), "audit.jsonl"), maxSize: 1 << 20, webhook: server.URL}
+	trail.record(auditEvent{User: "alice", Verb: "reveal", Result: auditSuccess, Details: map[string]string{"key": "password"}})
+	select {
+	case event := <-received:
+		assert.Equal(t, "reveal", event.Verb)
+		assert.Equal(t, map[string]string{"key": "password"}, event.Details)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+// TestApplyAuditEvent verifies object refs, the manifest hash and the overall result
+func TestApplyAuditEvent(t *testing.T) {
+	results := []objectResult{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "shop", Name: "web", Action: "configured"},
+		{APIVersion: "v1", Kind: "Service", Namespace: "shop", Name: "web", Action: "error", Error: "forbidden"},
+	}
+	event := applyAuditEvent("apply", "prod", "shop", "kind: Deployment", results, summarizeResults(results))
+	assert.Equal(t, auditPartial, event.Result)
+	assert.Equal(t, "web: forbidden", event.Error)
+	assert.Equal(t, manifestHash("kind: Deployment"), event.ManifestSHA256)
+	assert.Len(t, event.ManifestSHA256, 64)
+	assert.Equal(t, []auditObject{
+		{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "shop", Name: "web", Result: "configured"},
+		{APIVersion: "v1", Kind: "Service", Namespace: "shop", Name: "web", Result: "error"},
+	}, event.Objects)
+	assert.Equal(t, "shop/deployment/web,shop/service/web", event.target())
+
+	event = applyAuditEvent("delete", "prod", "shop", "", results[1:], summarizeResults(results[1:]))
+	assert.Equal(t, auditFailure, event.Result)
+}
+
+// TestGetAuditEvents verifies the endpoint filters and pages events, and logins are audited
+func TestGetAuditEvents(t *testing.T) {
+	user := "auditor-" + randomID(4)
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "audit-token,"+user+"\n"))
+	r := setupRouter()
+
+	for range 3 {
+		req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader(`{"token":"audit-token"}`))
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/audit?verb=login&user="+user+"&limit=2", nil)
+	req.Header.Set("Authorization", "Bearer audit-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Events     []auditEvent   `json:"events"`
+		Pagination map[string]int `json:"pagination"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Events, 2)
+	assert.Equal(t, user, body.Events[0].User)
+	assert.Equal(t, map[string]string{"method": authToken}, body.Events[0].Details)
+	assert.Equal(t, 3, body.Pagination["total"])
+	assert.Equal(t, 2, body.Pagination["nextOffset"])
+
+	req, _ = http.NewRequest("GET", "/api/audit?since=yesterday", nil)
+	req.Header.Set("Authorization", "Bearer audit-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
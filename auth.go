@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+const (
+	sessionCookie   = "stern-ui-session"
+	oidcStateCookie = "stern-ui-oidc"
+	authUserKey     = "authUser"
+)
+
+// Authentication methods, as reported in authUser.Method
+const (
+	authToken    = "token"
+	authHtpasswd = "htpasswd"
+	authOIDC     = "oidc"
+)
+
+// Time a browser has to complete the OIDC round trip
+const oidcLoginTimeout = 10 * time.Minute
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// authUser is the authenticated caller
+type authUser struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
+	Method string   `json:"method"`
+}
+
+// currentUser returns the caller authenticated by the middleware, nil when authentication is off
+func currentUser(c *gin.Context) *authUser {
+	if v, ok := c.Get(authUserKey); ok {
+		return v.(*authUser)
+	}
+	return nil
+}
+
+// oidcAuth is the OpenID Connect authorization-code flow. The provider is discovered on
+// first use so stern-ui starts while the issuer is unreachable.
+type oidcAuth struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	scopes        []string
+	usernameClaim string
+	groupsClaim   string
+
+	mu       sync.Mutex
+	config   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func (o *oidcAuth) setup(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.config != nil {
+		return o.config, o.verifier, nil
+	}
+	provider, err := oidc.NewProvider(ctx, o.issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	o.config = &oauth2.Config{
+		ClientID:     o.clientID,
+		ClientSecret: o.clientSecret,
+		RedirectURL:  o.redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       o.scopes,
+	}
+	o.verifier = provider.Verifier(&oidc.Config{ClientID: o.clientID})
+	return o.config, o.verifier, nil
+}
+
+// userFromClaims maps ID token claims to a user; the username claim falls back to sub
+func (o *oidcAuth) userFromClaims(claims map[string]interface{}) (*authUser, error) {
+	name, _ := claims[o.usernameClaim].(string)
+	if name == "" {
+		name, _ = claims["sub"].(string)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("ID token has no %s or sub claim", o.usernameClaim)
+	}
+	user := &authUser{Name: name, Method: authOIDC}
+	switch groups := claims[o.groupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				user.Groups = append(user.Groups, s)
+			}
+		}
+	case string:
+		user.Groups = []string{groups}
+	}
+	return user, nil
+}
+
+// authenticator checks static bearer tokens, htpasswd basic auth and OIDC, and issues
+// signed session cookies so browsers (and their WebSocket upgrades) stay logged in
+type authenticator struct {
+	tokens   map[string]*authUser // bearer token -> user
+	htpasswd map[string][]byte    // user -> bcrypt hash
+	oidc     *oidcAuth
+	key      []byte // HMAC key for cookies
+	ttl      time.Duration
+	secure   string // STERN_UI_COOKIE_SECURE: true, false, or empty to follow the request scheme
+}
+
+func (a *authenticator) enabled() bool {
+	return len(a.tokens) > 0 || len(a.htpasswd) > 0 || a.oidc != nil
+}
+
+// methods lists the configured authentication methods
+func (a *authenticator) methods() []string {
+	methods := []string{}
+	if len(a.tokens) > 0 {
+		methods = append(methods, authToken)
+	}
+	if len(a.htpasswd) > 0 {
+		methods = append(methods, authHtpasswd)
+	}
+	if a.oidc != nil {
+		methods = append(methods, authOIDC)
+	}
+	return methods
+}
+
+// loadTokenFile reads a Kubernetes-style static token file: token,user,uid,"group1,group2"
+func loadTokenFile(path string) (map[string]*authUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	tokens := map[string]*authUser{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("%s:%d: expected token,user[,uid[,groups]]", path, line)
+		}
+		user := &authUser{Name: strings.TrimSpace(record[1]), Method: authToken}
+		if len(record) > 3 {
+			for _, g := range strings.Split(record[3], ",") {
+				if g = strings.TrimSpace(g); g != "" {
+					user.Groups = append(user.Groups, g)
+				}
+			}
+		}
+		tokens[strings.TrimSpace(record[0])] = user
+	}
+	return tokens, nil
+}
+
+// loadHtpasswd reads user:hash lines; only bcrypt hashes (htpasswd -B) are accepted
+func loadHtpasswd(path string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string][]byte{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, i+1)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s does not use bcrypt (create it with htpasswd -B)", path, i+1, name)
+		}
+		users[name] = []byte(hash)
+	}
+	return users, nil
+}
+
+// newAuthenticatorFromEnv configures authentication from STERN_UI_AUTH_* and STERN_UI_OIDC_*;
+// with none of them set, authentication is off
+func newAuthenticatorFromEnv() (*authenticator, error) {
+	a := &authenticator{
+		ttl:    envDuration("STERN_UI_SESSION_TTL", 12*time.Hour),
+		secure: os.Getenv("STERN_UI_COOKIE_SECURE"),
+	}
+	var err error
+	if path := os.Getenv("STERN_UI_AUTH_TOKENS_FILE"); path != "" {
+		if a.tokens, err = loadTokenFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if path := os.Getenv("STERN_UI_AUTH_HTPASSWD"); path != "" {
+		if a.htpasswd, err = loadHtpasswd(path); err != nil {
+			return nil, err
+		}
+	}
+	if issuer := os.Getenv("STERN_UI_OIDC_ISSUER"); issuer != "" {
+		a.oidc = &oidcAuth{
+			issuer:        issuer,
+			clientID:      os.Getenv("STERN_UI_OIDC_CLIENT_ID"),
+			clientSecret:  os.Getenv("STERN_UI_OIDC_CLIENT_SECRET"),
+			redirectURL:   os.Getenv("STERN_UI_OIDC_REDIRECT_URL"),
+			scopes:        []string{oidc.ScopeOpenID, "profile", "email"},
+			usernameClaim: "email",
+			groupsClaim:   "groups",
+		}
+		if a.oidc.clientID == "" || a.oidc.redirectURL == "" {
+			return nil, errors.New("STERN_UI_OIDC_CLIENT_ID and STERN_UI_OIDC_REDIRECT_URL are required with STERN_UI_OIDC_ISSUER")
+		}
+		if scopes := strings.FieldsFunc(os.Getenv("STERN_UI_OIDC_SCOPES"), func(r rune) bool { return r == ',' || r == ' ' }); len(scopes) > 0 {
+			a.oidc.scopes = scopes
+		}
+		if claim := os.Getenv("STERN_UI_OIDC_USERNAME_CLAIM"); claim != "" {
+			a.oidc.usernameClaim = claim
+		}
+		if claim := os.Getenv("STERN_UI_OIDC_GROUPS_CLAIM"); claim != "" {
+			a.oidc.groupsClaim = claim
+		}
+	}
+
+	if key := os.Getenv("STERN_UI_SESSION_KEY"); key != "" {
+		if len(key) < 32 {
+			return nil, errors.New("STERN_UI_SESSION_KEY must be at least 32 characters")
+		}
+		a.key = []byte(key)
+	} else {
+		a.key = make([]byte, 32)
+		_, _ = rand.Read(a.key)
+		if a.enabled() {
+			log.Printf("[INFO] STERN_UI_SESSION_KEY not set: sessions end when stern-ui restarts")
+		}
+	}
+	if a.enabled() {
+		log.Printf("[INFO] authentication enabled: %s", strings.Join(a.methods(), ", "))
+	} else {
+		log.Printf("[WARN] authentication disabled: anyone who can reach stern-ui uses its kubeconfig")
+	}
+	return a, nil
+}
+
+// signedValue is the payload of a signed cookie
+type signedValue struct {
+	Value   json.RawMessage `json:"v"`
+	Expires int64           `json:"exp"`
+}
+
+// sign encodes v with an expiry and an HMAC so the cookie cannot be forged or extended
+func (a *authenticator) sign(v interface{}, expires time.Time) (string, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(signedValue{Value: value, Expires: expires.Unix()})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify decodes a value produced by sign, rejecting bad signatures and expired values
+func (a *authenticator) verify(raw string, v interface{}, now time.Time) bool {
+	encoded, sig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return false
+	}
+	var signed signedValue
+	if err := json.Unmarshal(payload, &signed); err != nil || now.Unix() >= signed.Expires {
+		return false
+	}
+	return json.Unmarshal(signed.Value, v) == nil
+}
+
+func (a *authenticator) secureCookie(c *gin.Context) bool {
+	switch a.secure {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// setCookie writes an HttpOnly cookie. SameSite=Lax keeps it off cross-site requests
+// (including WebSocket upgrades) while surviving the redirect back from the OIDC provider.
+func (a *authenticator) setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   a.secureCookie(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *authenticator) clearCookie(c *gin.Context, name string) {
+	a.setCookie(c, name, "", -time.Second)
+}
+
+// startSession issues the session cookie for user
+func (a *authenticator) startSession(c *gin.Context, user *authUser) error {
+	value, err := a.sign(user, time.Now().Add(a.ttl))
+	if err != nil {
+		return err
+	}
+	a.setCookie(c, sessionCookie, value, a.ttl)
+	c.Set(authUserKey, user)
+	recordAudit(c, auditEvent{Verb: "login", Details: map[string]string{"method": user.Method}})
+	return nil
+}
+
+// checkToken looks up a static bearer token in constant time
+func (a *authenticator) checkToken(token string) *authUser {
+	var found *authUser
+	for known, user := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			found = user
+		}
+	}
+	return found
+}
+
+// Compared against for unknown users so response time does not reveal which users exist
+var dummyBcryptHash, _ = bcrypt.GenerateFromPassword([]byte("stern-ui"), bcrypt.DefaultCost)
+
+func (a *authenticator) checkPassword(name, password string) *authUser {
+	hash, ok := a.htpasswd[name]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyBcryptHash, []byte(password))
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil
+	}
+	return &authUser{Name: name, Method: authHtpasswd}
+}
+
+// authenticate resolves the caller from the session cookie, a bearer token or basic auth.
+// It returns errInvalidCredentials when credentials were sent but are wrong.
+// Session cookies are ignored on cross-origin WebSocket upgrades: the upgrader accepts any
+// Origin, and browsers attach cookies to WebSocket handshakes from other pages.
+func (a *authenticator) authenticate(c *gin.Context) (*authUser, error) {
+	if raw, err := c.Cookie(sessionCookie); err == nil && raw != "" && !crossOriginUpgrade(c.Request) {
+		var user authUser
+		if a.verify(raw, &user, time.Now()) {
+			return &user, nil
+		}
+	}
+	header := c.GetHeader("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok && len(a.tokens) > 0 {
+		if user := a.checkToken(strings.TrimSpace(token)); user != nil {
+			return user, nil
+		}
+		return nil, errInvalidCredentials
+	}
+	if name, password, ok := c.Request.BasicAuth(); ok && len(a.htpasswd) > 0 {
+		if user := a.checkPassword(name, password); user != nil {
+			return user, nil
+		}
+		return nil, errInvalidCredentials
+	}
+	return nil, nil
+}
+
+// crossOriginUpgrade reports a WebSocket handshake whose Origin is not this server
+func crossOriginUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+// isPublicPath reports paths served without authentication: the login endpoints and static assets
+func isPublicPath(path string) bool {
+	return strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/assets/") || path == "/vite.svg"
+}
+
+// middleware authenticates every request, WebSocket upgrades included. API and WebSocket
+// callers get 401; browsers loading a page are sent to the login they can complete.
+func (a *authenticator) middleware(c *gin.Context) {
+	if !a.enabled() || isPublicPath(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+	user, err := a.authenticate(c)
+	if user != nil {
+		c.Set(authUserKey, user)
+		c.Next()
+		return
+	}
+	if err != nil {
+		recordAudit(c, auditEvent{Verb: "login", Result: auditFailure, Error: err.Error(), Details: map[string]string{"path": c.Request.URL.Path}})
+	}
+
+	path := c.Request.URL.Path
+	api := strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/ws/")
+	switch {
+	case !api && a.oidc != nil && len(a.htpasswd) == 0:
+		c.Redirect(http.StatusFound, "/auth/login?return_to="+url.QueryEscape(c.Request.URL.RequestURI()))
+		c.Abort()
+		return
+	case len(a.htpasswd) > 0:
+		c.Header("WWW-Authenticate", `Basic realm="stern-ui", charset="UTF-8"`)
+	case len(a.tokens) > 0:
+		c.Header("WWW-Authenticate", `Bearer realm="stern-ui"`)
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required", "methods": a.methods(), "login": "/auth/login"})
+}
+
+// safeReturnTo only allows local paths, so the login cannot be used as an open redirect
+func safeReturnTo(raw string) string {
+	if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.HasPrefix(raw, "/\\") {
+		return "/"
+	}
+	return raw
+}
+
+// oidcState travels in a signed cookie between the login redirect and the callback
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"returnTo"`
+}
+
+// login starts the OIDC flow, or lists the available methods when OIDC is not configured
+func (a *authenticator) login(c *gin.Context) {
+	if a.oidc == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": a.enabled(), "methods": a.methods()})
+		return
+	}
+	config, _, err := a.oidc.setup(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	state := oidcState{
+		State:    randomID(16),
+		Nonce:    randomID(16),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: safeReturnTo(c.Query("return_to")),
+	}
+	value, err := a.sign(state, time.Now().Add(oidcLoginTimeout))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	a.setCookie(c, oidcStateCookie, value, oidcLoginTimeout)
+	c.Redirect(http.StatusFound, config.AuthCodeURL(state.State, oidc.Nonce(state.Nonce), oauth2.S256ChallengeOption(state.Verifier)))
+}
+
+// oidcCallback exchanges the authorization code, verifies the ID token and starts a session
+func (a *authenticator) oidcCallback(c *gin.Context) {
+	if a.oidc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC is not configured"})
+		return
+	}
+	var state oidcState
+	raw, _ := c.Cookie(oidcStateCookie)
+	if raw == "" || !a.verify(raw, &state, time.Now()) || subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired login state, start again at /auth/login"})
+		return
+	}
+	a.clearCookie(c, oidcStateCookie)
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("identity provider: %s %s", e, c.Query("error_description"))})
+		return
+	}
+
+	ctx := c.Request.Context()
+	config, verifier, err := a.oidc.setup(ctx)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := config.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "code exchange failed: " + err.Error()})
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token response has no id_token"})
+		return
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ID token: " + err.Error()})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(state.Nonce)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ID token nonce does not match"})
+		return
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := a.oidc.userFromClaims(claims)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err := a.startSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, state.ReturnTo)
+}
+
+// loginWithCredentials exchanges a static token or htpasswd credentials for a session cookie
+func (a *authenticator) loginWithCredentials(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	var user *authUser
+	switch {
+	case body.Token != "" && len(a.tokens) > 0:
+		user = a.checkToken(body.Token)
+	case body.Username != "" && len(a.htpasswd) > 0:
+		user = a.checkPassword(body.Username, body.Password)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "send a token or a username and password", "methods": a.methods()})
+		return
+	}
+	if user == nil {
+		recordAudit(c, auditEvent{Verb: "login", Result: auditFailure, Error: errInvalidCredentials.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidCredentials.Error()})
+		return
+	}
+	if err := a.startSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// logout clears the session cookie
+func (a *authenticator) logout(c *gin.Context) {
+	a.clearCookie(c, sessionCookie)
+	c.Status(http.StatusNoContent)
+}
+
+// me returns the authenticated caller
+func (a *authenticator) me(c *gin.Context) {
+	if !a.enabled() {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	user, _ := a.authenticate(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not logged in", "methods": a.methods()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "user": user})
+}
+
+// registerRoutes adds the /auth endpoints
+func (a *authenticator) registerRoutes(r *gin.Engine) {
+	r.GET("/auth/login", a.login)
+	r.POST("/auth/login", a.loginWithCredentials)
+	r.GET("/auth/callback", a.oidcCallback)
+	r.POST("/auth/logout", a.logout)
+	r.GET("/auth/me", a.me)
+}
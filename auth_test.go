@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func cookieFrom(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// TestLoadTokenFile verifies the Kubernetes static token format with quoted groups
+func TestLoadTokenFile(t *testing.T) {
+	tokens, err := loadTokenFile(writeTestFile(t, "tokens.csv", "# comment\ns3cret,alice,1001,\"dev,ops\"\nother,bob\n"))
+	require.NoError(t, err)
+	assert.Equal(t, &authUser{Name: "alice", Groups: []string{"dev", "ops"}, Method: authToken}, tokens["s3cret"])
+	assert.Equal(t, &authUser{Name: "bob", Method: authToken}, tokens["other"])
+
+	_, err = loadTokenFile(writeTestFile(t, "bad.csv", "onlytoken\n"))
+	assert.ErrorContains(t, err, "expected token,user")
+}
+
+// TestLoadHtpasswd verifies bcrypt entries are accepted and other hashes rejected
+func TestLoadHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users, err := loadHtpasswd(writeTestFile(t, "htpasswd", "alice:"+string(hash)+"\n"))
+	require.NoError(t, err)
+	a := &authenticator{htpasswd: users}
+	assert.Equal(t, &authUser{Name: "alice", Method: authHtpasswd}, a.checkPassword("alice", "pw"))
+	assert.Nil(t, a.checkPassword("alice", "wrong"))
+	assert.Nil(t, a.checkPassword("mallory", "pw"))
+
+	_, err = loadHtpasswd(writeTestFile(t, "md5", "bob:$apr1$abc$def\n"))
+	assert.ErrorContains(t, err, "does not use bcrypt")
+}
+
+// TestSignedValue verifies signed cookies round-trip and reject tampering and expiry
+func TestSignedValue(t *testing.T) {
+	a := &authenticator{key: []byte(strings.Repeat("k", 32))}
+	now := time.Now()
+	raw, err := a.sign(authUser{Name: "alice"}, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	var user authUser
+	assert.True(t, a.verify(raw, &user, now))
+	assert.Equal(t, "alice", user.Name)
+	assert.False(t, a.verify(raw, &user, now.Add(2*time.Hour)), "expired")
+	assert.False(t, a.verify("x"+raw, &user, now), "tampered payload")
+	other := &authenticator{key: []byte(strings.Repeat("o", 32))}
+	assert.False(t, other.verify(raw, &user, now), "signed with another key")
+}
+
+// TestSafeReturnTo verifies the login only redirects to local paths
+func TestSafeReturnTo(t *testing.T) {
+	assert.Equal(t, "/logs?ns=a", safeReturnTo("/logs?ns=a"))
+	assert.Equal(t, "/", safeReturnTo("https://evil.example"))
+	assert.Equal(t, "/", safeReturnTo("//evil.example"))
+	assert.Equal(t, "/", safeReturnTo(`/\evil.example`))
+}
+
+// TestAuthMiddleware verifies API, WebSocket and page requests need credentials once a token file is set
+func TestAuthMiddleware(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "s3cret,alice,1001,dev\n"))
+	r := setupRouter()
+
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/api/logs/search", "/ws/logs?namespace=a", "/ws/replay/abc", "/"} {
+		w := serve(path, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+		assert.Equal(t, `Bearer realm="stern-ui"`, w.Header().Get("WWW-Authenticate"), path)
+	}
+	assert.Equal(t, http.StatusUnauthorized, serve("/api/logs/search", http.Header{"Authorization": {"Bearer wrong"}}).Code)
+
+	w := serve("/api/logs/search?context=minikube&namespace=shop", http.Header{"Authorization": {"Bearer s3cret"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "authenticated requests reach the handler")
+
+	w = serve("/auth/login", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "login endpoints are public")
+	assert.JSONEq(t, `{"enabled":true,"methods":["token"]}`, w.Body.String())
+}
+
+// TestCredentialLoginSession verifies POST /auth/login issues a session cookie that authenticates
+// HTTP requests and WebSocket upgrades until logout
+func TestCredentialLoginSession(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "s3cret,alice\n"))
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader(`{"token":"wrong"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("POST", "/auth/login", strings.NewReader(`{"token":"s3cret"}`))
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	session := cookieFrom(w, sessionCookie)
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+	assert.True(t, session.Secure, "behind a TLS-terminating proxy")
+	assert.Equal(t, http.SameSiteLaxMode, session.SameSite)
+
+	req, _ = http.NewRequest("GET", "/auth/me", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"enabled":true,"user":{"name":"alice","method":"token"}}`, w.Body.String())
+
+	req, _ = http.NewRequest("GET", "/ws/replay/abc?speed=bogus", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the session cookie authenticates WebSocket routes")
+
+	req, _ = http.NewRequest("GET", "/ws/replay/abc?speed=bogus", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Origin", "https://evil.example")
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "cross-origin upgrades do not get the session")
+
+	req, _ = http.NewRequest("POST", "/auth/logout", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, -1, cookieFrom(w, sessionCookie).MaxAge)
+}
+
+// mockIssuer is an OIDC provider serving discovery, keys and a token endpoint that returns
+// an RS256 ID token carrying the nonce of the last authorization request
+type mockIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	claims map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, (&jose.SignerOptions{}).WithType("JWT"))
+		require.NoError(t, err)
+		claims := map[string]interface{}{
+			"iss":   m.URL,
+			"aud":   "stern-ui",
+			"sub":   "user-1",
+			"nonce": m.nonce,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		payload, _ := json.Marshal(claims)
+		signed, err := signer.Sign(payload)
+		require.NoError(t, err)
+		idToken, _ := signed.CompactSerialize()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// TestOIDCLogin verifies the authorization-code flow against a mock issuer: state and PKCE on the
+// way out, ID token and nonce checks on the callback, and a session for the mapped user
+func TestOIDCLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.claims = map[string]interface{}{"email": "alice@example.com", "groups": []string{"dev"}}
+	t.Setenv("STERN_UI_OIDC_ISSUER", issuer.URL)
+	t.Setenv("STERN_UI_OIDC_CLIENT_ID", "stern-ui")
+	t.Setenv("STERN_UI_OIDC_REDIRECT_URL", "http://stern-ui.local/auth/callback")
+	r := setupRouter()
+
+	// Pages redirect to the login, API calls get 401
+	req, _ := http.NewRequest("GET", "/logs", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/auth/login?return_to=%2Flogs", w.Header().Get("Location"))
+
+	// The page's own query string survives the round trip instead of leaking into the login URL
+	req, _ = http.NewRequest("GET", "/logs?context=dev&namespace=prod", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	login, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/logs?context=dev&namespace=prod", login.Query().Get("return_to"))
+
+	req, _ = http.NewRequest("GET", "/auth/login?return_to=/logs", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, issuer.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	assert.Equal(t, "openid profile email", location.Query().Get("scope"))
+	state := cookieFrom(w, oidcStateCookie)
+	require.NotNil(t, state)
+
+	callback := func(query string, nonce string) *httptest.ResponseRecorder {
+		issuer.nonce = nonce
+		req, _ := http.NewRequest("GET", "/auth/callback?"+query, nil)
+		req.AddCookie(state)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	stateParam := "state=" + location.Query().Get("state")
+
+	assert.Equal(t, http.StatusBadRequest, callback("code=good-code&state=forged", location.Query().Get("nonce")).Code)
+	assert.Equal(t, http.StatusUnauthorized, callback("code=bad-code&"+stateParam, location.Query().Get("nonce")).Code)
+	assert.Equal(t, http.StatusUnauthorized, callback("code=good-code&"+stateParam, "replayed").Code, "nonce mismatch")
+
+	w = callback("code=good-code&"+stateParam, location.Query().Get("nonce"))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.Equal(t, "/logs", w.Header().Get("Location"))
+	session := cookieFrom(w, sessionCookie)
+	require.NotNil(t, session)
+
+	req, _ = http.NewRequest("GET", "/auth/me", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.JSONEq(t, `{"enabled":true,"user":{"name":"alice@example.com","groups":["dev"],"method":"oidc"}}`, w.Body.String())
+}
+
+// TestRequestOwnerUsesAuthenticatedUser verifies presets belong to the user once authentication is on
+func TestRequestOwnerUsesAuthenticatedUser(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/api/presets", nil)
+	c.Set(authUserKey, &authUser{Name: "alice"})
+	assert.Equal(t, "user:alice", requestOwner(c))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Exec into containers is off unless the server explicitly enables it
+var execEnabled = os.Getenv("STERN_UI_ENABLE_EXEC") == "true"
+
+// execUpgrader only accepts upgrades from stern-ui's own pages. Unlike log streams, a shell
+// must not be reachable from another site the operator visits while auth is off.
+var execUpgrader = websocket.Upgrader{
+	CheckOrigin:      func(r *http.Request) bool { return !crossOriginUpgrade(r) },
+	HandshakeTimeout: upgrader.HandshakeTimeout,
+	ReadBufferSize:   upgrader.ReadBufferSize,
+	WriteBufferSize:  upgrader.WriteBufferSize,
+}
+
+// Shell used when no command is given: bash when the image has it, sh otherwise
+var defaultExecCommand = []string{"/bin/sh", "-c", "command -v bash >/dev/null 2>&1 && exec bash || exec sh"}
+
+// Annotation kubectl uses to pick the container when none is given
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// terminalMessage is a control message from the browser: keystrokes or a resize
+type terminalMessage struct {
+	Type string `json:"type"` // stdin or resize
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// terminalSession multiplexes a browser WebSocket onto the stdin/stdout/resize streams of an exec.
+// Output is sent as binary frames, control messages (exit, error) as JSON text frames.
+type terminalSession struct {
+	writer *WebSocketWriter
+	stdin  *io.PipeWriter
+	sizes  chan remotecommand.TerminalSize
+	once   sync.Once
+}
+
+func newTerminalSession(writer *WebSocketWriter, stdin *io.PipeWriter) *terminalSession {
+	return &terminalSession{writer: writer, stdin: stdin, sizes: make(chan remotecommand.TerminalSize, 4)}
+}
+
+// Next implements remotecommand.TerminalSizeQueue
+func (t *terminalSession) Next() *remotecommand.TerminalSize {
+	size, ok := <-t.sizes
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+// Write implements io.Writer for the container's stdout
+func (t *terminalSession) Write(p []byte) (int, error) {
+	if err := t.writer.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// handle applies one browser message to the exec streams
+func (t *terminalSession) handle(data []byte) error {
+	var msg terminalMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("invalid terminal message: %w", err)
+	}
+	switch msg.Type {
+	case "stdin":
+		_, err := t.stdin.Write([]byte(msg.Data))
+		return err
+	case "resize":
+		if msg.Cols == 0 || msg.Rows == 0 {
+			return nil
+		}
+		// Drop the resize rather than block the read loop if the executor is behind
+		select {
+		case t.sizes <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}:
+		default:
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown terminal message type %q", msg.Type)
+	}
+}
+
+func (t *terminalSession) close() {
+	t.once.Do(func() {
+		_ = t.stdin.Close()
+		close(t.sizes)
+	})
+}
+
+// readTerminal pumps browser messages into the session until the socket closes, and pings the
+// browser so an idle terminal or one only showing output is not dropped
+func readTerminal(ctx context.Context, conn *websocket.Conn, session *terminalSession, cancel context.CancelFunc) {
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	go func() {
+		defer cancel()
+		defer session.close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+			if err := session.handle(data); err != nil {
+				debugLog("exec: %v", err)
+			}
+		}
+	}()
+	go pingWebSocket(ctx, cancel, session.writer)
+}
+
+// resolveExecContainer picks the requested container, the default-container annotation, or the first container
+func resolveExecContainer(pod *corev1.Pod, container string) (string, error) {
+	if container != "" {
+		for _, c := range pod.Spec.Containers {
+			if c.Name == container {
+				return container, nil
+			}
+		}
+		for _, c := range pod.Spec.EphemeralContainers {
+			if c.Name == container {
+				return container, nil
+			}
+		}
+		return "", fmt.Errorf("container %q not found in pod %s/%s", container, pod.Namespace, pod.Name)
+	}
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		return name, nil
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return "", fmt.Errorf("pod %s/%s has no containers", pod.Namespace, pod.Name)
+	}
+	return pod.Spec.Containers[0].Name, nil
+}
+
+// execContainer opens a TTY into a pod container over the browser WebSocket.
+// Query: context, namespace, pod, container, command (repeatable).
+func execContainer(c *gin.Context) {
+	if !execEnabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "exec is disabled on this server (set STERN_UI_ENABLE_EXEC=true)"})
+		return
+	}
+
+	params := parseStreamParams(c)
+	podName := c.Query("pod")
+	if podName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pod parameter is required"})
+		return
+	}
+	command := c.QueryArray("command")
+	if len(command) == 0 {
+		command = defaultExecCommand
+	}
+
+	conn, err := execUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	writer := &WebSocketWriter{conn: conn}
+
+	restConfig, kubeConfig, err := createRestConfig(params.contextName, currentUser(c))
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		writer.WriteError(fmt.Errorf("failed to create Kubernetes client: %w", err))
+		return
+	}
+	params.allNamespaces = ""
+	namespace := buildNamespaceList(params, kubeConfig)[0]
+
+	if err := checkAccess(c.Request.Context(), clientset, authorizationv1.ResourceAttributes{
+		Verb: "create", Resource: "pods", Subresource: "exec", Name: podName, Namespace: namespace,
+	}); err != nil {
+		writer.WriteError(err)
+		return
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(c.Request.Context(), podName, metav1.GetOptions{})
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+	container, err := resolveExecContainer(pod, c.Query("container"))
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+	// Prefer the WebSocket exec protocol and fall back to SPDY for older API servers
+	spdyExec, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+	wsExec, err := remotecommand.NewWebSocketExecutor(restConfig, "GET", req.URL().String())
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+	executor, err := remotecommand.NewFallbackExecutor(wsExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		writer.WriteError(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdinReader, stdinWriter := io.Pipe()
+	session := newTerminalSession(writer, stdinWriter)
+	defer session.close()
+	readTerminal(ctx, conn, session, cancel)
+
+	event := auditEvent{
+		Verb:      "exec",
+		Context:   currentContextName(params.contextName),
+		Namespace: namespace,
+		Objects:   []auditObject{{APIVersion: "v1", Kind: "pod", Namespace: namespace, Name: podName}},
+		Result:    auditStarted,
+		Details:   map[string]string{"container": container, "command": strings.Join(command, " ")},
+	}
+	recordAudit(c, event)
+	started := time.Now()
+
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             stdinReader,
+		Stdout:            session,
+		Tty:               true,
+		TerminalSizeQueue: session,
+	})
+
+	exitCode := 0
+	if err != nil {
+		exitCode = 1
+		if exitErr, ok := err.(interface{ ExitStatus() int }); ok {
+			exitCode = exitErr.ExitStatus()
+		} else if ctx.Err() == nil {
+			writer.WriteError(err)
+		}
+	}
+	event.Result = auditSuccess
+	if exitCode != 0 {
+		event.Result = auditFailure
+	}
+	event.Details["exitCode"] = strconv.Itoa(exitCode)
+	event.Details["duration"] = time.Since(started).Round(time.Second).String()
+	recordAudit(c, event)
+
+	exitMsg, _ := json.Marshal(gin.H{"type": "exit", "code": exitCode})
+	_ = writer.WriteMessage(websocket.TextMessage, exitMsg)
+}
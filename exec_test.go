@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// TestTerminalSessionHandle verifies stdin is forwarded and resizes are queued
+func TestTerminalSessionHandle(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	session := newTerminalSession(nil, stdinWriter)
+
+	go func() {
+		assert.NoError(t, session.handle([]byte(`{"type":"stdin","data":"ls\r"}`)))
+	}()
+	buf := make([]byte, 3)
+	_, err := io.ReadFull(stdinReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ls\r", string(buf))
+
+	require.NoError(t, session.handle([]byte(`{"type":"resize","cols":120,"rows":40}`)))
+	assert.Equal(t, &remotecommand.TerminalSize{Width: 120, Height: 40}, session.Next())
+
+	assert.Error(t, session.handle([]byte(`{"type":"explode"}`)))
+	assert.Error(t, session.handle([]byte(`not json`)))
+
+	session.close()
+	assert.Nil(t, session.Next(), "closed session ends the size queue")
+}
+
+// TestResolveExecContainer verifies explicit, annotated and first-container selection
+func TestResolveExecContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "istio-proxy"}, {Name: "app"}}},
+	}
+
+	name, err := resolveExecContainer(pod, "app")
+	require.NoError(t, err)
+	assert.Equal(t, "app", name)
+
+	name, _ = resolveExecContainer(pod, "")
+	assert.Equal(t, "istio-proxy", name)
+
+	pod.Annotations = map[string]string{defaultContainerAnnotation: "app"}
+	name, _ = resolveExecContainer(pod, "")
+	assert.Equal(t, "app", name)
+
+	_, err = resolveExecContainer(pod, "missing")
+	assert.Error(t, err)
+}
+
+// TestExecDisabledByDefault verifies the exec endpoint is gated by the server flag
+func TestExecDisabledByDefault(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/ws/exec?namespace=default&pod=web", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestReadTerminalKeepsIdleSessions verifies a terminal the browser sends nothing to outlives pongWait
+func TestReadTerminalKeepsIdleSessions(t *testing.T) {
+	wait, period := pongWait, pingPeriod
+	pongWait, pingPeriod = 150*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() { pongWait, pingPeriod = wait, period })
+
+	closed := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, stdin := io.Pipe()
+		readTerminal(ctx, conn, newTerminalSession(&WebSocketWriter{conn: conn}, stdin), cancel)
+		select {
+		case <-ctx.Done():
+			closed <- true
+		case <-time.After(4 * pongWait):
+			closed <- false
+		}
+	}))
+	defer server.Close()
+
+	// The client only answers pings, which gorilla does while reading
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	assert.False(t, <-closed, "idle terminal was closed")
+}
+
+// TestExecUpgraderChecksOrigin verifies only same-origin pages and non-browser clients may open a terminal
+func TestExecUpgraderChecksOrigin(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://stern-ui.local/ws/exec?pod=web", nil)
+	req.Header.Set("Upgrade", "websocket")
+	assert.True(t, execUpgrader.CheckOrigin(req), "no Origin header")
+
+	req.Header.Set("Origin", "http://stern-ui.local")
+	assert.True(t, execUpgrader.CheckOrigin(req))
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	assert.False(t, execUpgrader.CheckOrigin(req))
+	assert.True(t, upgrader.CheckOrigin(req), "log streams keep accepting any origin")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features that can be switched off. Their routes are not registered at all when off, so
+// nothing behind them is reachable whatever the authentication or policy configuration.
+const (
+	featureApply       = "apply"        // POST /api/clusters/apply
+	featureActions     = "actions"      // POST /api/clusters/actions
+	featureSecrets     = "secrets"      // Secrets in the resource browser and POST /api/clusters/secret-reveal
+	featureExec        = "exec"         // /ws/exec
+	featurePortForward = "port-forward" // /api/clusters/port-forwards
+)
+
+// serverFeatures lists every feature; STERN_UI_READ_ONLY=true turns them all off, leaving
+// log streaming and read-only cluster views
+var serverFeatures = []string{featureApply, featureActions, featureSecrets, featureExec, featurePortForward}
+
+// featureSet is the server's feature configuration
+type featureSet struct {
+	readOnly bool
+	disabled []string
+}
+
+// loadFeatures reads STERN_UI_READ_ONLY and STERN_UI_DISABLED_FEATURES (comma-separated
+// feature names). Unknown names are an error rather than a feature silently left on.
+func loadFeatures() (featureSet, error) {
+	f := featureSet{readOnly: os.Getenv("STERN_UI_READ_ONLY") == "true"}
+	if f.readOnly {
+		f.disabled = serverFeatures
+		return f, nil
+	}
+	for _, name := range splitPatterns(os.Getenv("STERN_UI_DISABLED_FEATURES")) {
+		if !slices.Contains(serverFeatures, name) {
+			return featureSet{}, fmt.Errorf("STERN_UI_DISABLED_FEATURES: unknown feature %q (known: %s)", name, strings.Join(serverFeatures, ", "))
+		}
+		f.disabled = append(f.disabled, name)
+	}
+	return f, nil
+}
+
+func (f featureSet) enabled(name string) bool {
+	return !slices.Contains(f.disabled, name)
+}
+
+// capabilities reports which features the frontend should offer. Exec and secret reveal also
+// need their opt-in flags, STERN_UI_ENABLE_EXEC and STERN_UI_SECRET_REVEAL.
+func (f featureSet) capabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"readOnly": f.readOnly,
+		"features": gin.H{
+			"apply":        f.enabled(featureApply),
+			"actions":      f.enabled(featureActions),
+			"secrets":      f.enabled(featureSecrets),
+			"secretReveal": f.enabled(featureSecrets) && secretRevealEnabled,
+			"exec":         f.enabled(featureExec) && execEnabled,
+			"portForward":  f.enabled(featurePortForward),
+		},
+	})
+}
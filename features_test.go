@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadFeatures verifies read-only mode, individual kill switches and unknown feature names
+func TestLoadFeatures(t *testing.T) {
+	f, err := loadFeatures()
+	require.NoError(t, err)
+	for _, name := range serverFeatures {
+		assert.True(t, f.enabled(name), name)
+	}
+
+	t.Setenv("STERN_UI_DISABLED_FEATURES", "exec, Port-Forward")
+	f, err = loadFeatures()
+	require.NoError(t, err)
+	assert.False(t, f.enabled(featureExec))
+	assert.False(t, f.enabled(featurePortForward))
+	assert.True(t, f.enabled(featureApply))
+
+	t.Setenv("STERN_UI_DISABLED_FEATURES", "exec,shell")
+	_, err = loadFeatures()
+	assert.ErrorContains(t, err, `unknown feature "shell"`)
+
+	t.Setenv("STERN_UI_READ_ONLY", "true")
+	f, err = loadFeatures()
+	require.NoError(t, err)
+	assert.True(t, f.readOnly)
+	for _, name := range serverFeatures {
+		assert.False(t, f.enabled(name), name)
+	}
+}
+
+// TestReadOnlyRouter verifies disabled routes are not registered and capabilities report them
+func TestReadOnlyRouter(t *testing.T) {
+	t.Setenv("STERN_UI_READ_ONLY", "true")
+	r := setupRouter()
+
+	for _, route := range r.Routes() {
+		assert.NotContains(t, []string{"/api/clusters/apply", "/api/clusters/actions", "/api/clusters/secret-reveal", "/ws/exec", "/api/clusters/port-forwards"}, route.Path)
+	}
+	req, _ := http.NewRequest("POST", "/api/clusters/apply?context=minikube", strings.NewReader(`{"verb":"apply","yaml":"kind: Pod"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("GET", "/api/capabilities", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		ReadOnly bool            `json:"readOnly"`
+		Features map[string]bool `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.True(t, body.ReadOnly)
+	assert.Equal(t, map[string]bool{"apply": false, "actions": false, "secrets": false, "secretReveal": false, "exec": false, "portForward": false}, body.Features)
+
+	secrets := apiResource{Name: "secrets", ID: "secrets"}
+	assert.False(t, resourceAccess.allows(secrets), "secrets hidden from the resource browser")
+}
+
+// TestInvalidFeaturesPanics verifies the router refuses an unknown kill switch
+func TestInvalidFeaturesPanics(t *testing.T) {
+	t.Setenv("STERN_UI_DISABLED_FEATURES", "apply,deploy")
+	assert.Panics(t, func() { setupRouter() })
+}
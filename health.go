@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// Pod issues returned per page when the caller does not set limit
+const defaultIssueLimit = 200
+
+// Largest page any paginated endpoint returns
+const maxPageLimit = 1000
+
+// Pods fetched per List call; large clusters are read in several pages
+const healthPageSize = 500
+
+// Node conditions that signal trouble when True (Ready is the inverse and reported separately)
+var nodePressureConditions = []corev1.NodeConditionType{
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+	corev1.NodeNetworkUnavailable,
+}
+
+// Issue severities, highest first
+const (
+	severityCritical = "critical"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+)
+
+var severityRank = map[string]int{severityCritical: 3, severityWarning: 2, severityInfo: 1}
+
+// Reasons that mean the pod cannot run without intervention
+var criticalReasons = map[string]bool{
+	"Failed":                     true,
+	"CrashLoopBackOff":           true,
+	"OOMKilled":                  true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+	"FailedScheduling":           true,
+	"Unschedulable":              true,
+	"Evicted":                    true,
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func podIssueReason(pod corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodPending {
+		return string(pod.Status.Phase)
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return cs.State.Waiting.Reason
+		}
+		if cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.Reason != "" {
+			return cs.LastTerminationState.Terminated.Reason
+		}
+	}
+	return ""
+}
+
+// nodeCondition is one node condition as reported by the kubelet
+type nodeCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// nodeHealth is the health view of a node
+type nodeHealth struct {
+	Name          string          `json:"name"`
+	Ready         bool            `json:"ready"`
+	CPU           string          `json:"cpu"`
+	Memory        string          `json:"memory"`
+	Version       string          `json:"version"`
+	Unschedulable bool            `json:"unschedulable"`
+	Pressure      []string        `json:"pressure"`
+	Conditions    []nodeCondition `json:"conditions"`
+	Taints        []corev1.Taint  `json:"taints"`
+	Usage         *nodeUsage      `json:"usage,omitempty"`
+}
+
+func buildNodeHealth(n corev1.Node) nodeHealth {
+	h := nodeHealth{
+		Name:          n.Name,
+		Ready:         nodeReady(n),
+		CPU:           n.Status.Capacity.Cpu().String(),
+		Memory:        n.Status.Capacity.Memory().String(),
+		Version:       n.Status.NodeInfo.KubeletVersion,
+		Unschedulable: n.Spec.Unschedulable,
+		Pressure:      []string{},
+		Conditions:    []nodeCondition{},
+		Taints:        n.Spec.Taints,
+	}
+	if h.Taints == nil {
+		h.Taints = []corev1.Taint{}
+	}
+	for _, cond := range n.Status.Conditions {
+		h.Conditions = append(h.Conditions, nodeCondition{
+			Type:    string(cond.Type),
+			Status:  string(cond.Status),
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+		for _, pressure := range nodePressureConditions {
+			if cond.Type == pressure && cond.Status == corev1.ConditionTrue {
+				h.Pressure = append(h.Pressure, string(cond.Type))
+			}
+		}
+	}
+	return h
+}
+
+// podIssue is a pod that needs attention, ranked by severity then recency
+type podIssue struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Node      string    `json:"node,omitempty"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message,omitempty"`
+	Severity  string    `json:"severity"`
+	Restarts  int32     `json:"restarts"`
+	Age       string    `json:"age"`
+	Since     time.Time `json:"since"`
+}
+
+// latestTransition returns when the pod last changed state, used to rank recent issues first
+func latestTransition(pod corev1.Pod) time.Time {
+	latest := pod.CreationTimestamp.Time
+	later := func(t metav1.Time) {
+		if t.After(latest) {
+			latest = t.Time
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		later(cond.LastTransitionTime)
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Running != nil {
+			later(cs.State.Running.StartedAt)
+		}
+		if cs.State.Terminated != nil {
+			later(cs.State.Terminated.FinishedAt)
+		}
+		if cs.LastTerminationState.Terminated != nil {
+			later(cs.LastTerminationState.Terminated.FinishedAt)
+		}
+	}
+	return latest
+}
+
+// classifyPodIssue returns the issue for a pod, or nil when it is healthy.
+// schedulingFailures maps namespace/name to the latest FailedScheduling event message.
+func classifyPodIssue(pod corev1.Pod, schedulingFailures map[string]string, now time.Time) *podIssue {
+	reason := podIssueReason(pod)
+	if reason == "" {
+		return nil
+	}
+	issue := &podIssue{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Node:      pod.Spec.NodeName,
+		Reason:    reason,
+		Message:   pod.Status.Message,
+		Age:       now.Sub(pod.CreationTimestamp.Time).Round(time.Minute).String(),
+		Since:     latestTransition(pod),
+	}
+	if pod.Status.Reason != "" {
+		issue.Reason = pod.Status.Reason
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		issue.Restarts += cs.RestartCount
+		if issue.Reason == string(corev1.PodPending) && cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			issue.Reason = cs.State.Waiting.Reason
+			issue.Message = cs.State.Waiting.Message
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodPending {
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+				issue.Reason = cond.Reason
+				issue.Message = cond.Message
+			}
+		}
+		if msg, ok := schedulingFailures[pod.Namespace+"/"+pod.Name]; ok && pod.Spec.NodeName == "" {
+			issue.Reason = "FailedScheduling"
+			issue.Message = msg
+		}
+	}
+
+	switch {
+	case criticalReasons[issue.Reason]:
+		issue.Severity = severityCritical
+	case pod.Status.Phase == corev1.PodPending || issue.Restarts > 0:
+		issue.Severity = severityWarning
+	default:
+		issue.Severity = severityInfo
+	}
+	return issue
+}
+
+// rankIssues orders issues by severity, then most recent first
+func rankIssues(issues []podIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] > severityRank[b.Severity]
+		}
+		if !a.Since.Equal(b.Since) {
+			return a.Since.After(b.Since)
+		}
+		return a.Namespace+"/"+a.Name < b.Namespace+"/"+b.Name
+	})
+}
+
+// schedulingFailures returns the latest FailedScheduling event message per pod.
+// Events are best effort: when they cannot be listed the pod conditions still explain the failure.
+func schedulingFailures(ctx context.Context, clientset kubernetes.Interface, namespace string) map[string]string {
+	failures := map[string]string{}
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("reason", "FailedScheduling"),
+			fields.OneTermEqualSelector("involvedObject.kind", "Pod"),
+		).String(),
+	})
+	if err != nil {
+		debugLog("health: cannot list scheduling events: %v", err)
+		return failures
+	}
+	latest := map[string]time.Time{}
+	for _, e := range events.Items {
+		key := e.InvolvedObject.Namespace + "/" + e.InvolvedObject.Name
+		when := e.LastTimestamp.Time
+		if when.IsZero() {
+			when = e.EventTime.Time
+		}
+		if _, ok := failures[key]; !ok || when.After(latest[key]) {
+			failures[key] = e.Message
+			latest[key] = when
+		}
+	}
+	return failures
+}
+
+// pageParams reads limit/offset query parameters; limit is capped at maxPageLimit
+func pageParams(c *gin.Context) (int, int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultIssueLimit
+	}
+	limit = min(limit, maxPageLimit)
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// paginate returns the bounds of the requested page of total items and its pagination
+// object; the bounds never overflow, whatever offset the caller sent
+func paginate(c *gin.Context, total int) (start, end int, pagination gin.H) {
+	limit, offset := pageParams(c)
+	start = min(offset, total)
+	end = start + min(limit, total-start)
+	pagination = gin.H{"total": total, "offset": offset, "limit": limit}
+	if end < total {
+		pagination["nextOffset"] = end
+	}
+	return start, end, pagination
+}
+
+// healthNamespaces splits the namespace parameter ("a,b,c"); empty means every namespace
+func healthNamespaces(raw string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(raw, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns != "" && !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return namespaces
+}
+
+// listHealthPods lists pods namespace by namespace in pages of pageSize, following Continue tokens.
+// Namespaces the caller may not list are returned as forbidden; it fails only when every namespace is forbidden.
+func listHealthPods(ctx context.Context, clientset kubernetes.Interface, namespaces []string, pageSize int64) ([]corev1.Pod, []string, error) {
+	var pods []corev1.Pod
+	forbidden := []string{}
+	var lastForbidden error
+	for _, ns := range namespaces {
+		opts := metav1.ListOptions{Limit: pageSize}
+		for {
+			page, err := clientset.CoreV1().Pods(ns).List(ctx, opts)
+			if apierrors.IsForbidden(err) {
+				forbidden = append(forbidden, ns)
+				lastForbidden = err
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			pods = append(pods, page.Items...)
+			if page.Continue == "" {
+				break
+			}
+			opts.Continue = page.Continue
+		}
+	}
+	if len(forbidden) == len(namespaces) {
+		return nil, forbidden, lastForbidden
+	}
+	return pods, forbidden, nil
+}
+
+// getClusterHealth returns node status, ranked pod issues and resource usage for a context
+func getClusterHealth(c *gin.Context) {
+	ctxName := c.Query("context")
+	namespace := c.Query("namespace")
+
+	restConfig, _, err := createRestConfig(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create Kubernetes client: " + err.Error()})
+		return
+	}
+	metricsClient, err := metricsclient.NewForConfig(restConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create metrics client: " + err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	namespaces := healthNamespaces(namespace)
+
+	pods, forbidden, err := listHealthPods(ctx, clientset, namespaces, healthPageSize)
+	if err != nil {
+		c.JSON(statusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Namespace-scoped users usually cannot list nodes; report pods alone rather than failing
+	var nodeItems []corev1.Node
+	nodesForbidden := false
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	switch {
+	case apierrors.IsForbidden(err):
+		nodesForbidden = true
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	default:
+		nodeItems = nodes.Items
+	}
+
+	readable := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if !slices.Contains(forbidden, ns) {
+			readable = append(readable, ns)
+		}
+	}
+	usage := collectUsage(ctx, metricsClient, nodeItems, pods, readable, parseTopPods(c.Query("top")))
+
+	nodeList := make([]nodeHealth, 0, len(nodeItems))
+	for _, n := range nodeItems {
+		h := buildNodeHealth(n)
+		if u, ok := usage.Nodes[n.Name]; ok {
+			h.Usage = &u
+		}
+		nodeList = append(nodeList, h)
+	}
+
+	failures := map[string]string{}
+	for _, ns := range readable {
+		for pod, msg := range schedulingFailures(ctx, clientset, ns) {
+			failures[pod] = msg
+		}
+	}
+	now := time.Now()
+	issues := []podIssue{}
+	podSummary := map[string]int{}
+	for _, p := range pods {
+		podSummary[string(p.Status.Phase)]++
+		if issue := classifyPodIssue(p, failures, now); issue != nil {
+			issues = append(issues, *issue)
+		}
+	}
+	rankIssues(issues)
+
+	severities := map[string]int{}
+	for _, issue := range issues {
+		severities[issue.Severity]++
+	}
+	start, end, pagination := paginate(c, len(issues))
+	page := issues[start:end]
+
+	c.JSON(http.StatusOK, gin.H{
+		"nodes":           nodeList,
+		"podSummary":      podSummary,
+		"issues":          page,
+		"issueSummary":    severities,
+		"issuePagination": pagination,
+		"metrics":         usage,
+		"namespaces":      namespaces,
+		"partial":         nodesForbidden || len(forbidden) > 0,
+		"forbidden":       forbidden,
+		"nodesForbidden":  nodesForbidden,
+	})
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Collector interval; the collector only runs when this is set
+var healthHistoryInterval = envDuration("STERN_UI_HEALTH_HISTORY_INTERVAL", 0)
+
+// Snapshots older than this are pruned
+var healthHistoryRetention = envDuration("STERN_UI_HEALTH_HISTORY_RETENTION", 7*24*time.Hour)
+
+// Maximum points returned by the history endpoint; longer windows are downsampled
+const maxHistoryPoints = 500
+
+var healthHistoryBucket = []byte("health_history")
+
+// healthSnapshot is a compact, storable summary of getClusterHealth at one point in time
+type healthSnapshot struct {
+	Time           time.Time      `json:"time"`
+	Nodes          int            `json:"nodes"`
+	NotReadyNodes  int            `json:"notReadyNodes"`
+	Pods           int            `json:"pods"`
+	PodPhases      map[string]int `json:"podPhases"`
+	Restarts       int64          `json:"restarts"`
+	Issues         int            `json:"issues"`
+	CriticalIssues int            `json:"criticalIssues"`
+}
+
+// takeSnapshot summarizes the cluster the way getClusterHealth sees it
+func takeSnapshot(ctx context.Context, clientset kubernetes.Interface, now time.Time) (healthSnapshot, error) {
+	snap := healthSnapshot{Time: now, PodPhases: map[string]int{}}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return snap, err
+	}
+	snap.Nodes = len(nodes.Items)
+	for _, n := range nodes.Items {
+		if !nodeReady(n) {
+			snap.NotReadyNodes++
+		}
+	}
+
+	pods, _, err := listHealthPods(ctx, clientset, []string{metav1.NamespaceAll}, healthPageSize)
+	if err != nil {
+		return snap, err
+	}
+	snap.Pods = len(pods)
+	for _, p := range pods {
+		snap.PodPhases[string(p.Status.Phase)]++
+		for _, cs := range p.Status.ContainerStatuses {
+			snap.Restarts += int64(cs.RestartCount)
+		}
+		if issue := classifyPodIssue(p, nil, now); issue != nil {
+			snap.Issues++
+			if issue.Severity == severityCritical {
+				snap.CriticalIssues++
+			}
+		}
+	}
+	return snap, nil
+}
+
+// recordSnapshot stores a snapshot under its context and drops snapshots older than retention
+func recordSnapshot(db *bolt.DB, contextName string, snap healthSnapshot, retention time.Duration) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists(healthHistoryBucket)
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(contextName))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(timeKey(snap.Time), data); err != nil {
+			return err
+		}
+		cutoff := timeKey(snap.Time.Add(-retention))
+		// Collect first: deleting through a cursor while iterating skips keys
+		var expired [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadSnapshots returns the snapshots of a context recorded at or after since (all when zero), oldest first
+func loadSnapshots(db *bolt.DB, contextName string, since time.Time) ([]healthSnapshot, error) {
+	snaps := []healthSnapshot{}
+	err := db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(healthHistoryBucket)
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket([]byte(contextName))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(timeKey(since))
+		}
+		for ; k != nil; k, v = c.Next() {
+			var snap healthSnapshot
+			if err := json.Unmarshal(v, &snap); err != nil {
+				return fmt.Errorf("corrupt snapshot at %s: %w", keyTime(k), err)
+			}
+			snaps = append(snaps, snap)
+		}
+		return nil
+	})
+	return snaps, err
+}
+
+// downsample keeps at most n evenly spaced snapshots, always including the last one
+func downsample(snaps []healthSnapshot, n int) []healthSnapshot {
+	if len(snaps) <= n {
+		return snaps
+	}
+	out := make([]healthSnapshot, 0, n)
+	step := float64(len(snaps)-1) / float64(n-1)
+	for i := 0; i < n; i++ {
+		out = append(out, snaps[int(float64(i)*step+0.5)])
+	}
+	return out
+}
+
+// seriesTrend summarizes one numeric series over the window
+type seriesTrend struct {
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Delta int64 `json:"delta"`
+	// Increase sums only upward steps, so restarts of deleted pods do not hide new ones
+	Increase int64 `json:"increase"`
+}
+
+func trendOf(snaps []healthSnapshot, value func(healthSnapshot) int64) seriesTrend {
+	var t seriesTrend
+	for i, s := range snaps {
+		v := value(s)
+		if i == 0 {
+			t = seriesTrend{First: v, Min: v, Max: v}
+		} else if prev := value(snaps[i-1]); v > prev {
+			t.Increase += v - prev
+		}
+		t.Min, t.Max, t.Last = min(t.Min, v), max(t.Max, v), v
+	}
+	t.Delta = t.Last - t.First
+	return t
+}
+
+// healthTrends computes the trends the history endpoint reports
+func healthTrends(snaps []healthSnapshot) gin.H {
+	phases := map[string]seriesTrend{}
+	for _, s := range snaps {
+		for phase := range s.PodPhases {
+			if _, ok := phases[phase]; !ok {
+				phases[phase] = trendOf(snaps, func(s healthSnapshot) int64 { return int64(s.PodPhases[phase]) })
+			}
+		}
+	}
+	return gin.H{
+		"restarts":       trendOf(snaps, func(s healthSnapshot) int64 { return s.Restarts }),
+		"notReadyNodes":  trendOf(snaps, func(s healthSnapshot) int64 { return int64(s.NotReadyNodes) }),
+		"issues":         trendOf(snaps, func(s healthSnapshot) int64 { return int64(s.Issues) }),
+		"criticalIssues": trendOf(snaps, func(s healthSnapshot) int64 { return int64(s.CriticalIssues) }),
+		"podPhases":      phases,
+	}
+}
+
+// currentContextName resolves an empty context parameter to the kubeconfig's current context
+func currentContextName(contextName string) string {
+	if contextName != "" {
+		return contextName
+	}
+	raw, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// healthHistoryContexts lists the contexts the collector records, from STERN_UI_HEALTH_HISTORY_CONTEXTS
+func healthHistoryContexts() []string {
+	var contexts []string
+	for _, name := range strings.Split(os.Getenv("STERN_UI_HEALTH_HISTORY_CONTEXTS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			contexts = append(contexts, name)
+		}
+	}
+	if len(contexts) == 0 {
+		contexts = append(contexts, currentContextName(""))
+	}
+	return contexts
+}
+
+// startHealthCollector records a snapshot per context every healthHistoryInterval
+func startHealthCollector() {
+	if healthHistoryInterval <= 0 {
+		return
+	}
+	db, err := openStore()
+	if err != nil {
+		log.Printf("[WARN] health history disabled: %v", err)
+		return
+	}
+	contexts := healthHistoryContexts()
+	log.Printf("[INFO] recording health history every %s for %s", healthHistoryInterval, strings.Join(contexts, ", "))
+
+	collect := func() {
+		for _, name := range contexts {
+			clientset, _, err := createKubeClient(name, nil)
+			if err != nil {
+				log.Printf("[WARN] health history %s: %v", name, err)
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), healthHistoryInterval)
+			snap, err := takeSnapshot(ctx, clientset, time.Now())
+			cancel()
+			if err == nil {
+				err = recordSnapshot(db, name, snap, healthHistoryRetention)
+			}
+			if err != nil {
+				log.Printf("[WARN] health history %s: %v", name, err)
+			}
+		}
+	}
+	go func() {
+		collect()
+		for range time.Tick(healthHistoryInterval) {
+			collect()
+		}
+	}()
+}
+
+// getHealthHistory returns recorded snapshots and trends for a context over ?window= (default 24h).
+// Snapshots cover every namespace, so the caller needs the view capability across all of them
+// and, under impersonation, cluster-wide list access to pods and nodes.
+func getHealthHistory(c *gin.Context) {
+	contextName := currentContextName(c.Query("context"))
+	if err := checkPolicy(c, capView, contextName, ""); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+	if !preflightCollectedHealth(c, contextName) {
+		return
+	}
+
+	window := 24 * time.Hour
+	if raw := c.Query("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid window: use a duration such as 1h or 168h"})
+			return
+		}
+		window = d
+	}
+
+	// Without a collector there is nothing to read, so the store is left unopened
+	to := time.Now()
+	snaps := []healthSnapshot{}
+	if healthHistoryInterval > 0 {
+		db, err := openStore()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		snaps, err = loadSnapshots(db, contextName, to.Add(-window))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"context":    contextName,
+		"collecting": healthHistoryInterval > 0,
+		"interval":   healthHistoryInterval.String(),
+		"window":     window.String(),
+		"from":       to.Add(-window),
+		"to":         to,
+		"points":     downsample(snaps, maxHistoryPoints),
+		"trends":     healthTrends(snaps),
+	})
+}
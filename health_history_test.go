@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testStore(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// TestTakeSnapshot verifies restarts, phases and not-ready nodes are counted
+func TestTakeSnapshot(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+				RestartCount: 3,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "prod"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+	)
+
+	snap, err := takeSnapshot(context.Background(), clientset, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, snap.Nodes)
+	assert.Equal(t, 1, snap.NotReadyNodes)
+	assert.Equal(t, int64(3), snap.Restarts)
+	assert.Equal(t, map[string]int{"Running": 1, "Succeeded": 1}, snap.PodPhases)
+	assert.Equal(t, 1, snap.CriticalIssues)
+}
+
+// TestSnapshotStore verifies per-context storage, windowing and retention pruning
+func TestSnapshotStore(t *testing.T) {
+	db := testStore(t)
+	now := time.Now()
+	for i, restarts := range []int64{1, 5, 2, 4} {
+		snap := healthSnapshot{Time: now.Add(time.Duration(i-3) * time.Hour), Restarts: restarts, PodPhases: map[string]int{"Running": i}}
+		require.NoError(t, recordSnapshot(db, "prod", snap, 24*time.Hour))
+	}
+	require.NoError(t, recordSnapshot(db, "staging", healthSnapshot{Time: now}, 24*time.Hour))
+
+	snaps, err := loadSnapshots(db, "prod", now.Add(-150*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, snaps, 3)
+	assert.Equal(t, int64(5), snaps[0].Restarts)
+
+	trends := healthTrends(snaps)
+	assert.Equal(t, seriesTrend{First: 5, Last: 4, Min: 2, Max: 5, Delta: -1, Increase: 2}, trends["restarts"])
+	assert.Equal(t, int64(3), trends["podPhases"].(map[string]seriesTrend)["Running"].Last)
+
+	// A snapshot a day later prunes everything older than the retention
+	require.NoError(t, recordSnapshot(db, "prod", healthSnapshot{Time: now.Add(23 * time.Hour)}, 24*time.Hour))
+	snaps, err = loadSnapshots(db, "prod", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, snaps, 3)
+
+	snaps, err = loadSnapshots(db, "unknown", time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
+}
+
+// TestDownsample verifies long windows are thinned evenly and keep the latest point
+func TestDownsample(t *testing.T) {
+	snaps := make([]healthSnapshot, 10)
+	for i := range snaps {
+		snaps[i].Restarts = int64(i)
+	}
+	out := downsample(snaps, 4)
+	require.Len(t, out, 4)
+	assert.Equal(t, int64(0), out[0].Restarts)
+	assert.Equal(t, int64(9), out[3].Restarts)
+}
+
+// TestHealthHistoryRejectsBadWindow verifies the window parameter is validated
+func TestHealthHistoryRejectsBadWindow(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/api/clusters/health/history?context=minikube&window=yesterday", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestHealthHistoryDisabled verifies an empty answer when no interval is configured
+func TestHealthHistoryDisabled(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/api/clusters/health/history?context=minikube", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var body struct {
+		Collecting bool              `json:"collecting"`
+		Points     []json.RawMessage `json:"points"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.False(t, body.Collecting)
+	assert.NotNil(t, body.Points)
+	assert.Empty(t, body.Points)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestBuildNodeHealth verifies pressure conditions, taints and cordon state are reported
+func TestBuildNodeHealth(t *testing.T) {
+	h := buildNodeHealth(corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+		Spec: corev1.NodeSpec{
+			Unschedulable: true,
+			Taints:        []corev1.Taint{{Key: "node.kubernetes.io/disk-pressure", Effect: corev1.TaintEffectNoSchedule}},
+		},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+			{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse},
+			{Type: corev1.NodeDiskPressure, Status: corev1.ConditionTrue, Reason: "KubeletHasDiskPressure"},
+		}},
+	})
+
+	assert.True(t, h.Ready)
+	assert.True(t, h.Unschedulable)
+	assert.Equal(t, []string{"DiskPressure"}, h.Pressure)
+	assert.Len(t, h.Conditions, 3)
+	assert.Equal(t, "KubeletHasDiskPressure", h.Conditions[2].Reason)
+	assert.Equal(t, "node.kubernetes.io/disk-pressure", h.Taints[0].Key)
+}
+
+// TestClassifyPodIssue verifies reasons, scheduling failures and severities
+func TestClassifyPodIssue(t *testing.T) {
+	now := time.Now()
+	created := metav1.NewTime(now.Add(-time.Hour))
+
+	assert.Nil(t, classifyPodIssue(corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}, nil, now))
+
+	crash := classifyPodIssue(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", CreationTimestamp: created},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, ContainerStatuses: []corev1.ContainerStatus{{
+			RestartCount: 4,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}},
+	}, nil, now)
+	require.NotNil(t, crash)
+	assert.Equal(t, "CrashLoopBackOff", crash.Reason)
+	assert.Equal(t, severityCritical, crash.Severity)
+	assert.Equal(t, int32(4), crash.Restarts)
+	assert.Equal(t, "1h0m0s", crash.Age)
+
+	pending := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "big", Namespace: "prod", CreationTimestamp: created},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	}
+	issue := classifyPodIssue(pending, nil, now)
+	assert.Equal(t, "Pending", issue.Reason)
+	assert.Equal(t, severityWarning, issue.Severity)
+
+	issue = classifyPodIssue(pending, map[string]string{"prod/big": "0/3 nodes are available: 3 Insufficient memory."}, now)
+	assert.Equal(t, "FailedScheduling", issue.Reason)
+	assert.Equal(t, "0/3 nodes are available: 3 Insufficient memory.", issue.Message)
+	assert.Equal(t, severityCritical, issue.Severity)
+
+	evicted := classifyPodIssue(corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "low on memory"}}, nil, now)
+	assert.Equal(t, "Evicted", evicted.Reason)
+	assert.Equal(t, "low on memory", evicted.Message)
+}
+
+// TestRankIssues verifies severity beats recency and recent issues come first
+func TestRankIssues(t *testing.T) {
+	now := time.Now()
+	issues := []podIssue{
+		{Name: "old-warning", Severity: severityWarning, Since: now.Add(-time.Hour)},
+		{Name: "old-critical", Severity: severityCritical, Since: now.Add(-time.Hour)},
+		{Name: "new-warning", Severity: severityWarning, Since: now},
+		{Name: "new-critical", Severity: severityCritical, Since: now},
+	}
+	rankIssues(issues)
+
+	var names []string
+	for _, i := range issues {
+		names = append(names, i.Name)
+	}
+	assert.Equal(t, []string{"new-critical", "old-critical", "new-warning", "old-warning"}, names)
+}
+
+// TestSchedulingFailures verifies the latest FailedScheduling event wins per pod
+func TestSchedulingFailures(t *testing.T) {
+	now := time.Now()
+	event := func(name, msg string, at time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "prod"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "prod", Name: "big"},
+			Reason:         "FailedScheduling",
+			Message:        msg,
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+	clientset := fake.NewClientset(
+		event("e1", "old", now.Add(-time.Minute)),
+		event("e2", "new", now),
+	)
+
+	failures := schedulingFailures(context.Background(), clientset, "prod")
+	assert.Equal(t, map[string]string{"prod/big": "new"}, failures)
+}
+
+// TestHealthNamespaces verifies the namespace parameter accepts a comma-separated set
+func TestHealthNamespaces(t *testing.T) {
+	assert.Equal(t, []string{""}, healthNamespaces(""))
+	assert.Equal(t, []string{"a", "b"}, healthNamespaces(" a, b,,a "))
+}
+
+// TestListHealthPods verifies paging with Continue and partial results for forbidden namespaces
+func TestListHealthPods(t *testing.T) {
+	clientset := fake.NewClientset()
+	var calls []metav1.ListOptions
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		list := action.(k8stesting.ListActionImpl)
+		calls = append(calls, list.ListOptions)
+		switch {
+		case list.GetNamespace() == "secret-team":
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+		case list.ListOptions.Continue == "":
+			return true, &corev1.PodList{
+				ListMeta: metav1.ListMeta{Continue: "page-2"},
+				Items:    []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "prod"}}},
+			}, nil
+		default:
+			return true, &corev1.PodList{Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "prod"}}}}, nil
+		}
+	})
+	ctx := context.Background()
+
+	pods, forbidden, err := listHealthPods(ctx, clientset, []string{"prod", "secret-team"}, 1)
+	require.NoError(t, err)
+	assert.Len(t, pods, 2)
+	assert.Equal(t, []string{"secret-team"}, forbidden)
+	assert.Equal(t, int64(1), calls[0].Limit)
+	assert.Equal(t, "page-2", calls[1].Continue)
+
+	_, _, err = listHealthPods(ctx, clientset, []string{"secret-team"}, 1)
+	assert.True(t, apierrors.IsForbidden(err))
+}
+
+// TestPaginate verifies page bounds, the limit cap and offsets that would overflow
+func TestPaginate(t *testing.T) {
+	page := func(query string, total int) (int, int, gin.H) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?"+query, nil)
+		return paginate(c, total)
+	}
+
+	start, end, pagination := page("limit=2&offset=1", 5)
+	assert.Equal(t, []int{1, 3}, []int{start, end})
+	assert.Equal(t, gin.H{"total": 5, "offset": 1, "limit": 2, "nextOffset": 3}, pagination)
+
+	start, end, pagination = page("", 3)
+	assert.Equal(t, []int{0, 3}, []int{start, end})
+	assert.NotContains(t, pagination, "nextOffset")
+
+	start, end, pagination = page("limit=9223372036854775807&offset=1", 5)
+	assert.Equal(t, []int{1, 5}, []int{start, end})
+	assert.Equal(t, maxPageLimit, pagination["limit"])
+
+	start, end, _ = page("limit=10&offset=9223372036854775807", 5)
+	assert.Equal(t, []int{5, 5}, []int{start, end})
+}
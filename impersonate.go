@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+// With STERN_UI_IMPERSONATE=true, cluster requests made for a logged-in user impersonate that
+// user and their groups, so the cluster's RBAC applies per user. Background work (alert rules,
+// the log recorder, health history) still runs as stern-ui's own identity.
+var impersonateUsers = os.Getenv("STERN_UI_IMPERSONATE") == "true"
+
+// Names the API server reserves for its own identities; impersonating them could grant
+// system:masters and friends to whoever controls a token file or an identity provider claim
+const reservedIdentityPrefix = "system:"
+
+// Maximum 403 response body inspected for impersonation failures
+const maxForbiddenBody = 64 << 10
+
+var errImpersonationRequiresAuth = errors.New("STERN_UI_IMPERSONATE=true requires authentication (STERN_UI_AUTH_TOKENS_FILE, STERN_UI_AUTH_HTPASSWD or STERN_UI_OIDC_ISSUER)")
+
+// impersonationConfig returns who to impersonate for user; groups under system: are dropped
+// (the API server adds system:authenticated itself)
+func impersonationConfig(user *authUser) (rest.ImpersonationConfig, error) {
+	if !impersonateUsers || user == nil {
+		return rest.ImpersonationConfig{}, nil
+	}
+	if strings.HasPrefix(user.Name, reservedIdentityPrefix) {
+		return rest.ImpersonationConfig{}, fmt.Errorf("refusing to impersonate reserved user %q", user.Name)
+	}
+	config := rest.ImpersonationConfig{UserName: user.Name}
+	for _, group := range user.Groups {
+		if !strings.HasPrefix(group, reservedIdentityPrefix) {
+			config.Groups = append(config.Groups, group)
+		}
+	}
+	return config, nil
+}
+
+// impersonate makes restConfig act as user and explains impersonation failures
+func impersonate(restConfig *rest.Config, user *authUser) error {
+	config, err := impersonationConfig(user)
+	if err != nil || config.UserName == "" {
+		return err
+	}
+	restConfig.Impersonate = config
+	restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &impersonationTransport{next: rt, user: config.UserName}
+	})
+	return nil
+}
+
+// impersonationHint explains a "cannot impersonate" refusal, which otherwise reads as if the
+// user lacked a permission when it is stern-ui's own identity that does
+func impersonationHint(user, message string) string {
+	return fmt.Sprintf("stern-ui cannot impersonate %q: %s. Grant the identity in stern-ui's kubeconfig the impersonate verb on users and groups (ClusterRole rule: apiGroups [\"\"], resources [users, groups], verbs [impersonate])", user, message)
+}
+
+// impersonationTransport rewrites 403 responses caused by the impersonation itself
+type impersonationTransport struct {
+	next http.RoundTripper
+	user string
+}
+
+func (t *impersonationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxForbiddenBody))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var status metav1.Status
+	if json.Unmarshal(body, &status) != nil || !strings.Contains(status.Message, "cannot impersonate") {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	status.Message = impersonationHint(t.user, status.Message)
+	body, _ = json.Marshal(status)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// kubectlOutput runs kubectl with args as the caller, impersonating them like createKubeClient
+func kubectlOutput(c *gin.Context, args ...string) ([]byte, error) {
+	config, err := impersonationConfig(currentUser(c))
+	if err != nil {
+		return nil, err
+	}
+	if config.UserName != "" {
+		impersonation := []string{"--as", config.UserName}
+		for _, group := range config.Groups {
+			impersonation = append(impersonation, "--as-group", group)
+		}
+		args = append(impersonation, args...)
+	}
+	output, err := exec.Command("kubectl", args...).CombinedOutput()
+	if err != nil && config.UserName != "" && bytes.Contains(output, []byte("cannot impersonate")) {
+		return output, errors.New(impersonationHint(config.UserName, strings.TrimSpace(string(output))))
+	}
+	return output, err
+}
+
+// preflightCollectedLogs checks the caller's own RBAC before serving or forwarding logs that
+// stern-ui reads with its own identity: the archive, search, recordings and alert rules.
+// Without impersonation the caller acts as stern-ui anyway, so there is nothing to check.
+func preflightCollectedLogs(c *gin.Context, contextName string, namespaces []string) bool {
+	if !impersonateUsers {
+		return true
+	}
+	return preflight(c, contextName, logAccessChecks(namespaces)...)
+}
+
+// preflightCollectedHealth is preflightCollectedLogs for health history, which stern-ui records
+// across the whole cluster: the caller must be able to list pods and nodes at cluster scope.
+func preflightCollectedHealth(c *gin.Context, contextName string) bool {
+	if !impersonateUsers {
+		return true
+	}
+	return preflight(c, contextName,
+		authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods"},
+		authorizationv1.ResourceAttributes{Verb: "list", Resource: "nodes"},
+	)
+}
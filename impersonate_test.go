@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+func enableImpersonation(t *testing.T) {
+	impersonateUsers = true
+	t.Cleanup(func() { impersonateUsers = false })
+}
+
+// TestImpersonationConfig verifies who is impersonated and that reserved identities are not
+func TestImpersonationConfig(t *testing.T) {
+	alice := &authUser{Name: "alice", Groups: []string{"dev", "system:masters"}}
+	config, err := impersonationConfig(alice)
+	require.NoError(t, err)
+	assert.Empty(t, config.UserName, "off unless STERN_UI_IMPERSONATE=true")
+
+	enableImpersonation(t)
+	config, err = impersonationConfig(alice)
+	require.NoError(t, err)
+	assert.Equal(t, rest.ImpersonationConfig{UserName: "alice", Groups: []string{"dev"}}, config)
+
+	config, err = impersonationConfig(nil)
+	require.NoError(t, err)
+	assert.Empty(t, config.UserName, "background work runs as stern-ui")
+
+	_, err = impersonationConfig(&authUser{Name: "system:admin"})
+	assert.EqualError(t, err, `refusing to impersonate reserved user "system:admin"`)
+}
+
+// TestImpersonatedClient verifies the impersonation headers and that a refused impersonation
+// names stern-ui's missing permission while other 403s pass through
+func TestImpersonatedClient(t *testing.T) {
+	enableImpersonation(t)
+	var user string
+	var groups []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, groups = r.Header.Get("Impersonate-User"), r.Header.Values("Impersonate-Group")
+		message := `pods is forbidden: User "alice" cannot list resource "pods" in API group "" in the namespace "shop"`
+		if r.URL.Path == "/api/v1/namespaces/kube-system/pods" {
+			message = `users "alice" is forbidden: User "system:serviceaccount:ops:stern-ui" cannot impersonate resource "users" in API group "" at the cluster scope`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonForbidden,
+			Code:     http.StatusForbidden,
+			Message:  message,
+		})
+	}))
+	defer server.Close()
+
+	restConfig := &rest.Config{Host: server.URL}
+	require.NoError(t, impersonate(restConfig, &authUser{Name: "alice", Groups: []string{"dev"}}))
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	require.NoError(t, err)
+
+	_, err = clientset.CoreV1().Pods("shop").List(context.Background(), metav1.ListOptions{})
+	assert.EqualError(t, err, `pods is forbidden: User "alice" cannot list resource "pods" in API group "" in the namespace "shop"`)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, []string{"dev"}, groups)
+
+	_, err = clientset.CoreV1().Pods("kube-system").List(context.Background(), metav1.ListOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `stern-ui cannot impersonate "alice"`)
+	assert.Contains(t, err.Error(), "verbs [impersonate]")
+}
+
+// TestImpersonationRequiresAuth verifies the server refuses to start impersonating without logins
+func TestImpersonationRequiresAuth(t *testing.T) {
+	enableImpersonation(t)
+	assert.PanicsWithValue(t, errImpersonationRequiresAuth, func() { setupRouter() })
+}
+
+// TestImpersonatedCollectedLogs verifies archived, searched, recorded and alerted logs need the caller's pods/log access
+func TestImpersonatedCollectedLogs(t *testing.T) {
+	enableImpersonation(t)
+	var mu sync.Mutex
+	var reviewers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+		require.NoError(t, err)
+		review := obj.(*authorizationv1.SelfSubjectAccessReview)
+		mu.Lock()
+		reviewers = append(reviewers, r.Header.Get("Impersonate-User"))
+		mu.Unlock()
+		review.Status.Allowed = review.Spec.ResourceAttributes.Subresource != "log"
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(review)
+	}))
+	defer server.Close()
+	useTestCluster(t, server.URL)
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	r := setupRouter()
+
+	db, err := openStore()
+	require.NoError(t, err)
+	recorder, err := startRecording(db, recordingsDir, recordingInfo{ID: "rec-" + randomID(4), Context: "dev", Query: map[string]string{"namespace": "shop"}, StartedAt: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, recorder.close())
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/api/archive/logs?context=dev&namespace=shop", nil),
+		httptest.NewRequest("GET", "/api/logs/search?context=dev&namespace=shop&q=error", nil),
+		httptest.NewRequest("GET", "/ws/replay/"+recorder.info.ID, nil),
+		httptest.NewRequest("POST", "/api/alerts/rules", strings.NewReader(`{"name":"errors","context":"dev","query":{"namespace":"shop"},"condition":{"regex":"error"},"webhooks":["https://hooks.example.com/hook"]}`)),
+	} {
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, req.URL.Path)
+		assert.Contains(t, w.Body.String(), `cannot get pods/log in namespace \"shop\"`, req.URL.Path)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, reviewers)
+	for _, user := range reviewers {
+		assert.Equal(t, "alice", user)
+	}
+}
+
+// TestImpersonatedHealthHistory verifies health history needs the caller's cluster-wide pod and node access
+func TestImpersonatedHealthHistory(t *testing.T) {
+	enableImpersonation(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+		require.NoError(t, err)
+		review := obj.(*authorizationv1.SelfSubjectAccessReview)
+		assert.Equal(t, "alice", r.Header.Get("Impersonate-User"))
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "nodes"
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(review)
+	}))
+	defer server.Close()
+	useTestCluster(t, server.URL)
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	r := setupRouter()
+
+	req := httptest.NewRequest("GET", "/api/clusters/health/history?context=dev", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot list nodes")
+}
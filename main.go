@@ -22,11 +22,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	stern "github.com/stern/stern/stern"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -53,8 +53,9 @@ var upgrader = websocket.Upgrader{
 type WebSocketWriter struct {
 	conn      *websocket.Conn
 	buf       *bytes.Buffer
-	mu        sync.Mutex // Protects concurrent writes to websocket
-	untilTime time.Time  // If set, filters out logs after this time
+	mu        sync.Mutex       // Protects concurrent writes to websocket
+	untilTime time.Time        // If set, filters out logs after this time
+	recorder  *sessionRecorder // If set, every text frame sent is recorded
 }
 
 func (w *WebSocketWriter) Write(p []byte) (n int, err error) {
@@ -108,6 +109,7 @@ func (w *WebSocketWriter) Write(p []byte) (n int, err error) {
 		if err := w.conn.WriteMessage(websocket.TextMessage, line); err != nil {
 			return 0, err
 		}
+		w.recorder.frame(line)
 	}
 	return len(p), nil
 }
@@ -119,7 +121,26 @@ func (w *WebSocketWriter) WriteMessage(messageType int, data []byte) error {
 	if err := w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
 		return err
 	}
-	return w.conn.WriteMessage(messageType, data)
+	if err := w.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	if messageType == websocket.TextMessage {
+		w.recorder.frame(data)
+	}
+	return nil
+}
+
+// WriteError sends an {"error": ...} message, JSON-encoding the text so quotes in
+// Kubernetes error messages do not break the frame
+func (w *WebSocketWriter) WriteError(err error) {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	_ = w.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteWarning sends a {"warning": ...} message about a stream that keeps running
+func (w *WebSocketWriter) WriteWarning(text string) {
+	data, _ := json.Marshal(map[string]string{"warning": text})
+	_ = w.WriteMessage(websocket.TextMessage, data)
 }
 
 type streamParams struct {
@@ -146,37 +167,46 @@ type streamParams struct {
 	timeRangeMode       string
 	sinceTime           string
 	untilTime           string
+	workload            string
 }
 
-func parseStreamParams(c *gin.Context) streamParams {
+// streamParamsFrom reads the /ws/logs parameters through get, a query lookup or a saved query
+func streamParamsFrom(get func(string) string) streamParams {
 	return streamParams{
-		namespace:           c.Query("namespace"),
-		selector:            c.Query("selector"),
-		query:               c.Query("query"),
-		since:               c.Query("since"),
-		container:           c.Query("container"),
-		excludeContainer:    c.Query("excludeContainer"),
-		excludePod:          c.Query("excludePod"),
-		containerState:      c.Query("containerState"),
-		include:             c.Query("include"),
-		exclude:             c.Query("exclude"),
-		highlight:           c.Query("highlight"),
-		tail:                c.Query("tail"),
-		node:                c.Query("node"),
-		allNamespaces:       c.Query("allNamespaces"),
-		initContainers:      c.Query("initContainers"),
-		ephemeralContainers: c.Query("ephemeralContainers"),
-		timestamps:          c.Query("timestamps"),
-		noFollow:            c.Query("noFollow"),
-		contextName:         c.Query("context"),
-		maxLogRequests:      c.Query("maxLogRequests"),
-		timeRangeMode:       c.Query("timeRangeMode"),
-		sinceTime:           c.Query("sinceTime"),
-		untilTime:           c.Query("untilTime"),
+		namespace:           get("namespace"),
+		selector:            get("selector"),
+		query:               get("query"),
+		since:               get("since"),
+		container:           get("container"),
+		excludeContainer:    get("excludeContainer"),
+		excludePod:          get("excludePod"),
+		containerState:      get("containerState"),
+		include:             get("include"),
+		exclude:             get("exclude"),
+		highlight:           get("highlight"),
+		tail:                get("tail"),
+		node:                get("node"),
+		allNamespaces:       get("allNamespaces"),
+		initContainers:      get("initContainers"),
+		ephemeralContainers: get("ephemeralContainers"),
+		timestamps:          get("timestamps"),
+		noFollow:            get("noFollow"),
+		contextName:         get("context"),
+		maxLogRequests:      get("maxLogRequests"),
+		timeRangeMode:       get("timeRangeMode"),
+		sinceTime:           get("sinceTime"),
+		untilTime:           get("untilTime"),
+		workload:            get("workload"),
 	}
 }
 
-func createKubeClient(contextName string) (kubernetes.Interface, clientcmd.ClientConfig, error) {
+func parseStreamParams(c *gin.Context) streamParams {
+	return streamParamsFrom(c.Query)
+}
+
+// createRestConfig loads the kubeconfig for a context (current context when empty). With
+// STERN_UI_IMPERSONATE=true, requests impersonate user; nil acts as stern-ui itself.
+func createRestConfig(contextName string, user *authUser) (*rest.Config, clientcmd.ClientConfig, error) {
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	configOverrides := &clientcmd.ConfigOverrides{}
 	if contextName != "" {
@@ -195,6 +225,18 @@ func createKubeClient(contextName string) (kubernetes.Interface, clientcmd.Clien
 		restConfig.ExecProvider.InstallHint = ""
 	}
 
+	if err := impersonate(restConfig, user); err != nil {
+		return nil, nil, err
+	}
+	return restConfig, kubeConfig, nil
+}
+
+func createKubeClient(contextName string, user *authUser) (kubernetes.Interface, clientcmd.ClientConfig, error) {
+	restConfig, kubeConfig, err := createRestConfig(contextName, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
@@ -358,6 +400,7 @@ func parseRegexFilters(params streamParams) (*regexp.Regexp, *regexp.Regexp, []*
 	debugLog("  since: %q", params.since)
 	debugLog("  tail: %s", params.tail)
 	debugLog("  allNamespaces: %q", params.allNamespaces)
+	debugLog("  workload: %q", params.workload)
 	debugLog("========================")
 
 	// Handle query regex - if container has pod/container format, extract pod name for query
@@ -463,7 +506,7 @@ type sternConfigParams struct {
 	highlightRegexes        []*regexp.Regexp
 	excludeContainerRegexes []*regexp.Regexp
 	excludePodRegexes       []*regexp.Regexp
-	writer                  *WebSocketWriter
+	writer                  io.Writer
 	untilTime               time.Time
 }
 
@@ -498,12 +541,167 @@ func buildSternConfig(cfg sternConfigParams) *stern.Config {
 	}
 }
 
-func setupWebSocketHandlers(conn *websocket.Conn, ctx context.Context, cancel context.CancelFunc, writer *WebSocketWriter) {
-	const (
-		pongWait   = 60 * time.Second
-		pingPeriod = 30 * time.Second
-	)
+// sternSession is a stern configuration resolved from stream parameters
+type sternSession struct {
+	config     *stern.Config
+	namespaces []string
+	untilTime  time.Time
+	warning    string // the stream may miss pods, e.g. later runs of a CronJob
+}
+
+// prepareSternSession resolves stream parameters (namespaces, selectors, workload, regex filters,
+// time range) into a stern configuration writing to out. It serves /ws/logs and headless sessions.
+func prepareSternSession(ctx context.Context, clientset kubernetes.Interface, kubeConfig clientcmd.ClientConfig, params streamParams, out io.Writer) (*sternSession, error) {
+	tailLines, sinceDuration, maxReq := parseNumericParams(params)
+	namespaces := buildNamespaceList(params, kubeConfig)
+
+	labelSelector, fieldSelector, err := parseSelectors(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow the selector to the pods of a workload (deployment/foo, service/bar, ...)
+	var warning string
+	if params.workload != "" {
+		if params.allNamespaces == "true" {
+			return nil, fmt.Errorf("workload requires a single namespace")
+		}
+		var workloadSelector labels.Selector
+		workloadSelector, warning, err = resolveWorkloadSelector(ctx, clientset, namespaces[0], params.workload)
+		if err != nil {
+			return nil, err
+		}
+		labelSelector = mergeSelectors(labelSelector, workloadSelector)
+	}
+
+	containerStates := parseContainerStates(params.containerState)
+
+	queryRegex, containerRegex, includeRegexes, excludeRegexes, highlightRegexes, excludeContainerRegexes, excludePodRegexes, err := parseRegexFilters(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse untilTime if provided
+	var untilTime time.Time
+	if params.timeRangeMode == "absolute" && params.untilTime != "" {
+		parsedTime, err := time.Parse("2006-01-02T15:04", params.untilTime)
+		if err == nil {
+			untilTime = parsedTime
+			// Automatically disable follow mode when untilTime is set
+			// This ensures stern stops after reaching the end time
+			params.noFollow = "true"
+		}
+	}
+
+	config := buildSternConfig(sternConfigParams{
+		params:                  params,
+		namespaces:              namespaces,
+		labelSelector:           labelSelector,
+		fieldSelector:           fieldSelector,
+		tailLines:               tailLines,
+		sinceDuration:           sinceDuration,
+		maxReq:                  maxReq,
+		containerStates:         containerStates,
+		queryRegex:              queryRegex,
+		containerRegex:          containerRegex,
+		includeRegexes:          includeRegexes,
+		excludeRegexes:          excludeRegexes,
+		highlightRegexes:        highlightRegexes,
+		excludeContainerRegexes: excludeContainerRegexes,
+		excludePodRegexes:       excludePodRegexes,
+		writer:                  out,
+		untilTime:               untilTime,
+	})
+	return &sternSession{config: config, namespaces: namespaces, untilTime: untilTime, warning: warning}, nil
+}
+
+// lineWriter splits stern output into JSON log lines for a headless session. Stern writes
+// from one goroutine per container, so Write locks to keep lines from interleaving.
+type lineWriter struct {
+	mu     sync.Mutex
+	buf    []byte
+	handle func(logLine) // called under mu
+}
+
+func newLineWriter(handle func(logLine)) *lineWriter {
+	return &lineWriter{handle: handle}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		raw := w.buf[:idx]
+		w.buf = w.buf[idx+1:]
 
+		var line logLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			continue
+		}
+		w.handle(line)
+	}
+	return len(p), nil
+}
+
+// Delay before a failed headless stern session is restarted
+const headlessRetryDelay = 30 * time.Second
+
+// runHeadlessSession keeps a stern session without a browser attached (alert rules, the log
+// recorder) running until ctx ends, restarting it after headlessRetryDelay when it fails.
+// adjust tunes the resolved configuration before every start; report receives nil once the
+// session is streaming and every error.
+func runHeadlessSession(ctx context.Context, name, contextName string, query map[string]string, out io.Writer, adjust func(*stern.Config), report func(error)) {
+	params := streamParamsFrom(func(key string) string { return query[key] })
+	params.contextName = contextName
+
+	for ctx.Err() == nil {
+		err := func() error {
+			clientset, kubeConfig, err := createKubeClient(contextName, nil)
+			if err != nil {
+				return err
+			}
+			session, err := prepareSternSession(ctx, clientset, kubeConfig, params, out)
+			if err != nil {
+				return err
+			}
+			if session.warning != "" {
+				log.Printf("[WARN] %s: %s", name, session.warning)
+			}
+			adjust(session.config)
+			if err := checkAccess(ctx, clientset, logAccessChecks(session.namespaces)...); err != nil {
+				return err
+			}
+			report(nil)
+			return stern.Run(ctx, clientset, session.config)
+		}()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[WARN] %s: %v", name, err)
+			report(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(headlessRetryDelay):
+		}
+	}
+}
+
+// WebSocket keepalive: the server pings every pingPeriod and drops clients silent for pongWait.
+// Browsers answer pings but never send their own.
+var (
+	pongWait   = 60 * time.Second
+	pingPeriod = 30 * time.Second
+)
+
+func setupWebSocketHandlers(conn *websocket.Conn, ctx context.Context, cancel context.CancelFunc, writer *WebSocketWriter) {
 	// Set initial read deadline and pong handler
 	conn.SetPongHandler(func(string) error {
 		return conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -521,21 +719,7 @@ func setupWebSocketHandlers(conn *websocket.Conn, ctx context.Context, cancel co
 	}()
 
 	// Start ping/pong to keep WebSocket alive
-	go func() {
-		ticker := time.NewTicker(pingPeriod)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if err := writer.WriteMessage(websocket.PingMessage, nil); err != nil {
-					cancel()
-					return
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	go pingWebSocket(ctx, cancel, writer)
 
 	// Monitor WebSocket for close from client
 	conn.SetCloseHandler(func(code int, text string) error {
@@ -544,7 +728,24 @@ func setupWebSocketHandlers(conn *websocket.Conn, ctx context.Context, cancel co
 	})
 }
 
-func startCredentialRefresher(ctx context.Context, clientset *kubernetes.Interface, contextName string, clientMutex *sync.Mutex) {
+// pingWebSocket pings the client every pingPeriod until ctx ends, cancelling it when a ping fails
+func pingWebSocket(ctx context.Context, cancel context.CancelFunc, writer *WebSocketWriter) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := writer.WriteMessage(websocket.PingMessage, nil); err != nil {
+				cancel()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func startCredentialRefresher(ctx context.Context, clientset *kubernetes.Interface, contextName string, user *authUser, clientMutex *sync.Mutex) {
 	go func() {
 		ticker := time.NewTicker(30 * time.Minute)
 		defer ticker.Stop()
@@ -552,7 +753,7 @@ func startCredentialRefresher(ctx context.Context, clientset *kubernetes.Interfa
 			select {
 			case <-ticker.C:
 				clientMutex.Lock()
-				newClientset, _, err := createKubeClient(contextName)
+				newClientset, _, err := createKubeClient(contextName, user)
 				if err == nil {
 					*clientset = newClientset
 				}
@@ -565,71 +766,69 @@ func startCredentialRefresher(ctx context.Context, clientset *kubernetes.Interfa
 }
 
 func streamLogs(c *gin.Context) {
-	params := parseStreamParams(c)
+	// A preset that cannot be expanded is reported once the WebSocket is open
+	params, presetErr := resolveStreamParams(c)
+	if presetErr == nil {
+		if err := checkPolicy(c, capLogs, params.contextName, streamNamespaces(params.namespace, params.allNamespaces)...); err != nil {
+			denyPolicy(c, err)
+			return
+		}
+	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// ?record=true writes every frame sent to a recording that /ws/replay/:id plays back; a
+	// session that only reports a preset error is not worth one, nor cleared by the policy
+	var recorder *sessionRecorder
+	if presetErr == nil {
+		var err error
+		if recorder, err = startStreamRecording(c, params.contextName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot record session: " + err.Error()})
+			return
+		}
+	}
+	header := http.Header{}
+	if recorder != nil {
+		defer func() {
+			if err := recorder.close(); err != nil {
+				log.Printf("[WARN] recording %s: %v", recorder.info.ID, err)
+			}
+		}()
+		header.Set(recordingHeader, recorder.info.ID)
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, header)
 	if err != nil {
 		return
 	}
 	defer func() { _ = conn.Close() }()
 
-	writer := &WebSocketWriter{conn: conn, buf: &bytes.Buffer{}}
-
-	clientset, kubeConfig, err := createKubeClient(params.contextName)
-	if err != nil {
-		_ = writer.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"error":"%s"}`, err)))
+	writer := &WebSocketWriter{conn: conn, buf: &bytes.Buffer{}, recorder: recorder}
+	if presetErr != nil {
+		writer.WriteError(presetErr)
 		return
 	}
 
-	tailLines, sinceDuration, maxReq := parseNumericParams(params)
-	namespaces := buildNamespaceList(params, kubeConfig)
-
-	labelSelector, fieldSelector, err := parseSelectors(params)
+	clientset, kubeConfig, err := createKubeClient(params.contextName, currentUser(c))
 	if err != nil {
-		_ = writer.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"error":"%s"}`, err)))
+		writer.WriteError(err)
 		return
 	}
 
-	containerStates := parseContainerStates(params.containerState)
-
-	queryRegex, containerRegex, includeRegexes, excludeRegexes, highlightRegexes, excludeContainerRegexes, excludePodRegexes, err := parseRegexFilters(params)
+	session, err := prepareSternSession(c.Request.Context(), clientset, kubeConfig, params, writer)
 	if err != nil {
-		_ = writer.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"error":"%s"}`, err)))
+		writer.WriteError(err)
 		return
 	}
-
-	// Parse untilTime if provided
-	var untilTime time.Time
-	if params.timeRangeMode == "absolute" && params.untilTime != "" {
-		parsedTime, err := time.Parse("2006-01-02T15:04", params.untilTime)
-		if err == nil {
-			untilTime = parsedTime
-			writer.untilTime = untilTime
-			// Automatically disable follow mode when untilTime is set
-			// This ensures stern stops after reaching the end time
-			params.noFollow = "true"
-		}
+	config, namespaces := session.config, session.namespaces
+	writer.untilTime = session.untilTime
+	if session.warning != "" {
+		writer.WriteWarning(session.warning)
 	}
 
-	config := buildSternConfig(sternConfigParams{
-		params:                  params,
-		namespaces:              namespaces,
-		labelSelector:           labelSelector,
-		fieldSelector:           fieldSelector,
-		tailLines:               tailLines,
-		sinceDuration:           sinceDuration,
-		maxReq:                  maxReq,
-		containerStates:         containerStates,
-		queryRegex:              queryRegex,
-		containerRegex:          containerRegex,
-		includeRegexes:          includeRegexes,
-		excludeRegexes:          excludeRegexes,
-		highlightRegexes:        highlightRegexes,
-		excludeContainerRegexes: excludeContainerRegexes,
-		excludePodRegexes:       excludePodRegexes,
-		writer:                  writer,
-		untilTime:               untilTime,
-	})
+	// Fail early with the exact missing permission instead of a silent empty stream
+	if err := checkAccess(c.Request.Context(), clientset, logAccessChecks(namespaces)...); err != nil {
+		writer.WriteError(err)
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -637,15 +836,18 @@ func streamLogs(c *gin.Context) {
 	setupWebSocketHandlers(conn, ctx, cancel, writer)
 
 	var clientMutex sync.Mutex
-	startCredentialRefresher(ctx, &clientset, params.contextName, &clientMutex)
+	startCredentialRefresher(ctx, &clientset, params.contextName, currentUser(c), &clientMutex)
 
 	if err := stern.Run(ctx, clientset, config); err != nil {
-		_ = writer.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"error":"Stern error: %s"}`, err)))
+		writer.WriteError(fmt.Errorf("Stern error: %w", err))
 	}
 }
 
 func main() {
 	r := newRouter()
+	startHealthCollector()
+	startAlertEngine()
+	startLogArchive()
 
 	fmt.Println("Stern Web UI running on :8080")
 	fmt.Println("Open http://localhost:8080 in your browser")
@@ -658,7 +860,34 @@ func main() {
 func newRouter() *gin.Engine {
 	r := gin.Default()
 
+	authn, err := newAuthenticatorFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	if impersonateUsers && !authn.enabled() {
+		panic(errImpersonationRequiresAuth)
+	}
+	r.Use(authn.middleware)
+	authn.registerRoutes(r)
+
+	policy, err := newPolicyEngineFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	r.Use(policy.middleware)
+
+	features, err := loadFeatures()
+	if err != nil {
+		panic(err)
+	}
+	r.GET("/api/capabilities", features.capabilities)
+	resourceAccess = loadResourcePolicy(features)
+
 	r.GET("/ws/logs", streamLogs)
+	if features.enabled(featureExec) {
+		r.GET("/ws/exec", execContainer)
+	}
+	r.GET("/ws/replay/:id", replayRecording)
 
 	// API endpoints for autocomplete
 	r.GET("/api/namespaces", getNamespaces)
@@ -671,9 +900,55 @@ func newRouter() *gin.Engine {
 	// API endpoints for cluster management
 	r.GET("/api/clusters/events", getClusterEvents)
 	r.GET("/api/clusters/health", getClusterHealth)
-	r.POST("/api/clusters/apply", applyManifest)
+	r.GET("/api/clusters/health/history", getHealthHistory)
+	if features.enabled(featureApply) {
+		r.POST("/api/clusters/apply", applyManifest)
+	}
+	r.GET("/api/clusters/kinds", getResourceKinds)
 	r.GET("/api/clusters/resources", getClusterResources)
 	r.GET("/api/clusters/resource-detail", getResourceDetail)
+	if features.enabled(featureSecrets) {
+		r.POST("/api/clusters/secret-reveal", revealSecretValue)
+	}
+	r.GET("/api/clusters/tree", getClusterTree)
+	r.GET("/api/clusters/can-i", getCanI)
+	if features.enabled(featureActions) {
+		r.POST("/api/clusters/actions", runClusterAction)
+	}
+	if features.enabled(featurePortForward) {
+		r.GET("/api/clusters/port-forwards", listPortForwards)
+		r.POST("/api/clusters/port-forwards", createPortForward)
+		r.DELETE("/api/clusters/port-forwards/:id", deletePortForward)
+	}
+
+	// API endpoints for log alert rules
+	r.GET("/api/alerts/rules", listAlertRules)
+	r.POST("/api/alerts/rules", saveAlertRule)
+	r.PUT("/api/alerts/rules/:id", saveAlertRule)
+	r.DELETE("/api/alerts/rules/:id", deleteAlertRule)
+
+	// API endpoints for the log archive
+	r.GET("/api/archive/streams", getArchiveStreams)
+	r.GET("/api/archive/logs", queryArchive)
+	r.GET("/api/logs/search", searchLogs)
+
+	// API endpoints for saved queries (presets)
+	r.GET("/api/presets", getPresets)
+	r.POST("/api/presets", savePresetHandler)
+	r.GET("/api/presets/:name", getPreset)
+	r.PUT("/api/presets/:name", savePresetHandler)
+	r.DELETE("/api/presets/:name", deletePreset)
+
+	// API endpoints for shareable log views
+	r.POST("/api/share", createShare)
+	r.GET("/api/share/:id", resolveShare)
+
+	// API endpoints for recorded log sessions
+	r.GET("/api/recordings", listRecordings)
+	r.DELETE("/api/recordings/:id", deleteRecording)
+
+	// API endpoints for the audit log
+	r.GET("/api/audit", getAuditEvents)
 
 	// Serve embedded static files from frontend/dist
 	distFS, err := fs.Sub(frontendFS, "frontend/dist")
@@ -723,8 +998,7 @@ func getNamespaces(c *gin.Context) {
 		args = append([]string{"--context", ctx}, args...)
 	}
 
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := kubectlOutput(c, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get namespaces (context=%s): %v, output: %s", ctx, err, string(output))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
@@ -751,8 +1025,7 @@ func getPods(c *gin.Context) {
 		args = append(args, "-n", namespace)
 	}
 
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := kubectlOutput(c, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get pods (context=%s, namespace=%s): %v, output: %s", ctx, namespace, err, string(output))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
@@ -780,8 +1053,7 @@ func getContainers(c *gin.Context) {
 		args = append(args, "-n", namespace)
 	}
 
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := kubectlOutput(c, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get containers (context=%s, namespace=%s): %v, output: %s", ctx, namespace, err, string(output))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
@@ -818,7 +1090,12 @@ func getContexts(c *gin.Context) {
 		return
 	}
 
-	contexts := strings.Fields(string(output))
+	contexts := []string{}
+	for _, name := range strings.Fields(string(output)) {
+		if policyAllowsContext(c, name) {
+			contexts = append(contexts, name)
+		}
+	}
 	c.JSON(http.StatusOK, contexts)
 }
 
@@ -830,8 +1107,7 @@ func getNodes(c *gin.Context) {
 		args = append([]string{"--context", ctx}, args...)
 	}
 
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := kubectlOutput(c, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get nodes (context=%s): %v, output: %s", ctx, err, string(output))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
@@ -864,8 +1140,7 @@ func getPodMetadata(c *gin.Context) {
 	}
 	args = append(args, "-n", namespace)
 
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := kubectlOutput(c, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get pod metadata (context=%s, namespace=%s, pod=%s): %v, output: %s", ctx, namespace, podName, err, string(output))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
@@ -891,7 +1166,7 @@ func getClusterEvents(c *gin.Context) {
 	ctxName := c.Query("context")
 	namespace := c.Query("namespace")
 
-	clientset, _, err := createKubeClient(ctxName)
+	clientset, _, err := createKubeClient(ctxName, currentUser(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -938,273 +1213,3 @@ func getClusterEvents(c *gin.Context) {
 	sort.SliceStable(result, func(i, j int) bool { return result[i].Time > result[j].Time })
 	c.JSON(http.StatusOK, result)
 }
-
-func nodeReady(node corev1.Node) bool {
-	for _, cond := range node.Status.Conditions {
-		if cond.Type == corev1.NodeReady {
-			return cond.Status == corev1.ConditionTrue
-		}
-	}
-	return false
-}
-
-func podIssueReason(pod corev1.Pod) string {
-	if pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodPending {
-		return string(pod.Status.Phase)
-	}
-	for _, cs := range pod.Status.ContainerStatuses {
-		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
-			return cs.State.Waiting.Reason
-		}
-		if cs.LastTerminationState.Terminated != nil && cs.LastTerminationState.Terminated.Reason != "" {
-			return cs.LastTerminationState.Terminated.Reason
-		}
-	}
-	return ""
-}
-
-// getClusterHealth returns node status and pod issues for a context
-func getClusterHealth(c *gin.Context) {
-	ctxName := c.Query("context")
-	namespace := c.Query("namespace")
-
-	clientset, _, err := createKubeClient(ctxName)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	ctx := c.Request.Context()
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// If a namespace is specified, filter pods to that namespace
-	if namespace != "" {
-		podItems := pods.Items
-		filtered := make([]corev1.Pod, 0, len(podItems))
-		for _, p := range podItems {
-			if p.Namespace == namespace {
-				filtered = append(filtered, p)
-			}
-		}
-		pods.Items = filtered
-	}
-
-	type nodeDTO struct {
-		Name    string `json:"name"`
-		Ready   bool   `json:"ready"`
-		CPU     string `json:"cpu"`
-		Memory  string `json:"memory"`
-		Version string `json:"version"`
-	}
-	nodeList := make([]nodeDTO, 0, len(nodes.Items))
-	for _, n := range nodes.Items {
-		nodeList = append(nodeList, nodeDTO{
-			Name:    n.Name,
-			Ready:   nodeReady(n),
-			CPU:     n.Status.Capacity.Cpu().String(),
-			Memory:  n.Status.Capacity.Memory().String(),
-			Version: n.Status.NodeInfo.KubeletVersion,
-		})
-	}
-
-	type issueDTO struct {
-		Namespace string `json:"namespace"`
-		Name      string `json:"name"`
-		Reason    string `json:"reason"`
-		Restarts  int32  `json:"restarts"`
-		Age       string `json:"age"`
-	}
-	var issues []issueDTO
-	podSummary := map[string]int{}
-	for _, p := range pods.Items {
-		podSummary[string(p.Status.Phase)]++
-		if reason := podIssueReason(p); reason != "" {
-			restarts := int32(0)
-			for _, cs := range p.Status.ContainerStatuses {
-				restarts += cs.RestartCount
-			}
-			issues = append(issues, issueDTO{
-				Namespace: p.Namespace,
-				Name:      p.Name,
-				Reason:    reason,
-				Restarts:  restarts,
-				Age:       time.Since(p.CreationTimestamp.Time).Round(time.Minute).String(),
-			})
-		}
-	}
-	// ponytail: capped at 200, oldest issues are dropped if the cluster has more
-	if len(issues) > 200 {
-		issues = issues[:200]
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"nodes":      nodeList,
-		"podSummary": podSummary,
-		"issues":     issues,
-	})
-}
-
-const maxYAMLBytes = 2 * 1024 * 1024 // 2 MB cap
-
-// applyManifest applies or deletes a YAML manifest against a context via kubectl
-func applyManifest(c *gin.Context) {
-	ctxName := c.Query("context")
-
-	var req struct {
-		Verb string `json:"verb"`
-		YAML string `json:"yaml"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
-		return
-	}
-
-	verb := strings.TrimSpace(req.Verb)
-	if verb == "" {
-		verb = "apply"
-	}
-	if verb != "apply" && verb != "delete" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "verb must be 'apply' or 'delete'"})
-		return
-	}
-
-	if len(req.YAML) > maxYAMLBytes {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("yaml too large: %d bytes (max %d)", len(req.YAML), maxYAMLBytes)})
-		return
-	}
-
-	// Basic YAML sanity: must start with apiVersion, kind, or be a multi-doc
-	trimmed := strings.TrimSpace(req.YAML)
-	if trimmed == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "yaml is empty"})
-		return
-	}
-	if !strings.HasPrefix(trimmed, "apiVersion") && !strings.Contains(trimmed, "---") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "yaml must start with apiVersion or be a multi-document (---)"})
-		return
-	}
-
-	cmd := exec.Command("kubectl", "--context", ctxName, verb, "-f", "-")
-	cmd.Stdin = strings.NewReader(req.YAML)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "output": string(output)})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"output": string(output)})
-}
-
-// Resource kinds browsable in the UI (plural, may include API group suffix)
-var resourceWhitelist = map[string]string{
-	"configmaps":          "configmaps",
-	"secrets":             "secrets",
-	"serviceaccounts":     "serviceaccounts",
-	"roles":               "roles.rbac.authorization.k8s.io",
-	"rolebindings":        "rolebindings.rbac.authorization.k8s.io",
-	"clusterroles":        "clusterroles.rbac.authorization.k8s.io",
-	"clusterrolebindings": "clusterrolebindings.rbac.authorization.k8s.io",
-	"deployments":         "deployments.apps",
-	"services":            "services",
-	"ingresses":           "ingresses.networking.k8s.io",
-	"storageclasses":      "storageclasses.storage.k8s.io",
-	"nodes":               "nodes",
-	"pods":                "pods",
-}
-
-// Kinds that are cluster-scoped and therefore reject -n
-var clusterScopedResources = map[string]bool{
-	"clusterroles":        true,
-	"clusterrolebindings": true,
-	"storageclasses":      true,
-	"nodes":               true,
-}
-
-// getClusterResources lists a whitelisted resource kind for a context
-func getClusterResources(c *gin.Context) {
-	ctxName := c.Query("context")
-	kind := strings.ToLower(strings.TrimSpace(c.Query("kind")))
-	namespace := strings.TrimSpace(c.Query("namespace"))
-
-	resource, ok := resourceWhitelist[kind]
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported resource kind %q", kind)})
-		return
-	}
-
-	args := []string{"--context", ctxName, "get", resource, "-o", "json"}
-	if namespace != "" && !clusterScopedResources[kind] {
-		args = append(args, "-n", namespace)
-	}
-
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
-		return
-	}
-
-	var list struct {
-		Items []struct {
-			Metadata struct {
-				Name              string `json:"name"`
-				Namespace         string `json:"namespace"`
-				CreationTimestamp string `json:"creationTimestamp"`
-			} `json:"metadata"`
-		} `json:"items"`
-	}
-	if err := json.Unmarshal(output, &list); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse kubectl output: " + err.Error()})
-		return
-	}
-
-	items := make([]gin.H, 0, len(list.Items))
-	for _, it := range list.Items {
-		items = append(items, gin.H{
-			"name":      it.Metadata.Name,
-			"namespace": it.Metadata.Namespace,
-			"created":   it.Metadata.CreationTimestamp,
-		})
-	}
-	c.JSON(http.StatusOK, gin.H{"kind": kind, "items": items})
-}
-
-// getResourceDetail returns the full YAML of a single whitelisted resource
-func getResourceDetail(c *gin.Context) {
-	ctxName := c.Query("context")
-	kind := strings.ToLower(strings.TrimSpace(c.Query("kind")))
-	name := strings.TrimSpace(c.Query("name"))
-	namespace := strings.TrimSpace(c.Query("namespace"))
-
-	resource, ok := resourceWhitelist[kind]
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported resource kind %q", kind)})
-		return
-	}
-	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resource name"})
-		return
-	}
-
-	args := []string{"--context", ctxName, "get", resource, name, "-o", "yaml"}
-	if namespace != "" && !clusterScopedResources[kind] {
-		args = append(args, "-n", namespace)
-	}
-
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "details": string(output)})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"kind": kind, "name": name, "yaml": string(output)})
-}
@@ -4,22 +4,55 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
 	gin.SetMode(gin.TestMode)
 }
 
+// TestMain keeps the store, recordings, alert rules and audit events of the tests out of the
+// real data directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "stern-ui-test")
+	if err != nil {
+		panic(err)
+	}
+	dataDir = dir
+	recordingsDir = filepath.Join(dir, "recordings")
+	alertRulesPath = filepath.Join(dir, "alert-rules.yaml")
+	alerts.path = alertRulesPath
+	archiveStreamsPath = filepath.Join(dir, "archive-streams.yaml")
+	auditLog.path = filepath.Join(dir, "audit.jsonl")
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func setupRouter() *gin.Engine {
 	return newRouter()
 }
 
+// useTestCluster points KUBECONFIG at a single context "dev" served by server
+func useTestCluster(t *testing.T, server string) {
+	t.Helper()
+	kubeconfig := "apiVersion: v1\nkind: Config\ncurrent-context: dev\n" +
+		"clusters:\n- name: dev\n  cluster:\n    server: " + server + "\n" +
+		"contexts:\n- name: dev\n  context:\n    cluster: dev\n    user: dev\n" +
+		"users:\n- name: dev\n  user:\n    token: test\n"
+	t.Setenv("KUBECONFIG", writeTestFile(t, "kubeconfig", kubeconfig))
+}
+
 // TestStreamLogsEndpoint tests that the WebSocket endpoint is registered
 func TestStreamLogsEndpoint(t *testing.T) {
 	r := setupRouter()
@@ -260,3 +293,41 @@ func TestCORSUpgrader(t *testing.T) {
 	result := upgrader.CheckOrigin(dummyReq)
 	assert.True(t, result, "Upgrader should allow all origins")
 }
+
+// TestLineWriter verifies stern output is split into log lines across writes and concurrent writers
+func TestLineWriter(t *testing.T) {
+	var pods []string
+	w := newLineWriter(func(line logLine) { pods = append(pods, line.PodName) })
+
+	_, _ = w.Write([]byte(`{"podName":"a","message":"one"}` + "\n" + `not json` + "\n" + `{"podName":"b","mess`))
+	_, _ = w.Write([]byte(`age":"two"}` + "\n"))
+	assert.Equal(t, []string{"a", "b"}, pods)
+
+	pods = nil
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = w.Write([]byte(`{"podName":"c"}` + "\n"))
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, pods, 10)
+}
+
+// TestStreamLogsErrorFrame verifies a cluster error reaches the client as valid JSON even when it contains quotes
+func TestStreamLogsErrorFrame(t *testing.T) {
+	t.Setenv("KUBECONFIG", writeTestFile(t, "kubeconfig", "apiVersion: v1\nkind: Config\n"))
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs?context=nosuch&query=.", nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var frame map[string]string
+	require.NoError(t, json.Unmarshal(data, &frame), string(data))
+	assert.Contains(t, frame["error"], `context "nosuch" does not exist`)
+}
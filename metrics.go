@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// Number of pods returned per ranking when the caller does not set top
+const defaultTopPods = 10
+
+// nodeUsage is a node's live usage and its share of allocatable capacity
+type nodeUsage struct {
+	CPU           string  `json:"cpu"`
+	Memory        string  `json:"memory"`
+	CPUPercent    float64 `json:"cpuPercent"`
+	MemoryPercent float64 `json:"memoryPercent"`
+}
+
+// podUsage is a pod's live usage summed over its containers, compared to its requests and limits.
+// Percentages are omitted when the pod sets no request or limit for that resource.
+type podUsage struct {
+	Namespace            string   `json:"namespace"`
+	Name                 string   `json:"name"`
+	Node                 string   `json:"node,omitempty"`
+	CPU                  string   `json:"cpu"`
+	Memory               string   `json:"memory"`
+	CPURequestPercent    *float64 `json:"cpuRequestPercent,omitempty"`
+	CPULimitPercent      *float64 `json:"cpuLimitPercent,omitempty"`
+	MemoryRequestPercent *float64 `json:"memoryRequestPercent,omitempty"`
+	MemoryLimitPercent   *float64 `json:"memoryLimitPercent,omitempty"`
+
+	cpuMillis   int64
+	memoryBytes int64
+}
+
+// usageReport is the metrics.k8s.io section of the health response
+type usageReport struct {
+	Available bool                 `json:"available"`
+	Error     string               `json:"error,omitempty"`
+	Nodes     map[string]nodeUsage `json:"-"`
+	TopCPU    []podUsage           `json:"topCpu"`
+	TopMemory []podUsage           `json:"topMemory"`
+}
+
+func percentOf(used, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	p := float64(used) * 100 / float64(total)
+	return float64(int64(p*10+0.5)) / 10
+}
+
+func optionalPercent(used, total int64) *float64 {
+	if total == 0 {
+		return nil
+	}
+	p := percentOf(used, total)
+	return &p
+}
+
+// podResources sums the container requests and limits of a pod for one resource. Usage covers
+// every container, so a request or limit some container leaves unset is reported as zero
+// (no percentage) rather than as the sum of the others.
+func podResources(pod corev1.Pod, name corev1.ResourceName) (request, limit resource.Quantity) {
+	allRequests, allLimits := true, true
+	for _, c := range pod.Spec.Containers {
+		if q, ok := c.Resources.Requests[name]; ok {
+			request.Add(q)
+		} else {
+			allRequests = false
+		}
+		if q, ok := c.Resources.Limits[name]; ok {
+			limit.Add(q)
+		} else {
+			allLimits = false
+		}
+	}
+	if !allRequests {
+		request = resource.Quantity{}
+	}
+	if !allLimits {
+		limit = resource.Quantity{}
+	}
+	return request, limit
+}
+
+// parseTopPods reads the top query parameter, falling back to defaultTopPods
+func parseTopPods(raw string) int {
+	if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+		return n
+	}
+	return defaultTopPods
+}
+
+// collectUsage reads node and pod usage from metrics.k8s.io for the given namespaces ("" for all).
+// When the metrics API is missing (no metrics-server) or fails, the report is marked unavailable
+// instead of failing the health check; namespaces or nodes the caller may not read are skipped.
+func collectUsage(ctx context.Context, mc metricsclient.Interface, nodes []corev1.Node, pods []corev1.Pod, namespaces []string, top int) *usageReport {
+	report := &usageReport{Nodes: map[string]nodeUsage{}, TopCPU: []podUsage{}, TopMemory: []podUsage{}}
+
+	var podMetrics []metricsv1beta1.PodMetrics
+	var lastErr error
+	for _, ns := range namespaces {
+		list, err := mc.MetricsV1beta1().PodMetricses(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		report.Available = true
+		podMetrics = append(podMetrics, list.Items...)
+	}
+	if !report.Available {
+		if lastErr != nil {
+			report.Error = "metrics API unavailable: " + lastErr.Error()
+			debugLog("health: %s", report.Error)
+		}
+		return report
+	}
+
+	var nodeMetrics []metricsv1beta1.NodeMetrics
+	if len(nodes) > 0 {
+		list, err := mc.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			debugLog("health: node metrics unavailable: %v", err)
+		} else {
+			nodeMetrics = list.Items
+		}
+	}
+
+	allocatable := make(map[string]corev1.ResourceList, len(nodes))
+	for _, n := range nodes {
+		allocatable[n.Name] = n.Status.Allocatable
+	}
+	for _, m := range nodeMetrics {
+		cpu, mem := m.Usage.Cpu(), m.Usage.Memory()
+		alloc := allocatable[m.Name]
+		report.Nodes[m.Name] = nodeUsage{
+			CPU:           cpu.String(),
+			Memory:        mem.String(),
+			CPUPercent:    percentOf(cpu.MilliValue(), alloc.Cpu().MilliValue()),
+			MemoryPercent: percentOf(mem.Value(), alloc.Memory().Value()),
+		}
+	}
+
+	specs := make(map[string]corev1.Pod, len(pods))
+	for _, p := range pods {
+		specs[p.Namespace+"/"+p.Name] = p
+	}
+	usages := make([]podUsage, 0, len(podMetrics))
+	for _, m := range podMetrics {
+		var cpu, mem resource.Quantity
+		for _, c := range m.Containers {
+			cpu.Add(*c.Usage.Cpu())
+			mem.Add(*c.Usage.Memory())
+		}
+		u := podUsage{
+			Namespace:   m.Namespace,
+			Name:        m.Name,
+			CPU:         cpu.String(),
+			Memory:      mem.String(),
+			cpuMillis:   cpu.MilliValue(),
+			memoryBytes: mem.Value(),
+		}
+		if pod, ok := specs[m.Namespace+"/"+m.Name]; ok {
+			u.Node = pod.Spec.NodeName
+			cpuReq, cpuLim := podResources(pod, corev1.ResourceCPU)
+			memReq, memLim := podResources(pod, corev1.ResourceMemory)
+			u.CPURequestPercent = optionalPercent(u.cpuMillis, cpuReq.MilliValue())
+			u.CPULimitPercent = optionalPercent(u.cpuMillis, cpuLim.MilliValue())
+			u.MemoryRequestPercent = optionalPercent(u.memoryBytes, memReq.Value())
+			u.MemoryLimitPercent = optionalPercent(u.memoryBytes, memLim.Value())
+		}
+		usages = append(usages, u)
+	}
+
+	report.TopCPU = topPods(usages, top, func(a, b podUsage) bool { return a.cpuMillis > b.cpuMillis })
+	report.TopMemory = topPods(usages, top, func(a, b podUsage) bool { return a.memoryBytes > b.memoryBytes })
+	return report
+}
+
+// topPods returns the first n pods ordered by more, ties broken by namespace/name
+func topPods(usages []podUsage, n int, more func(a, b podUsage) bool) []podUsage {
+	sorted := append([]podUsage(nil), usages...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if more(sorted[i], sorted[j]) {
+			return true
+		}
+		if more(sorted[j], sorted[i]) {
+			return false
+		}
+		return sorted[i].Namespace+"/"+sorted[i].Name < sorted[j].Namespace+"/"+sorted[j].Name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
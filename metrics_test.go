@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func resources(cpu, memory string) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+// TestCollectUsage verifies node saturation and pod usage against requests and limits
+func TestCollectUsage(t *testing.T) {
+	nodes := []corev1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+		Status:     corev1.NodeStatus{Allocatable: resources("4", "8Gi")},
+	}}
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+		Spec: corev1.PodSpec{NodeName: "worker-1", Containers: []corev1.Container{
+			{Name: "app", Resources: corev1.ResourceRequirements{Requests: resources("500m", "256Mi"), Limits: resources("1", "512Mi")}},
+			{Name: "sidecar", Resources: corev1.ResourceRequirements{Requests: resources("500m", "256Mi")}},
+		}},
+	}}
+
+	mc := metricsfake.NewSimpleClientset()
+	mc.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.NodeMetricsList{Items: []metricsv1beta1.NodeMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}, Usage: resources("3", "2Gi")},
+		}}, nil
+	})
+	mc.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{
+			{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}, Containers: []metricsv1beta1.ContainerMetrics{
+				{Name: "app", Usage: resources("1500m", "384Mi")},
+				{Name: "sidecar", Usage: resources("10m", "16Mi")},
+			}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "prod"}, Containers: []metricsv1beta1.ContainerMetrics{
+				{Name: "job", Usage: resources("100m", "1Gi")},
+			}},
+		}}, nil
+	})
+
+	report := collectUsage(context.Background(), mc, nodes, pods, []string{""}, 1)
+
+	require.True(t, report.Available)
+	assert.Equal(t, nodeUsage{CPU: "3", Memory: "2Gi", CPUPercent: 75, MemoryPercent: 25}, report.Nodes["worker-1"])
+
+	require.Len(t, report.TopCPU, 1)
+	web := report.TopCPU[0]
+	assert.Equal(t, "web", web.Name)
+	assert.Equal(t, "1510m", web.CPU)
+	assert.Equal(t, "worker-1", web.Node)
+	assert.Equal(t, 151.0, *web.CPURequestPercent)
+	assert.Nil(t, web.CPULimitPercent, "the sidecar sets no CPU limit")
+	assert.Nil(t, web.MemoryLimitPercent, "the sidecar sets no memory limit")
+
+	require.Len(t, report.TopMemory, 1)
+	assert.Equal(t, "batch", report.TopMemory[0].Name)
+	assert.Nil(t, report.TopMemory[0].CPURequestPercent, "pods without a spec have no request percentages")
+}
+
+// TestPodResources verifies requests and limits are only summed when every container sets them
+func TestPodResources(t *testing.T) {
+	pod := corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{Name: "app", Resources: corev1.ResourceRequirements{Requests: resources("500m", "256Mi"), Limits: resources("1", "512Mi")}},
+		{Name: "sidecar", Resources: corev1.ResourceRequirements{
+			Requests: resources("100m", "64Mi"),
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		}},
+	}}}
+
+	request, limit := podResources(pod, corev1.ResourceCPU)
+	assert.Equal(t, "600m", request.String())
+	assert.True(t, limit.IsZero())
+
+	request, limit = podResources(pod, corev1.ResourceMemory)
+	assert.Equal(t, "320Mi", request.String())
+	assert.Equal(t, "640Mi", limit.String())
+}
+
+// TestCollectUsageWithoutMetricsServer verifies health degrades when metrics.k8s.io is missing
+func TestCollectUsageWithoutMetricsServer(t *testing.T) {
+	mc := metricsfake.NewSimpleClientset()
+	mc.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("the server could not find the requested resource")
+	})
+
+	report := collectUsage(context.Background(), mc, nil, nil, []string{"prod", "staging"}, defaultTopPods)
+
+	assert.False(t, report.Available)
+	assert.Contains(t, report.Error, "metrics API unavailable")
+	assert.Empty(t, report.TopCPU)
+}
+
+// TestParseTopPods verifies the top parameter default
+func TestParseTopPods(t *testing.T) {
+	assert.Equal(t, defaultTopPods, parseTopPods(""))
+	assert.Equal(t, defaultTopPods, parseTopPods("-3"))
+	assert.Equal(t, 25, parseTopPods("25"))
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"sigs.k8s.io/yaml"
+)
+
+// Capabilities a policy rule grants
+const (
+	capLogs        = "logs"        // stream, record, archive, search and alert on logs
+	capView        = "view"        // read cluster state: pods, events, health, resources
+	capSecrets     = "secrets"     // reveal masked Secret and ConfigMap values
+	capApply       = "apply"       // apply manifests and run non-destructive actions
+	capDelete      = "delete"      // delete through apply, delete pods and drain nodes
+	capExec        = "exec"        // open a web terminal
+	capPortForward = "portforward" // forward ports to pods and services
+	capAudit       = "audit"       // read the audit log
+)
+
+var policyCapabilities = []string{capLogs, capView, capSecrets, capApply, capDelete, capExec, capPortForward, capAudit}
+
+// Identities used in policy rules for callers without a login, and for every logged-in caller
+const (
+	anonymousUser      = "system:anonymous"
+	unauthenticatedGrp = "system:unauthenticated"
+	authenticatedGrp   = "system:authenticated"
+)
+
+const policyEngineKey = "policyEngine"
+
+// How often the policy file is checked for changes
+var policyReloadInterval = envDuration("STERN_UI_POLICY_RELOAD_INTERVAL", 5*time.Second)
+
+// policyScope says where the middleware finds the context and namespace a request targets
+type policyScope int
+
+const (
+	scopeNone      policyScope = iota // not tied to a cluster
+	scopeContext                      // ?context= or the body's context
+	scopeNamespace                    // ?context=, ?namespace= (comma-separated, empty = all namespaces) and ?allNamespaces=
+)
+
+// routePolicy is the capability a route needs. Routes whose namespace is only known once the
+// handler has parsed its input use scopeContext here and call checkPolicy themselves.
+type routePolicy struct {
+	capability string
+	scope      policyScope
+	refine     func(body policyBody) string // capability from the request body, when it depends on it
+}
+
+// policyBody holds the request body fields the middleware looks at
+type policyBody struct {
+	Context string `json:"context"`
+	Verb    string `json:"verb"`
+	Action  string `json:"action"`
+}
+
+// routePolicies covers every /api and /ws route registered in newRouter; routes missing
+// from it are refused while a policy is loaded
+var routePolicies = map[string]routePolicy{
+	"GET /api/capabilities":                  {capability: capLogs, scope: scopeNone},
+	"GET /ws/logs":                           {capability: capLogs, scope: scopeNone},
+	"GET /ws/exec":                           {capability: capExec, scope: scopeNamespace},
+	"GET /ws/replay/:id":                     {capability: capLogs, scope: scopeNone},
+	"GET /api/namespaces":                    {capability: capView, scope: scopeContext},
+	"GET /api/pods":                          {capability: capView, scope: scopeNamespace},
+	"GET /api/containers":                    {capability: capView, scope: scopeNamespace},
+	"GET /api/contexts":                      {capability: capView, scope: scopeNone},
+	"GET /api/nodes":                         {capability: capView, scope: scopeContext},
+	"GET /api/pod-metadata":                  {capability: capView, scope: scopeNamespace},
+	"GET /api/clusters/events":               {capability: capView, scope: scopeNamespace},
+	"GET /api/clusters/health":               {capability: capView, scope: scopeNamespace},
+	"GET /api/clusters/health/history":       {capability: capView, scope: scopeContext},
+	"POST /api/clusters/apply":               {capability: capApply, scope: scopeContext, refine: applyCapability},
+	"GET /api/clusters/kinds":                {capability: capView, scope: scopeContext},
+	"GET /api/clusters/resources":            {capability: capView, scope: scopeNamespace},
+	"GET /api/clusters/resource-detail":      {capability: capView, scope: scopeNamespace},
+	"POST /api/clusters/secret-reveal":       {capability: capSecrets, scope: scopeContext},
+	"GET /api/clusters/tree":                 {capability: capView, scope: scopeNamespace},
+	"GET /api/clusters/can-i":                {capability: capView, scope: scopeContext},
+	"POST /api/clusters/actions":             {capability: capApply, scope: scopeContext, refine: actionCapability},
+	"GET /api/clusters/port-forwards":        {capability: capPortForward, scope: scopeNone},
+	"POST /api/clusters/port-forwards":       {capability: capPortForward, scope: scopeContext},
+	"DELETE /api/clusters/port-forwards/:id": {capability: capPortForward, scope: scopeNone},
+	"GET /api/alerts/rules":                  {capability: capLogs, scope: scopeNone},
+	"POST /api/alerts/rules":                 {capability: capLogs, scope: scopeNone},
+	"PUT /api/alerts/rules/:id":              {capability: capLogs, scope: scopeNone},
+	"DELETE /api/alerts/rules/:id":           {capability: capLogs, scope: scopeNone},
+	"GET /api/archive/streams":               {capability: capLogs, scope: scopeNone},
+	"GET /api/archive/logs":                  {capability: capLogs, scope: scopeNamespace},
+	"GET /api/logs/search":                   {capability: capLogs, scope: scopeNamespace},
+	"GET /api/presets":                       {capability: capLogs, scope: scopeNone},
+	"POST /api/presets":                      {capability: capLogs, scope: scopeNone},
+	"GET /api/presets/:name":                 {capability: capLogs, scope: scopeNone},
+	"PUT /api/presets/:name":                 {capability: capLogs, scope: scopeNone},
+	"DELETE /api/presets/:name":              {capability: capLogs, scope: scopeNone},
+	"POST /api/share":                        {capability: capLogs, scope: scopeNone},
+	"GET /api/share/:id":                     {capability: capLogs, scope: scopeNone},
+	"GET /api/recordings":                    {capability: capLogs, scope: scopeNone},
+	"DELETE /api/recordings/:id":             {capability: capLogs, scope: scopeNone},
+	"GET /api/audit":                         {capability: capAudit, scope: scopeNone},
+}
+
+func applyCapability(body policyBody) string {
+	if body.Verb == "delete" {
+		return capDelete
+	}
+	return capApply
+}
+
+func actionCapability(body policyBody) string {
+	switch body.Action {
+	case "delete-pod", "drain":
+		return capDelete
+	}
+	return capApply
+}
+
+// glob is a policy pattern where * matches any run of characters, '/' and ':' included,
+// so patterns like *prod* match EKS context ARNs
+type glob struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+func (g *glob) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &g.raw); err != nil {
+		return err
+	}
+	pattern := regexp.QuoteMeta(g.raw)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	g.re = regexp.MustCompile("^" + pattern + "$")
+	return nil
+}
+
+func (g glob) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.raw)
+}
+
+func matchesGlobs(globs []glob, value string) bool {
+	for _, g := range globs {
+		if g.re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRule grants capabilities in matching contexts and namespaces to matching users and groups.
+// The empty namespace stands for all namespaces and cluster-scoped objects; only "*" matches it.
+type policyRule struct {
+	Name         string   `json:"name"`
+	Users        []glob   `json:"users"`
+	Groups       []glob   `json:"groups"`
+	Contexts     []glob   `json:"contexts"`
+	Namespaces   []glob   `json:"namespaces"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type policyFile struct {
+	Rules []*policyRule `json:"rules"`
+}
+
+func (r *policyRule) validate() error {
+	if len(r.Users) == 0 && len(r.Groups) == 0 {
+		return errors.New("users or groups are required")
+	}
+	if len(r.Contexts) == 0 {
+		return errors.New(`contexts are required (use "*" for all)`)
+	}
+	if len(r.Namespaces) == 0 {
+		return errors.New(`namespaces are required (use "*" for all)`)
+	}
+	if len(r.Capabilities) == 0 {
+		return errors.New("capabilities are required")
+	}
+	for _, capability := range r.Capabilities {
+		if capability != "*" && !slices.Contains(policyCapabilities, capability) {
+			return fmt.Errorf("unknown capability %q (known: %s)", capability, strings.Join(policyCapabilities, ", "))
+		}
+	}
+	return nil
+}
+
+func (r *policyRule) appliesTo(user *authUser) bool {
+	if matchesGlobs(r.Users, user.Name) {
+		return true
+	}
+	for _, group := range user.Groups {
+		if matchesGlobs(r.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *policyRule) grants(capability string) bool {
+	return slices.Contains(r.Capabilities, "*") || slices.Contains(r.Capabilities, capability)
+}
+
+// loadPolicyFile reads and validates a policy file (YAML or JSON)
+func loadPolicyFile(path string) ([]*policyRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file policyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, rule.Name, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+// policyDenied is the 403 returned when no rule grants a request
+type policyDenied struct {
+	User       string `json:"user"`
+	Capability string `json:"capability"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+func (d *policyDenied) Error() string {
+	var where string
+	if d.Context != "" {
+		where = fmt.Sprintf(" in context %q", d.Context)
+		if d.Namespace == "" {
+			where += " across all namespaces"
+		} else {
+			where += fmt.Sprintf(" namespace %q", d.Namespace)
+		}
+	}
+	return fmt.Sprintf("policy: %s is not allowed to use %s%s", d.User, d.Capability, where)
+}
+
+// policyEngine holds the rules of STERN_UI_POLICY_FILE and reloads them when the file changes.
+// A file that fails to load keeps the previous rules in force.
+type policyEngine struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   []*policyRule
+	modTime time.Time
+	checked time.Time
+}
+
+// newPolicyEngineFromEnv loads STERN_UI_POLICY_FILE; without it there is no policy (nil)
+func newPolicyEngineFromEnv() (*policyEngine, error) {
+	path := os.Getenv("STERN_UI_POLICY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	p := &policyEngine{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.rules, err = loadPolicyFile(path); err != nil {
+		return nil, err
+	}
+	p.modTime, p.checked = info.ModTime(), time.Now()
+	log.Printf("[INFO] authorization policy loaded from %s: %d rules", path, len(p.rules))
+	return p, nil
+}
+
+// current returns the rules, reloading the file at most once per policyReloadInterval
+func (p *policyEngine) current() []*policyRule {
+	p.mu.RLock()
+	rules, stale := p.rules, time.Since(p.checked) >= policyReloadInterval
+	p.mu.RUnlock()
+	if !stale {
+		return rules
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.checked) < policyReloadInterval {
+		return p.rules
+	}
+	p.checked = time.Now()
+	info, err := os.Stat(p.path)
+	if err != nil {
+		log.Printf("[WARN] policy %s: %v; keeping the loaded rules", p.path, err)
+		return p.rules
+	}
+	if info.ModTime().Equal(p.modTime) {
+		return p.rules
+	}
+	loaded, err := loadPolicyFile(p.path)
+	if err != nil {
+		log.Printf("[WARN] policy reload failed, keeping the loaded rules: %v", err)
+		return p.rules
+	}
+	p.rules, p.modTime = loaded, info.ModTime()
+	log.Printf("[INFO] authorization policy reloaded from %s: %d rules", p.path, len(p.rules))
+	return p.rules
+}
+
+// policySubject is the caller as policy rules see it
+func policySubject(user *authUser) *authUser {
+	if user == nil {
+		return &authUser{Name: anonymousUser, Groups: []string{unauthenticatedGrp}}
+	}
+	subject := *user
+	subject.Groups = append(slices.Clone(user.Groups), authenticatedGrp)
+	return &subject
+}
+
+// allows reports whether a rule grants capability. An empty contextName checks the
+// capability alone, for routes not tied to a cluster.
+func (p *policyEngine) allows(user *authUser, capability, contextName, namespace string, scoped bool) bool {
+	subject := policySubject(user)
+	for _, rule := range p.current() {
+		if !rule.appliesTo(subject) || !rule.grants(capability) {
+			continue
+		}
+		if contextName != "" && !matchesGlobs(rule.Contexts, contextName) {
+			continue
+		}
+		if scoped && !matchesGlobs(rule.Namespaces, namespace) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// check returns a *policyDenied unless the caller may use capability in every namespace listed
+func (p *policyEngine) check(user *authUser, capability, contextName string, namespaces []string) error {
+	subject := policySubject(user)
+	if len(namespaces) == 0 {
+		if !p.allows(user, capability, contextName, "", false) {
+			return &policyDenied{User: subject.Name, Capability: capability, Context: contextName}
+		}
+		return nil
+	}
+	for _, namespace := range namespaces {
+		if !p.allows(user, capability, contextName, namespace, true) {
+			return &policyDenied{User: subject.Name, Capability: capability, Context: contextName, Namespace: namespace}
+		}
+	}
+	return nil
+}
+
+// splitNamespaces turns a comma-separated namespace parameter into the namespaces to check;
+// an empty parameter means all namespaces
+func splitNamespaces(value string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{""}
+	}
+	return namespaces
+}
+
+// streamNamespaces returns the namespaces a set of /ws/logs parameters reads
+func streamNamespaces(namespace, allNamespaces string) []string {
+	if allNamespaces == "true" {
+		return []string{""}
+	}
+	return splitNamespaces(namespace)
+}
+
+// checkPolicy lets handlers check targets they only know after parsing their input.
+// It is a no-op without a policy.
+func checkPolicy(c *gin.Context, capability, contextName string, namespaces ...string) error {
+	v, ok := c.Get(policyEngineKey)
+	if !ok {
+		return nil
+	}
+	return v.(*policyEngine).check(currentUser(c), capability, currentContextName(contextName), namespaces)
+}
+
+// checkQueryPolicy checks the logs capability on the context and namespaces of saved /ws/logs
+// parameters (alert rules, recordings)
+func checkQueryPolicy(c *gin.Context, contextName string, query map[string]string) error {
+	return checkPolicy(c, capLogs, contextName, streamNamespaces(query["namespace"], query["allNamespaces"])...)
+}
+
+// policyAllowsContext reports whether the caller has any capability in a context
+func policyAllowsContext(c *gin.Context, contextName string) bool {
+	v, ok := c.Get(policyEngineKey)
+	if !ok {
+		return true
+	}
+	for _, capability := range policyCapabilities {
+		if v.(*policyEngine).allows(currentUser(c), capability, contextName, "", false) {
+			return true
+		}
+	}
+	return false
+}
+
+// denyPolicy writes the 403 for a policy denial
+func denyPolicy(c *gin.Context, err error) {
+	var denied *policyDenied
+	if !errors.As(err, &denied) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{
+		Verb:      denied.Capability,
+		Context:   denied.Context,
+		Namespace: denied.Namespace,
+		Result:    auditDenied,
+		Error:     denied.Error(),
+		Details:   map[string]string{"path": c.Request.URL.Path},
+	})
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      denied.Error(),
+		"user":       denied.User,
+		"capability": denied.Capability,
+		"context":    denied.Context,
+		"namespace":  denied.Namespace,
+	})
+}
+
+// Largest body the policy reads: an apply manifest of maxYAMLBytes plus room for JSON
+// escaping and the other fields
+const maxPolicyBodyBytes = maxYAMLBytes + 1<<20
+
+// peekPolicyBody decodes the fields of a JSON body the policy needs and restores the body for
+// the handler. It fails with an *http.MaxBytesError for bodies over maxPolicyBodyBytes.
+func peekPolicyBody(c *gin.Context) (policyBody, error) {
+	var body policyBody
+	if c.Request.Body == nil || c.Request.Method == http.MethodGet {
+		return body, nil
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPolicyBodyBytes))
+	_ = c.Request.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return body, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	if err == nil {
+		_ = json.Unmarshal(data, &body)
+	}
+	return body, nil
+}
+
+// middleware enforces the policy on every /api and /ws route; nil means no policy
+func (p *policyEngine) middleware(c *gin.Context) {
+	if p == nil {
+		c.Next()
+		return
+	}
+	path := c.Request.URL.Path
+	if !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/ws/") || c.FullPath() == "" {
+		c.Next()
+		return
+	}
+	route, ok := routePolicies[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		denyPolicy(c, &policyDenied{User: policySubject(currentUser(c)).Name, Capability: c.Request.Method + " " + c.FullPath()})
+		return
+	}
+	c.Set(policyEngineKey, p)
+
+	body, err := peekPolicyBody(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	capability := route.capability
+	if route.refine != nil {
+		capability = route.refine(body)
+	}
+	switch route.scope {
+	case scopeNone:
+		err = p.check(currentUser(c), capability, "", nil)
+	case scopeContext:
+		contextName := c.Query("context")
+		if contextName == "" {
+			contextName = body.Context
+		}
+		err = checkPolicy(c, capability, contextName)
+	case scopeNamespace:
+		err = checkPolicy(c, capability, c.Query("context"), streamNamespaces(c.Query("namespace"), c.Query("allNamespaces"))...)
+	}
+	if err != nil {
+		denyPolicy(c, err)
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - name: sre
+    groups: [sre]
+    contexts: ["*"]
+    namespaces: ["*"]
+    capabilities: ["*"]
+  - name: team-a
+    users: [alice]
+    contexts: ["*dev*"]
+    namespaces: ["team-a-*"]
+    capabilities: [logs, view, apply]
+  - name: everyone
+    groups: [system:authenticated]
+    contexts: ["*"]
+    namespaces: ["*"]
+    capabilities: [logs]
+`
+
+func testPolicyEngine(t *testing.T, content string) *policyEngine {
+	t.Helper()
+	t.Setenv("STERN_UI_POLICY_FILE", writeTestFile(t, "policy.yaml", content))
+	p, err := newPolicyEngineFromEnv()
+	require.NoError(t, err)
+	return p
+}
+
+// TestLoadPolicyFile verifies rules are validated when loaded
+func TestLoadPolicyFile(t *testing.T) {
+	for content, want := range map[string]string{
+		"rules:\n- contexts: ['*']\n  namespaces: ['*']\n  capabilities: [logs]\n":                        "users or groups are required",
+		"rules:\n- users: [a]\n  namespaces: ['*']\n  capabilities: [logs]\n":                             "contexts are required",
+		"rules:\n- users: [a]\n  contexts: ['*']\n  capabilities: [logs]\n":                               "namespaces are required",
+		"rules:\n- users: [a]\n  contexts: ['*']\n  namespaces: ['*']\n  capabilities: [root]\n":          `unknown capability "root"`,
+		"rules:\n- name: ops\n  users: [a]\n  contexts: ['*']\n  namespaces: ['*']\n  capabilities: []\n": "ops: capabilities are required",
+	} {
+		_, err := loadPolicyFile(writeTestFile(t, "policy.yaml", content))
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+// TestPolicyAllows verifies users, groups, context and namespace globs and the all-namespaces rule
+func TestPolicyAllows(t *testing.T) {
+	p := testPolicyEngine(t, testPolicy)
+	alice := &authUser{Name: "alice"}
+	sre := &authUser{Name: "bob", Groups: []string{"sre"}}
+
+	assert.NoError(t, p.check(alice, capView, "arn:aws:eks:eu-west-1:1:cluster/dev-eu", []string{"team-a-web"}), "* spans / and :")
+	assert.NoError(t, p.check(alice, capApply, "dev", []string{"team-a-web"}))
+	assert.NoError(t, p.check(alice, capLogs, "prod", []string{""}), "logs for every logged-in user")
+	assert.NoError(t, p.check(sre, capSecrets, "prod", []string{"kube-system"}))
+
+	err := p.check(alice, capView, "dev", []string{""})
+	assert.EqualError(t, err, `policy: alice is not allowed to use view in context "dev" across all namespaces`)
+	err = p.check(alice, capDelete, "dev", []string{"team-a-web"})
+	assert.EqualError(t, err, `policy: alice is not allowed to use delete in context "dev" namespace "team-a-web"`)
+	assert.Error(t, p.check(alice, capView, "prod", []string{"team-a-web"}))
+	assert.Error(t, p.check(alice, capView, "dev", []string{"team-a-web", "team-b"}), "every namespace must be granted")
+
+	err = p.check(nil, capLogs, "", nil)
+	assert.EqualError(t, err, "policy: system:anonymous is not allowed to use logs")
+	assert.NoError(t, p.check(alice, capLogs, "", nil))
+}
+
+// TestPolicyReload verifies a changed file replaces the rules and a broken one keeps them
+func TestPolicyReload(t *testing.T) {
+	interval := policyReloadInterval
+	policyReloadInterval = 0
+	t.Cleanup(func() { policyReloadInterval = interval })
+
+	p := testPolicyEngine(t, testPolicy)
+	alice := &authUser{Name: "alice"}
+	require.Error(t, p.check(alice, capExec, "dev", []string{"team-a-web"}))
+
+	touch := func(content string, age time.Duration) {
+		require.NoError(t, os.WriteFile(p.path, []byte(content), 0o600))
+		mtime := time.Now().Add(-age)
+		require.NoError(t, os.Chtimes(p.path, mtime, mtime))
+	}
+	touch(strings.Replace(testPolicy, "[logs, view, apply]", "[logs, view, apply, exec]", 1), time.Minute)
+	assert.NoError(t, p.check(alice, capExec, "dev", []string{"team-a-web"}))
+
+	touch("rules: [", 0)
+	assert.NoError(t, p.check(alice, capExec, "dev", []string{"team-a-web"}), "broken file keeps the loaded rules")
+}
+
+// TestPolicyMiddleware verifies 403 responses for routes, namespaces and body-dependent capabilities
+func TestPolicyMiddleware(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	testPolicyEngine(t, testPolicy)
+	r := setupRouter()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("GET", "/api/clusters/events?context=dev&namespace=team-b", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var denied map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &denied))
+	assert.Equal(t, map[string]string{
+		"error":      `policy: alice is not allowed to use view in context "dev" namespace "team-b"`,
+		"user":       "alice",
+		"capability": "view",
+		"context":    "dev",
+		"namespace":  "team-b",
+	}, denied)
+
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/api/clusters/health?context=dev&namespace=team-a-web,team-b", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/ws/exec?context=dev&namespace=team-a-web", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/api/clusters/apply?context=dev", `{"verb":"delete","yaml":""}`).Code)
+
+	// Allowed requests reach the handler, which sees the body the middleware peeked at
+	w = serve("POST", "/api/clusters/apply?context=dev", `{"verb":"apply","yaml":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "yaml is empty")
+	assert.Equal(t, http.StatusBadRequest, serve("GET", "/api/logs/search?context=prod&namespace=shop", "").Code)
+}
+
+// TestPolicyAllNamespaces verifies allNamespaces=true is checked as all namespaces, whatever ?namespace= says
+func TestPolicyAllNamespaces(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	testPolicyEngine(t, "rules:\n- users: [alice]\n  contexts: ['*']\n  namespaces: [team-a-web]\n  capabilities: [logs, view]\n")
+	r := setupRouter()
+
+	for _, path := range []string{"/api/pods", "/api/containers", "/api/archive/logs", "/api/logs/search"} {
+		req, _ := http.NewRequest("GET", path+"?context=dev&namespace=team-a-web&allNamespaces=true&q=x", nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Contains(t, w.Body.String(), "across all namespaces", path)
+	}
+}
+
+// TestPolicyClusterScopedDetail verifies cluster-scoped kinds and cluster-wide health history need a rule for all namespaces
+func TestPolicyClusterScopedDetail(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	testPolicyEngine(t, testPolicy)
+	useTestCluster(t, "http://127.0.0.1:1")
+	discoveryMu.Lock()
+	discoveryCache["dev"] = discoveryEntry{
+		resources: []apiResource{{ID: "nodes", Name: "nodes", Kind: "Node", Version: "v1", Verbs: []string{"get", "list"}}},
+		fetched:   time.Now(),
+	}
+	discoveryMu.Unlock()
+	t.Cleanup(func() {
+		discoveryMu.Lock()
+		delete(discoveryCache, "dev")
+		discoveryMu.Unlock()
+	})
+	r := setupRouter()
+
+	for _, path := range []string{"/api/clusters/resource-detail", "/api/clusters/resources", "/api/clusters/health/history"} {
+		req, _ := http.NewRequest("GET", path+"?context=dev&kind=nodes&name=node-1&namespace=team-a-web", nil)
+		req.Header.Set("Authorization", "Bearer alice-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, path)
+		assert.Contains(t, w.Body.String(), `policy: alice is not allowed to use view in context \"dev\" across all namespaces`, path)
+	}
+}
+
+// TestRoutePoliciesCoverRouter verifies every /api and /ws route has a capability
+func TestRoutePoliciesCoverRouter(t *testing.T) {
+	for _, route := range setupRouter().Routes() {
+		if strings.HasPrefix(route.Path, "/api/") || strings.HasPrefix(route.Path, "/ws/") {
+			assert.Contains(t, routePolicies, route.Method+" "+route.Path)
+		}
+	}
+}
+
+// TestPolicyBodyLimit verifies the policy refuses oversized bodies before reading them whole
+func TestPolicyBodyLimit(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\n"))
+	testPolicyEngine(t, testPolicy)
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/clusters/apply?context=dev", strings.NewReader(`{"yaml":"`+strings.Repeat("a", maxPolicyBodyBytes)+`"}`))
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Cookie identifying the browser session that owns port-forwards
+const clientSessionCookie = "stern-ui-client"
+
+// Forwards with no open connection for this long are stopped
+var portForwardIdleTimeout = envDuration("STERN_UI_PORTFORWARD_IDLE_TIMEOUT", 10*time.Minute)
+
+// Forwards of a session that has not called the port-forward API for this long are stopped
+var portForwardSessionTimeout = envDuration("STERN_UI_PORTFORWARD_SESSION_TIMEOUT", 30*time.Minute)
+
+// Address local ports are bound on; loopback keeps forwards private to the stern-ui host
+var portForwardAddress = func() string {
+	if addr := os.Getenv("STERN_UI_PORTFORWARD_ADDRESS"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1"
+}()
+
+// envDuration parses a duration environment variable, falling back to def when unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("[WARN] ignoring invalid %s=%q", name, v)
+	}
+	return def
+}
+
+func randomID(bytes int) string {
+	b := make([]byte, bytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientSessionID returns the caller's session ID, issuing a cookie on first use
+func clientSessionID(c *gin.Context) string {
+	if id, err := c.Cookie(clientSessionCookie); err == nil && id != "" {
+		return id
+	}
+	id := randomID(16)
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(clientSessionCookie, id, 0, "/", "", c.Request.TLS != nil, true)
+	return id
+}
+
+// portForward is one running forward from a local port on the stern-ui host to a pod port
+type portForward struct {
+	ID         string    `json:"id"`
+	Context    string    `json:"context"`
+	Namespace  string    `json:"namespace"`
+	Pod        string    `json:"pod"`
+	Service    string    `json:"service,omitempty"`
+	RemotePort int       `json:"remotePort"`
+	Address    string    `json:"address"`
+	LocalPort  int       `json:"localPort"`
+	Created    time.Time `json:"created"`
+	LastActive time.Time `json:"lastActive"`
+	Active     int       `json:"activeConnections"`
+
+	session  string
+	listener net.Listener
+	stop     chan struct{}
+	done     <-chan error // receives once the forwarder returns
+	mu       sync.Mutex
+}
+
+// snapshot copies the exported fields under the lock for JSON responses
+func (pf *portForward) snapshot() portForward {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return portForward{
+		ID: pf.ID, Context: pf.Context, Namespace: pf.Namespace, Pod: pf.Pod, Service: pf.Service,
+		RemotePort: pf.RemotePort, Address: pf.Address, LocalPort: pf.LocalPort,
+		Created: pf.Created, LastActive: pf.LastActive, Active: pf.Active,
+	}
+}
+
+func (pf *portForward) touch(delta int) {
+	pf.mu.Lock()
+	pf.Active += delta
+	pf.LastActive = time.Now()
+	pf.mu.Unlock()
+}
+
+func (pf *portForward) idleSince(now time.Time) time.Duration {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	if pf.Active > 0 {
+		return 0
+	}
+	return now.Sub(pf.LastActive)
+}
+
+func (pf *portForward) busy() bool {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.Active > 0
+}
+
+func (pf *portForward) close() {
+	close(pf.stop)
+	_ = pf.listener.Close()
+}
+
+// serve accepts local connections and pipes each one to upstream (the client-go forwarder)
+func (pf *portForward) serve(upstream string) {
+	for {
+		conn, err := pf.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			pf.touch(1)
+			defer pf.touch(-1)
+
+			remote, err := net.Dial("tcp", upstream)
+			if err != nil {
+				debugLog("port-forward %s: %v", pf.ID, err)
+				return
+			}
+			defer func() { _ = remote.Close() }()
+
+			done := make(chan struct{}, 2)
+			go func() { _, _ = io.Copy(remote, conn); done <- struct{}{} }()
+			go func() { _, _ = io.Copy(conn, remote); done <- struct{}{} }()
+			select {
+			case <-done:
+			case <-pf.stop:
+			}
+		}()
+	}
+}
+
+// portForwardManager tracks forwards per browser session and reaps idle ones
+type portForwardManager struct {
+	mu           sync.Mutex
+	forwards     map[string]*portForward
+	sessionSeen  map[string]time.Time
+	reaperActive bool
+}
+
+var portForwards = &portForwardManager{
+	forwards:    map[string]*portForward{},
+	sessionSeen: map[string]time.Time{},
+}
+
+func (m *portForwardManager) seen(session string) {
+	m.mu.Lock()
+	m.sessionSeen[session] = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *portForwardManager) add(pf *portForward) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.forwards[pf.ID] = pf
+	m.sessionSeen[pf.session] = time.Now()
+	if !m.reaperActive {
+		m.reaperActive = true
+		go m.reap()
+	}
+}
+
+func (m *portForwardManager) list(session string) []portForward {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]portForward, 0)
+	for _, pf := range m.forwards {
+		if pf.session == session {
+			result = append(result, pf.snapshot())
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Created.Before(result[j].Created) })
+	return result
+}
+
+// stop ends a forward owned by session; it reports false when no such forward exists
+func (m *portForwardManager) stop(session, id string) bool {
+	m.mu.Lock()
+	pf, ok := m.forwards[id]
+	if !ok || pf.session != session {
+		m.mu.Unlock()
+		return false
+	}
+	delete(m.forwards, id)
+	m.mu.Unlock()
+
+	pf.close()
+	log.Printf("[INFO] port-forward %s stopped (%s/%s:%d)", pf.ID, pf.Namespace, pf.Pod, pf.RemotePort)
+	return true
+}
+
+// watch drops a forward whose connection to the pod ended without being stopped
+func (m *portForwardManager) watch(pf *portForward) {
+	err := <-pf.done
+	m.mu.Lock()
+	_, ok := m.forwards[pf.ID]
+	delete(m.forwards, pf.ID)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	pf.close()
+	log.Printf("[WARN] port-forward %s ended (%s/%s:%d): %v", pf.ID, pf.Namespace, pf.Pod, pf.RemotePort, err)
+}
+
+// expired returns forwards idle past the timeout or whose session went away; forwards with
+// open connections are kept. Sessions not seen within the timeout are forgotten.
+func (m *portForwardManager) expired(now time.Time) []*portForward {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var expired []*portForward
+	for _, pf := range m.forwards {
+		if pf.busy() {
+			continue
+		}
+		if pf.idleSince(now) > portForwardIdleTimeout || now.Sub(m.sessionSeen[pf.session]) > portForwardSessionTimeout {
+			expired = append(expired, pf)
+		}
+	}
+	for session, seen := range m.sessionSeen {
+		if now.Sub(seen) > portForwardSessionTimeout {
+			delete(m.sessionSeen, session)
+		}
+	}
+	return expired
+}
+
+func (m *portForwardManager) reap() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, pf := range m.expired(now) {
+			m.stop(pf.session, pf.ID)
+		}
+	}
+}
+
+// resolveServiceTarget picks a ready pod behind a service and maps the service port to its target port
+func resolveServiceTarget(ctx context.Context, clientset kubernetes.Interface, namespace, service string, port int) (string, int, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s/%s has no pod selector", namespace, service)
+	}
+
+	var svcPort *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if int(svc.Spec.Ports[i].Port) == port || (port == 0 && i == 0) {
+			svcPort = &svc.Spec.Ports[i]
+			break
+		}
+	}
+	if svcPort == nil {
+		return "", 0, fmt.Errorf("service %s/%s has no port %d", namespace, service, port)
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		target, err := containerPort(pod, svcPort.TargetPort, svcPort.Port)
+		if err != nil {
+			continue
+		}
+		return pod.Name, target, nil
+	}
+	return "", 0, fmt.Errorf("no running pod found for service %s/%s", namespace, service)
+}
+
+// containerPort resolves a (possibly named) target port against a pod's containers
+func containerPort(pod corev1.Pod, target intstr.IntOrString, servicePort int32) (int, error) {
+	switch {
+	case target.Type == intstr.Int && target.IntVal != 0:
+		return int(target.IntVal), nil
+	case target.Type == intstr.String && target.StrVal != "":
+		for _, c := range pod.Spec.Containers {
+			for _, p := range c.Ports {
+				if p.Name == target.StrVal {
+					return int(p.ContainerPort), nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("pod %s has no port named %q", pod.Name, target.StrVal)
+	default:
+		return int(servicePort), nil
+	}
+}
+
+// startPortForward dials the pod through the API server and exposes it on a local port
+func startPortForward(ctx context.Context, contextName string, user *authUser, namespace, pod string, remotePort, localPort int) (*portForward, error) {
+	restConfig, _, err := createRestConfig(contextName, user)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	if err := checkAccess(ctx, clientset, authorizationv1.ResourceAttributes{
+		Verb: "create", Resource: "pods", Subresource: "portforward", Name: pod, Namespace: namespace,
+	}); err != nil {
+		return nil, err
+	}
+
+	url := clientset.CoreV1().RESTClient().Post().Resource("pods").Namespace(namespace).Name(pod).SubResource("portforward").URL()
+	transport, upgrader, err := spdy.RoundTripperFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+	// Prefer tunneling over WebSocket and fall back to SPDY for older API servers
+	if tunneling, err := portforward.NewSPDYOverWebsocketDialer(url, restConfig); err == nil {
+		dialer = portforward.NewFallbackDialer(tunneling, dialer, func(err error) bool {
+			return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+		})
+	}
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", remotePort)}, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	failed := make(chan error, 1)
+	go func() { failed <- fw.ForwardPorts() }()
+
+	select {
+	case <-ready:
+	case err := <-failed:
+		if err == nil {
+			err = errors.New("port-forward ended before it was ready")
+		}
+		return nil, err
+	case <-time.After(30 * time.Second):
+		close(stop)
+		return nil, errors.New("timed out waiting for port-forward")
+	}
+	ports, err := fw.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stop)
+		return nil, fmt.Errorf("port-forward has no local port: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(portForwardAddress, strconv.Itoa(localPort)))
+	if err != nil {
+		close(stop)
+		return nil, fmt.Errorf("cannot bind local port %d: %w", localPort, err)
+	}
+
+	now := time.Now()
+	pf := &portForward{
+		ID:         randomID(8),
+		Context:    contextName,
+		Namespace:  namespace,
+		Pod:        pod,
+		RemotePort: remotePort,
+		Address:    portForwardAddress,
+		LocalPort:  listener.Addr().(*net.TCPAddr).Port,
+		Created:    now,
+		LastActive: now,
+		listener:   listener,
+		stop:       stop,
+		done:       failed,
+	}
+	go pf.serve(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local))))
+	return pf, nil
+}
+
+// createPortForward starts a forward to a pod or service port for the calling session
+func createPortForward(c *gin.Context) {
+	var req struct {
+		Context   string `json:"context"`
+		Namespace string `json:"namespace"`
+		Pod       string `json:"pod"`
+		Service   string `json:"service"`
+		Port      int    `json:"port"`
+		LocalPort int    `json:"localPort"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	if (req.Pod == "") == (req.Service == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of pod or service is required"})
+		return
+	}
+	if req.Port < 0 || req.Port > 65535 || req.LocalPort < 0 || req.LocalPort > 65535 || (req.Pod != "" && req.Port == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "port must be between 1 and 65535"})
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if err := checkPolicy(c, capPortForward, req.Context, req.Namespace); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+	session := clientSessionID(c)
+	ctx := c.Request.Context()
+
+	pod, port := req.Pod, req.Port
+	if req.Service != "" {
+		clientset, _, err := createKubeClient(req.Context, currentUser(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		pod, port, err = resolveServiceTarget(ctx, clientset, req.Namespace, req.Service, req.Port)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	pf, err := startPortForward(ctx, req.Context, currentUser(c), req.Namespace, pod, port, req.LocalPort)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var accessErr *accessError
+		if errors.As(err, &accessErr) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	pf.Service = req.Service
+	pf.session = session
+	portForwards.add(pf)
+	go portForwards.watch(pf)
+
+	log.Printf("[INFO] port-forward %s started %s:%d -> %s/%s:%d (client=%s)", pf.ID, pf.Address, pf.LocalPort, pf.Namespace, pf.Pod, pf.RemotePort, c.ClientIP())
+	recordAudit(c, auditEvent{
+		Verb:      "port-forward",
+		Context:   currentContextName(req.Context),
+		Namespace: pf.Namespace,
+		Objects:   []auditObject{{APIVersion: "v1", Kind: "pod", Namespace: pf.Namespace, Name: pf.Pod}},
+		Details:   map[string]string{"id": pf.ID, "localPort": strconv.Itoa(pf.LocalPort), "remotePort": strconv.Itoa(pf.RemotePort)},
+	})
+	c.JSON(http.StatusCreated, pf.snapshot())
+}
+
+// listPortForwards returns the calling session's forwards
+func listPortForwards(c *gin.Context) {
+	session := clientSessionID(c)
+	portForwards.seen(session)
+	c.JSON(http.StatusOK, portForwards.list(session))
+}
+
+// deletePortForward stops one of the calling session's forwards
+func deletePortForward(c *gin.Context) {
+	session := clientSessionID(c)
+	portForwards.seen(session)
+	if !portForwards.stop(session, c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "port-forward not found"})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "port-forward-stop", Details: map[string]string{"id": c.Param("id")}})
+	c.Status(http.StatusNoContent)
+}
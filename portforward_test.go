@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestResolveServiceTarget verifies services map to a running pod and its target port
+func TestResolveServiceTarget(t *testing.T) {
+	clientset := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "web"},
+				Ports: []corev1.ServicePort{
+					{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+					{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt32(9100)},
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-pending", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodPending},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "app",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	)
+	ctx := context.Background()
+
+	pod, port, err := resolveServiceTarget(ctx, clientset, "prod", "web", 80)
+	require.NoError(t, err)
+	assert.Equal(t, "web-1", pod)
+	assert.Equal(t, 8080, port)
+
+	_, port, err = resolveServiceTarget(ctx, clientset, "prod", "web", 9090)
+	require.NoError(t, err)
+	assert.Equal(t, 9100, port)
+
+	_, port, err = resolveServiceTarget(ctx, clientset, "prod", "web", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 8080, port)
+
+	_, _, err = resolveServiceTarget(ctx, clientset, "prod", "web", 443)
+	assert.ErrorContains(t, err, "has no port 443")
+}
+
+// TestPortForwardProxy verifies connections are piped upstream, tracked, and cut on stop
+func TestPortForwardProxy(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = upstream.Close() }()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				_, _ = conn.Write([]byte("echo " + line))
+			}()
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	m := &portForwardManager{forwards: map[string]*portForward{}, sessionSeen: map[string]time.Time{}, reaperActive: true}
+	pf := &portForward{ID: "a", Pod: "web-1", LastActive: time.Now(), session: "s1", listener: listener, stop: make(chan struct{})}
+	m.add(pf)
+	go pf.serve(upstream.Addr().String())
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo ping\n", reply)
+	assert.Equal(t, 1, pf.snapshot().Active)
+	assert.Zero(t, pf.idleSince(time.Now().Add(time.Hour)))
+
+	assert.Empty(t, m.list("s2"))
+	assert.False(t, m.stop("s2", "a"), "other sessions cannot stop the forward")
+	assert.True(t, m.stop("s1", "a"))
+	assert.Empty(t, m.list("s1"))
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err, "listener is closed after stop")
+	_ = conn.Close()
+}
+
+// TestPortForwardExpiry verifies idle forwards and abandoned sessions are reaped
+func TestPortForwardExpiry(t *testing.T) {
+	now := time.Now()
+	m := &portForwardManager{forwards: map[string]*portForward{}, sessionSeen: map[string]time.Time{}, reaperActive: true}
+	m.forwards["busy"] = &portForward{ID: "busy", session: "s1", LastActive: now.Add(-time.Hour), Active: 1}
+	m.forwards["idle"] = &portForward{ID: "idle", session: "s1", LastActive: now.Add(-portForwardIdleTimeout - time.Second)}
+	m.forwards["gone"] = &portForward{ID: "gone", session: "s2", LastActive: now}
+	m.forwards["open"] = &portForward{ID: "open", session: "s2", LastActive: now.Add(-time.Hour), Active: 2}
+	m.sessionSeen["s1"] = now
+	m.sessionSeen["s2"] = now.Add(-portForwardSessionTimeout - time.Second)
+
+	var ids []string
+	for _, pf := range m.expired(now) {
+		ids = append(ids, pf.ID)
+	}
+	assert.ElementsMatch(t, []string{"idle", "gone"}, ids, "forwards with open connections outlive their session")
+	assert.Equal(t, map[string]time.Time{"s1": now}, m.sessionSeen, "abandoned sessions are forgotten")
+}
+
+// TestPortForwardEnded verifies a forward whose connection to the pod ends is removed and closed
+func TestPortForwardEnded(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	pf := &portForward{ID: "a", session: "s1", listener: listener, stop: make(chan struct{}), done: done}
+	m := &portForwardManager{forwards: map[string]*portForward{}, sessionSeen: map[string]time.Time{}, reaperActive: true}
+	m.add(pf)
+
+	done <- errors.New("lost connection to pod")
+	m.watch(pf)
+	assert.Empty(t, m.list("s1"))
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err, "listener is closed")
+	select {
+	case <-pf.stop:
+	default:
+		t.Error("stop channel is closed")
+	}
+}
+
+// TestCreatePortForwardValidation verifies bad requests fail before touching the cluster
+func TestCreatePortForwardValidation(t *testing.T) {
+	r := setupRouter()
+
+	for body, want := range map[string]string{
+		`{"namespace":"prod","port":80}`:             "exactly one of pod or service",
+		`{"pod":"a","service":"b","port":80}`:        "exactly one of pod or service",
+		`{"pod":"a"}`:                                "port must be between",
+		`{"pod":"a","port":70000}`:                   "port must be between",
+		`{"service":"web","port":80,"localPort":-1}`: "port must be between",
+	} {
+		req, _ := http.NewRequest("POST", "/api/clusters/port-forwards", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), want, body)
+	}
+}
+
+// TestListPortForwardsIssuesSessionCookie verifies callers get a session cookie and an empty list
+func TestListPortForwardsIssuesSessionCookie(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/api/clusters/port-forwards", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+	assert.Contains(t, w.Header().Get("Set-Cookie"), clientSessionCookie+"=")
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+var presetsBucket = []byte("presets")
+
+// Preset names appear in URLs (/ws/logs?preset=name)
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Preset visibility: private presets are only visible to their owner
+const (
+	presetPrivate = "private"
+	presetTeam    = "team"
+)
+
+// streamParamKeys lists the /ws/logs parameters, in the order streamParamsFrom reads them
+var streamParamKeys = func() []string {
+	var keys []string
+	streamParamsFrom(func(key string) string {
+		keys = append(keys, key)
+		return ""
+	})
+	return keys
+}()
+
+var (
+	errPresetNotFound = errors.New("preset not found")
+	errPresetExists   = errors.New("preset already exists")
+)
+
+// preset is a saved /ws/logs query
+type preset struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner"`
+	Visibility  string            `json:"visibility"`
+	Params      map[string]string `json:"params"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// validate checks the name, visibility and that params are /ws/logs parameters that parse
+func (p *preset) validate() error {
+	if !presetNamePattern.MatchString(p.Name) {
+		return errors.New("name must be 1-64 letters, digits, '.', '_' or '-' and start with a letter or digit")
+	}
+	switch p.Visibility {
+	case "":
+		p.Visibility = presetPrivate
+	case presetPrivate, presetTeam:
+	default:
+		return fmt.Errorf("visibility must be %s or %s", presetPrivate, presetTeam)
+	}
+	return validateStreamParams(p.Params)
+}
+
+// validateStreamParams checks that a stored parameter set only holds /ws/logs parameters
+// whose selectors and regexes parse; empty values are dropped
+func validateStreamParams(values map[string]string) error {
+	if len(values) == 0 {
+		return errors.New("params are required")
+	}
+	for key, value := range values {
+		if !slices.Contains(streamParamKeys, key) {
+			return fmt.Errorf("unknown parameter %q", key)
+		}
+		if value == "" {
+			delete(values, key)
+		}
+	}
+	params := streamParamsFrom(func(key string) string { return values[key] })
+	if _, _, err := parseSelectors(params); err != nil {
+		return err
+	}
+	if _, _, _, _, _, _, _, err := parseRegexFilters(params); err != nil {
+		return err
+	}
+	return nil
+}
+
+// visibleTo reports whether owner may read the preset
+func (p *preset) visibleTo(owner string) bool {
+	return p.Visibility == presetTeam || p.Owner == owner
+}
+
+// requestOwner identifies who owns presets created by a request: the authenticated user, or
+// without authentication a digest of the session cookie (a credential, so never stored as is)
+func requestOwner(c *gin.Context) string {
+	if user := currentUser(c); user != nil {
+		return "user:" + user.Name
+	}
+	sum := sha256.Sum256([]byte(clientSessionID(c)))
+	return "session-" + hex.EncodeToString(sum[:8])
+}
+
+func loadPreset(db *bolt.DB, name string) (*preset, error) {
+	var p *preset
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(presetsBucket)
+		if b == nil {
+			return errPresetNotFound
+		}
+		data := b.Get([]byte(name))
+		if data == nil {
+			return errPresetNotFound
+		}
+		p = &preset{}
+		return json.Unmarshal(data, p)
+	})
+	return p, err
+}
+
+// savePreset stores a preset; create fails on an existing name, update on a missing one
+func savePreset(db *bolt.DB, p *preset, create bool) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(presetsBucket)
+		if err != nil {
+			return err
+		}
+		exists := b.Get([]byte(p.Name)) != nil
+		switch {
+		case create && exists:
+			return errPresetExists
+		case !create && !exists:
+			return errPresetNotFound
+		}
+		return b.Put([]byte(p.Name), data)
+	})
+}
+
+// listPresets returns the presets visible to owner, by name
+func listPresets(db *bolt.DB, owner string) ([]*preset, error) {
+	presets := []*preset{}
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(presetsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			p := &preset{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			if p.visibleTo(owner) {
+				presets = append(presets, p)
+			}
+			return nil
+		})
+	})
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, err
+}
+
+// presetParams returns the parameters of a preset visible to owner
+func presetParams(db *bolt.DB, name, owner string) (map[string]string, error) {
+	p, err := loadPreset(db, name)
+	if err == nil && !p.visibleTo(owner) {
+		err = errPresetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("preset %q: %w", name, err)
+	}
+	return p.Params, nil
+}
+
+// expandPreset returns the parameters of the named preset with the request's own parameters
+// layered on top, so a shared URL can still pick another context or narrow the query
+func expandPreset(db *bolt.DB, name, owner string, get func(string) string) (streamParams, error) {
+	values, err := presetParams(db, name, owner)
+	if err != nil {
+		return streamParams{}, err
+	}
+	return streamParamsFrom(func(key string) string {
+		if value := get(key); value != "" {
+			return value
+		}
+		return values[key]
+	}), nil
+}
+
+// resolveStreamParams reads the /ws/logs parameters, expanding ?preset= when present
+func resolveStreamParams(c *gin.Context) (streamParams, error) {
+	name := c.Query("preset")
+	if name == "" {
+		return parseStreamParams(c), nil
+	}
+	db, err := openStore()
+	if err != nil {
+		return parseStreamParams(c), err
+	}
+	params, err := expandPreset(db, name, requestOwner(c), c.Query)
+	if err != nil {
+		return parseStreamParams(c), err
+	}
+	return params, nil
+}
+
+// presetStatus maps store errors to HTTP status codes
+func presetStatus(err error) int {
+	switch {
+	case errors.Is(err, errPresetNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errPresetExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// getPresets lists the presets visible to the caller
+func getPresets(c *gin.Context) {
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	presets, err := listPresets(db, requestOwner(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, presets)
+}
+
+// getPreset returns one preset visible to the caller
+func getPreset(c *gin.Context) {
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := loadPreset(db, c.Param("name"))
+	if err == nil && !p.visibleTo(requestOwner(c)) {
+		err = errPresetNotFound
+	}
+	if err != nil {
+		c.JSON(presetStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// savePresetHandler creates a preset (POST) or replaces one the caller owns (PUT /:name)
+func savePresetHandler(c *gin.Context) {
+	var p preset
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	create := c.Param("name") == ""
+	if !create {
+		p.Name = c.Param("name")
+	}
+	if err := p.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner := requestOwner(c)
+	now := time.Now()
+	p.Owner, p.CreatedAt, p.UpdatedAt = owner, now, now
+	status := http.StatusCreated
+	if !create {
+		existing, err := loadPreset(db, p.Name)
+		if err == nil && !existing.visibleTo(owner) {
+			err = errPresetNotFound
+		}
+		if err != nil {
+			c.JSON(presetStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if existing.Owner != owner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can change a preset"})
+			return
+		}
+		p.CreatedAt = existing.CreatedAt
+		status = http.StatusOK
+	}
+	if err := savePreset(db, &p, create); err != nil {
+		c.JSON(presetStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "preset-save", Details: map[string]string{"name": p.Name, "visibility": p.Visibility}})
+	c.JSON(status, p)
+}
+
+// deletePreset removes a preset the caller owns
+func deletePreset(c *gin.Context) {
+	name := c.Param("name")
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	owner := requestOwner(c)
+	p, err := loadPreset(db, name)
+	if err == nil && !p.visibleTo(owner) {
+		err = errPresetNotFound
+	}
+	if err != nil {
+		c.JSON(presetStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if p.Owner != owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can delete a preset"})
+		return
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.Bucket(presetsBucket).Delete([]byte(name)) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "preset-delete", Details: map[string]string{"name": name}})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPresetValidate verifies names, visibility and parameters are checked
+func TestPresetValidate(t *testing.T) {
+	p := &preset{Name: "payments-errors", Params: map[string]string{"namespace": "payments", "include": "ERROR", "exclude": ""}}
+	require.NoError(t, p.validate())
+	assert.Equal(t, presetPrivate, p.Visibility)
+	assert.Equal(t, map[string]string{"namespace": "payments", "include": "ERROR"}, p.Params)
+
+	for want, bad := range map[string]*preset{
+		"name must be":      {Name: "has space", Params: map[string]string{"namespace": "x"}},
+		"visibility must":   {Name: "x", Visibility: "public", Params: map[string]string{"namespace": "x"}},
+		"params are":        {Name: "x"},
+		"unknown parameter": {Name: "x", Params: map[string]string{"preset": "y"}},
+		"invalid selector":  {Name: "x", Params: map[string]string{"selector": "app in ("}},
+		"invalid include":   {Name: "x", Params: map[string]string{"include": "("}},
+	} {
+		assert.ErrorContains(t, bad.validate(), want)
+	}
+}
+
+// TestPresetStore verifies create/update conflicts and visibility
+func TestPresetStore(t *testing.T) {
+	db := testStore(t)
+	mine := &preset{Name: "mine", Owner: "alice", Visibility: presetPrivate, Params: map[string]string{"namespace": "a"}}
+	team := &preset{Name: "team", Owner: "bob", Visibility: presetTeam, Params: map[string]string{"namespace": "b"}}
+	require.NoError(t, savePreset(db, mine, true))
+	require.NoError(t, savePreset(db, team, true))
+	assert.ErrorIs(t, savePreset(db, mine, true), errPresetExists)
+	assert.ErrorIs(t, savePreset(db, &preset{Name: "missing"}, false), errPresetNotFound)
+
+	presets, err := listPresets(db, "alice")
+	require.NoError(t, err)
+	assert.Len(t, presets, 2)
+	presets, err = listPresets(db, "bob")
+	require.NoError(t, err)
+	require.Len(t, presets, 1)
+	assert.Equal(t, "team", presets[0].Name)
+}
+
+// TestExpandPreset verifies presets expand to stream parameters, request parameters win and
+// private presets stay private
+func TestExpandPreset(t *testing.T) {
+	db := testStore(t)
+	require.NoError(t, savePreset(db, &preset{Name: "errors", Owner: "alice", Visibility: presetTeam, Params: map[string]string{"context": "prod", "namespace": "shop", "include": "ERROR", "tail": "100"}}, true))
+	require.NoError(t, savePreset(db, &preset{Name: "secret", Owner: "alice", Visibility: presetPrivate, Params: map[string]string{"namespace": "x"}}, true))
+
+	query := map[string]string{"preset": "errors", "context": "staging"}
+	params, err := expandPreset(db, "errors", "bob", func(key string) string { return query[key] })
+	require.NoError(t, err)
+	assert.Equal(t, "staging", params.contextName)
+	assert.Equal(t, "shop", params.namespace)
+	assert.Equal(t, "ERROR", params.include)
+	assert.Equal(t, "100", params.tail)
+
+	_, err = expandPreset(db, "secret", "bob", func(string) string { return "" })
+	assert.ErrorIs(t, err, errPresetNotFound)
+	_, err = expandPreset(db, "secret", "alice", func(string) string { return "" })
+	assert.NoError(t, err)
+}
+
+// TestSavePresetRejectsInvalidPreset verifies validation errors are returned as 400
+func TestSavePresetRejectsInvalidPreset(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/presets", strings.NewReader(`{"name":"x","params":{"nope":"1"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown parameter")
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Directory holding recorded /ws/logs sessions
+var recordingsDir = filepath.Join(dataDir, "recordings")
+
+// Uncompressed frame data kept per recording; frames beyond it are dropped and the recording marked truncated
+var recordingMaxSize = envSize("STERN_UI_RECORDING_MAX_SIZE", 256<<20)
+
+// Finished recordings older than this are pruned
+var recordingRetention = envDuration("STERN_UI_RECORDING_RETENTION", 7*24*time.Hour)
+
+// Total compressed size of the recordings; the oldest finished ones are pruned beyond it
+var recordingMaxTotalSize = envSize("STERN_UI_RECORDING_MAX_TOTAL_SIZE", 1<<30)
+
+// Recorded frames are flushed to disk at least this often
+const recordingFlushInterval = time.Second
+
+// How often recording retention is applied
+const recordingPruneInterval = time.Minute
+
+// Response header carrying the recording ID of a recorded /ws/logs session
+const recordingHeader = "X-Stern-UI-Recording"
+
+var recordingsBucket = []byte("recordings")
+
+// recordingInfo describes a recorded /ws/logs session
+type recordingInfo struct {
+	ID        string            `json:"id"`
+	Context   string            `json:"context"`
+	Query     map[string]string `json:"query"`
+	Client    string            `json:"client"`
+	Owner     string            `json:"owner,omitempty"` // requestOwner of the recorded session
+	StartedAt time.Time         `json:"startedAt"`
+	EndedAt   *time.Time        `json:"endedAt,omitempty"`
+	Frames    int               `json:"frames"`
+	Size      int64             `json:"size"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// recordedFrame is one outbound WebSocket text frame and when it was sent
+type recordedFrame struct {
+	Offset time.Duration `json:"offset"` // since the recording started
+	Data   string        `json:"data"`
+}
+
+// sessionRecorder writes the frames of a session to a gzip-compressed JSON-lines file
+type sessionRecorder struct {
+	mu        sync.Mutex
+	db        *bolt.DB
+	info      recordingInfo
+	file      *os.File
+	gz        *gzip.Writer
+	maxSize   int64
+	lastFlush time.Time
+	failed    bool
+}
+
+func recordingPath(dir, id string) string {
+	return filepath.Join(dir, id+".jsonl.gz")
+}
+
+func putRecording(db *bolt.DB, info recordingInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(recordingsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(info.ID), data)
+	})
+}
+
+// startRecording creates the recording file and its index entry
+func startRecording(db *bolt.DB, dir string, info recordingInfo) (*sessionRecorder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cannot create recordings directory: %w", err)
+	}
+	file, err := os.OpenFile(recordingPath(dir, info.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := putRecording(db, info); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &sessionRecorder{db: db, info: info, file: file, gz: gzip.NewWriter(file), maxSize: recordingMaxSize, lastFlush: info.StartedAt}, nil
+}
+
+// frame records an outbound frame; a nil recorder records nothing
+func (r *sessionRecorder) frame(data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed || r.info.Truncated {
+		return
+	}
+	if r.info.Size+int64(len(data)) > r.maxSize {
+		r.info.Truncated = true
+		log.Printf("[WARN] recording %s reached %d bytes, later frames are not recorded", r.info.ID, r.maxSize)
+		return
+	}
+	now := time.Now()
+	line, _ := json.Marshal(recordedFrame{Offset: now.Sub(r.info.StartedAt), Data: string(data)})
+	if _, err := r.gz.Write(append(line, '\n')); err != nil {
+		r.fail(err)
+		return
+	}
+	r.info.Frames++
+	r.info.Size += int64(len(data))
+	if now.Sub(r.lastFlush) >= recordingFlushInterval {
+		r.lastFlush = now
+		if err := r.gz.Flush(); err != nil {
+			r.fail(err)
+		}
+	}
+}
+
+// fail stops recording after a write error; callers hold r.mu
+func (r *sessionRecorder) fail(err error) {
+	r.failed = true
+	log.Printf("[WARN] recording %s stopped: %v", r.info.ID, err)
+}
+
+// close finishes the file and records the final frame count and end time
+func (r *sessionRecorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.gz.Close()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	ended := time.Now()
+	r.info.EndedAt = &ended
+	if putErr := putRecording(r.db, r.info); err == nil {
+		err = putErr
+	}
+	return err
+}
+
+var recordingsOnce sync.Once
+
+// openRecordings opens the store for recordings, the first time ending the ones a previous run
+// left open, as newLogArchive closes the segments it left open, and starting retention
+func openRecordings() (*bolt.DB, error) {
+	db, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	recordingsOnce.Do(func() {
+		if err := finishInterruptedRecordings(db, recordingsDir); err != nil {
+			log.Printf("[WARN] recordings: %v", err)
+		}
+		go func() {
+			for now := range time.Tick(recordingPruneInterval) {
+				if err := pruneRecordings(db, recordingsDir, recordingRetention, recordingMaxTotalSize, now); err != nil {
+					log.Printf("[WARN] recordings: %v", err)
+				}
+			}
+		}()
+	})
+	return db, nil
+}
+
+// pruneRecordings deletes finished recordings past the retention, then the oldest ones while
+// their files together exceed maxSize; recordings in progress are kept
+func pruneRecordings(db *bolt.DB, dir string, retention time.Duration, maxSize int64, now time.Time) error {
+	var recordings []recordingInfo
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var info recordingInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			recordings = append(recordings, info)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].StartedAt.Before(recordings[j].StartedAt) })
+	sizes := make([]int64, len(recordings))
+	var total int64
+	for i, info := range recordings {
+		if stat, err := os.Stat(recordingPath(dir, info.ID)); err == nil {
+			sizes[i] = stat.Size()
+			total += sizes[i]
+		}
+	}
+	cutoff := now.Add(-retention)
+	var expired []string
+	for i, info := range recordings {
+		if info.EndedAt == nil {
+			continue
+		}
+		if info.EndedAt.Before(cutoff) || total > maxSize {
+			expired = append(expired, info.ID)
+			total -= sizes[i]
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	for _, id := range expired {
+		if err := os.Remove(recordingPath(dir, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		for _, id := range expired {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// finishInterruptedRecordings ends the recordings a crash or restart left open, with the frame
+// count, size and end time of what reached their file, so they can be deleted
+func finishInterruptedRecordings(db *bolt.DB, dir string) error {
+	var open []recordingInfo
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var info recordingInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			if info.EndedAt == nil {
+				open = append(open, info)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for _, info := range open {
+		info.Frames, info.Size = 0, 0
+		var last time.Duration
+		err := readRecording(dir, info.ID, func(frame recordedFrame) error {
+			info.Frames++
+			info.Size += int64(len(frame.Data))
+			last = frame.Offset
+			return nil
+		})
+		if err != nil {
+			debugLog("recording %s: %v", info.ID, err) // frames up to the damage still count
+		}
+		ended := info.StartedAt.Add(last)
+		info.EndedAt = &ended
+		if err := putRecording(db, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadRecording(db *bolt.DB, id string) (recordingInfo, bool, error) {
+	var info recordingInfo
+	var found bool
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &info)
+	})
+	return info, found, err
+}
+
+// readRecording calls fn for every frame, stopping at the first error fn returns
+func readRecording(dir, id string, fn func(recordedFrame) error) error {
+	file, err := os.Open(recordingPath(dir, id))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var frame recordedFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return fmt.Errorf("corrupt recording: %w", err)
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+	// Recordings still in progress, or cut short by a crash, end without a gzip trailer
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return nil
+}
+
+// replaySpeed parses ?speed=: 1 (default) and 10 keep the recorded pacing, scaled; instant sends everything at once
+func replaySpeed(raw string) (float64, error) {
+	switch raw {
+	case "", "1", "1x":
+		return 1, nil
+	case "10", "10x":
+		return 10, nil
+	case "instant":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("invalid speed %q: use 1x, 10x or instant", raw)
+}
+
+// replayFrames sends the frames of a recording through send, sleeping the recorded gaps divided by speed
+func replayFrames(ctx context.Context, dir, id string, speed float64, send func([]byte) error) error {
+	var previous time.Duration
+	return readRecording(dir, id, func(frame recordedFrame) error {
+		if speed > 0 {
+			wait := time.Duration(float64(frame.Offset-previous) / speed)
+			previous = frame.Offset
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		return send([]byte(frame.Data))
+	})
+}
+
+// recordingQuery keeps the /ws/logs parameters of a recorded session, without the record flag
+func recordingQuery(c *gin.Context) map[string]string {
+	query := map[string]string{}
+	for key, values := range c.Request.URL.Query() {
+		if key != "record" && len(values) > 0 {
+			query[key] = values[0]
+		}
+	}
+	return query
+}
+
+// startStreamRecording starts recording a /ws/logs session when ?record=true
+func startStreamRecording(c *gin.Context, contextName string) (*sessionRecorder, error) {
+	if c.Query("record") != "true" {
+		return nil, nil
+	}
+	db, err := openRecordings()
+	if err != nil {
+		return nil, err
+	}
+	recorder, err := startRecording(db, recordingsDir, recordingInfo{
+		ID:        randomID(8),
+		Context:   currentContextName(contextName),
+		Query:     recordingQuery(c),
+		Client:    c.ClientIP(),
+		Owner:     requestOwner(c),
+		StartedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(c, auditEvent{Verb: "record", Context: recorder.info.Context, Namespace: recorder.info.Query["namespace"], Result: auditStarted, Details: map[string]string{"id": recorder.info.ID}})
+	return recorder, nil
+}
+
+// listRecordings returns the recorded sessions whose context and namespaces the caller may read, newest first
+func listRecordings(c *gin.Context) {
+	db, err := openRecordings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordings := []recordingInfo{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(recordingsBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var info recordingInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return err
+			}
+			if checkQueryPolicy(c, info.Context, info.Query) == nil {
+				recordings = append(recordings, info)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].StartedAt.After(recordings[j].StartedAt) })
+	c.JSON(http.StatusOK, recordings)
+}
+
+// deleteRecording removes a recording the caller owns and its file
+func deleteRecording(c *gin.Context) {
+	id := c.Param("id")
+	db, err := openRecordings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	info, found, err := loadRecording(db, id)
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	case !found, checkQueryPolicy(c, info.Context, info.Query) != nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	case info.Owner != requestOwner(c):
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can delete a recording"})
+		return
+	case info.EndedAt == nil:
+		c.JSON(http.StatusConflict, gin.H{"error": "recording is still in progress"})
+		return
+	}
+	if err := os.Remove(recordingPath(recordingsDir, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return tx.Bucket(recordingsBucket).Delete([]byte(id)) }); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "recording-delete", Details: map[string]string{"id": id}})
+	c.Status(http.StatusNoContent)
+}
+
+// replayRecording plays a recording back over a WebSocket with the frames /ws/logs sent,
+// so the log viewer renders it like a live stream
+func replayRecording(c *gin.Context) {
+	id := c.Param("id")
+	speed, err := replaySpeed(c.Query("speed"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	db, err := openRecordings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	info, found, err := loadRecording(db, id)
+	if err != nil || !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "recording not found"})
+		return
+	}
+	if err := checkQueryPolicy(c, info.Context, info.Query); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+	if !preflightCollectedLogs(c, info.Context, streamNamespaces(info.Query["namespace"], info.Query["allNamespaces"])) {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	writer := &WebSocketWriter{conn: conn}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setupWebSocketHandlers(conn, ctx, cancel, writer)
+
+	err = replayFrames(ctx, recordingsDir, id, speed, func(data []byte) error {
+		return writer.WriteMessage(websocket.TextMessage, data)
+	})
+	if err != nil && ctx.Err() == nil {
+		writer.WriteError(err)
+		return
+	}
+	_ = writer.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "end of recording"))
+}
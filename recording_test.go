@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecorder(t *testing.T) (*sessionRecorder, string) {
+	dir := t.TempDir()
+	recorder, err := startRecording(testStore(t), dir, recordingInfo{ID: "rec1", Context: "prod", StartedAt: time.Now()})
+	require.NoError(t, err)
+	return recorder, dir
+}
+
+// TestSessionRecorder verifies frames are stored with their timing and the index entry is finalized
+func TestSessionRecorder(t *testing.T) {
+	recorder, dir := testRecorder(t)
+	recorder.frame([]byte(`{"podName":"web-1","message":"one"}`))
+	time.Sleep(20 * time.Millisecond)
+	recorder.frame([]byte(`{"error":"stream ended"}`))
+	require.NoError(t, recorder.close())
+
+	info, found, err := loadRecording(recorder.db, "rec1")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, 2, info.Frames)
+	assert.NotNil(t, info.EndedAt)
+
+	var frames []recordedFrame
+	require.NoError(t, readRecording(dir, "rec1", func(f recordedFrame) error {
+		frames = append(frames, f)
+		return nil
+	}))
+	require.Len(t, frames, 2)
+	assert.Equal(t, `{"error":"stream ended"}`, frames[1].Data)
+	assert.GreaterOrEqual(t, frames[1].Offset-frames[0].Offset, 20*time.Millisecond)
+}
+
+// TestSessionRecorderMaxSize verifies frames past the size limit are dropped and the recording marked truncated
+func TestSessionRecorderMaxSize(t *testing.T) {
+	recorder, _ := testRecorder(t)
+	recorder.maxSize = 10
+	recorder.frame([]byte("12345"))
+	recorder.frame([]byte("1234567"))
+	recorder.frame([]byte("1"))
+	require.NoError(t, recorder.close())
+	assert.Equal(t, 1, recorder.info.Frames)
+	assert.True(t, recorder.info.Truncated)
+}
+
+// TestReplayFrames verifies speeds scale the recorded gaps and instant sends everything at once
+func TestReplayFrames(t *testing.T) {
+	recorder, dir := testRecorder(t)
+	recorder.frame([]byte("a"))
+	time.Sleep(200 * time.Millisecond)
+	recorder.frame([]byte("b"))
+	require.NoError(t, recorder.close())
+
+	for _, tc := range []struct {
+		speed    string
+		min, max time.Duration
+	}{
+		{"1x", 200 * time.Millisecond, time.Second},
+		{"10x", 0, 150 * time.Millisecond},
+		{"instant", 0, 50 * time.Millisecond},
+	} {
+		speed, err := replaySpeed(tc.speed)
+		require.NoError(t, err)
+		var got []string
+		start := time.Now()
+		require.NoError(t, replayFrames(context.Background(), dir, "rec1", speed, func(data []byte) error {
+			got = append(got, string(data))
+			return nil
+		}))
+		elapsed := time.Since(start)
+		assert.Equal(t, []string{"a", "b"}, got)
+		assert.GreaterOrEqual(t, elapsed, tc.min, tc.speed)
+		assert.Less(t, elapsed, tc.max, tc.speed)
+	}
+
+	_, err := replaySpeed("2x")
+	assert.ErrorContains(t, err, "invalid speed")
+}
+
+// TestWebSocketWriterRecordsFrames verifies the frames a client receives are the frames recorded
+func TestWebSocketWriterRecordsFrames(t *testing.T) {
+	recorder, dir := testRecorder(t)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		writer := &WebSocketWriter{conn: conn, recorder: recorder}
+		_, _ = writer.Write([]byte("{\"message\":\"one\"}\n{\"message\":\"two\"}\n"))
+		writer.WriteError(assert.AnError)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	var received []string
+	for i := 0; i < 3; i++ {
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		received = append(received, string(data))
+	}
+	<-done
+	require.NoError(t, recorder.close())
+
+	var recorded []string
+	require.NoError(t, readRecording(dir, "rec1", func(f recordedFrame) error {
+		recorded = append(recorded, f.Data)
+		return nil
+	}))
+	assert.Equal(t, received, recorded)
+}
+
+// TestReplayRecordingRejectsBadSpeed verifies the speed parameter is validated before upgrading
+func TestReplayRecordingRejectsBadSpeed(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/ws/replay/abc?speed=3x", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestRecordingOwnership verifies only the recorder deletes a recording and recordings outside the policy are hidden
+func TestRecordingOwnership(t *testing.T) {
+	t.Setenv("STERN_UI_AUTH_TOKENS_FILE", writeTestFile(t, "tokens.csv", "alice-token,alice\nbob-token,bob\ncarol-token,carol\n"))
+	testPolicyEngine(t, "rules:\n- users: [alice, bob]\n  contexts: ['*']\n  namespaces: [shop]\n  capabilities: [logs]\n- users: [carol]\n  contexts: ['*']\n  namespaces: [billing]\n  capabilities: [logs]\n")
+	r := setupRouter()
+	serve := func(token, method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	db, err := openStore()
+	require.NoError(t, err)
+	recorder, err := startRecording(db, recordingsDir, recordingInfo{ID: "rec-" + randomID(4), Context: "dev", Query: map[string]string{"namespace": "shop"}, Owner: "user:alice", StartedAt: time.Now()})
+	require.NoError(t, err)
+	require.NoError(t, recorder.close())
+	path := "/api/recordings/" + recorder.info.ID
+
+	assert.Contains(t, serve("bob-token", "GET", "/api/recordings").Body.String(), recorder.info.ID)
+	assert.NotContains(t, serve("carol-token", "GET", "/api/recordings").Body.String(), recorder.info.ID)
+	assert.Equal(t, http.StatusForbidden, serve("bob-token", "DELETE", path).Code)
+	assert.Equal(t, http.StatusNotFound, serve("carol-token", "DELETE", path).Code)
+	assert.Equal(t, http.StatusNoContent, serve("alice-token", "DELETE", path).Code)
+}
+
+// TestFinishInterruptedRecordings verifies a recording left open by a crash is ended with what reached its file
+func TestFinishInterruptedRecordings(t *testing.T) {
+	recorder, dir := testRecorder(t)
+	recorder.frame([]byte("one"))
+	recorder.frame([]byte("three"))
+	require.NoError(t, recorder.gz.Flush())
+
+	require.NoError(t, finishInterruptedRecordings(recorder.db, dir))
+
+	info, found, err := loadRecording(recorder.db, "rec1")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NotNil(t, info.EndedAt)
+	assert.False(t, info.EndedAt.Before(info.StartedAt))
+	assert.Equal(t, 2, info.Frames)
+	assert.Equal(t, int64(8), info.Size)
+}
+
+// TestPruneRecordings verifies time- and size-based retention only removes finished recordings
+func TestPruneRecordings(t *testing.T) {
+	db := testStore(t)
+	dir := t.TempDir()
+	now := time.Now()
+	var recorders []*sessionRecorder
+	for i, started := range []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Minute), now.Add(-time.Minute), now} {
+		recorder, err := startRecording(db, dir, recordingInfo{ID: fmt.Sprintf("rec%d", i), StartedAt: started})
+		require.NoError(t, err)
+		recorder.frame([]byte("line"))
+		recorders = append(recorders, recorder)
+	}
+	for _, recorder := range recorders[:3] {
+		require.NoError(t, recorder.close())
+	}
+	ended := now.Add(-2 * time.Hour)
+	recorders[0].info.EndedAt = &ended
+	require.NoError(t, putRecording(db, recorders[0].info))
+
+	require.NoError(t, pruneRecordings(db, dir, time.Hour, 1<<30, now))
+	_, found, err := loadRecording(db, "rec0")
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, err = os.Stat(recordingPath(dir, "rec0"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Over the size limit the oldest finished recordings go; the one in progress stays
+	require.NoError(t, pruneRecordings(db, dir, time.Hour, 1, now))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "rec3.jsonl.gz", entries[0].Name())
+	require.NoError(t, recorders[3].close())
+}
+
+// TestStreamLogsSkipsRecordingOnPresetError verifies a session that only reports a preset error is not recorded
+func TestStreamLogsSkipsRecordingOnPresetError(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	defer server.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs?preset=missing&record=true", nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.Empty(t, resp.Header.Get(recordingHeader))
+	_, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "error")
+}
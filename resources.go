@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// apiResource is a listable resource kind discovered from the API server
+type apiResource struct {
+	ID         string   `json:"id"` // plural in the core group, plural.group otherwise
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`
+	Group      string   `json:"group"`
+	Version    string   `json:"version"`
+	Namespaced bool     `json:"namespaced"`
+	ShortNames []string `json:"shortNames,omitempty"`
+	Verbs      []string `json:"verbs"`
+
+	singular string
+}
+
+func (r apiResource) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Name}
+}
+
+func (r apiResource) supports(verb string) bool {
+	for _, v := range r.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverResources returns every listable top-level resource at its preferred version.
+// Partial discovery failures (e.g. an unavailable aggregated API) still return what was found.
+func discoverResources(disco discovery.DiscoveryInterface) ([]apiResource, error) {
+	lists, err := discovery.ServerPreferredResources(disco)
+	if err != nil && len(lists) == 0 {
+		return nil, fmt.Errorf("failed to discover API resources: %w", err)
+	}
+	if err != nil {
+		debugLog("Partial API discovery: %v", err)
+	}
+
+	var resources []apiResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				continue // subresource
+			}
+			res := apiResource{
+				ID:         r.Name,
+				Name:       r.Name,
+				Kind:       r.Kind,
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Namespaced: r.Namespaced,
+				ShortNames: r.ShortNames,
+				Verbs:      r.Verbs,
+				singular:   r.SingularName,
+			}
+			if gv.Group != "" {
+				res.ID = r.Name + "." + gv.Group
+			}
+			if !res.supports("list") {
+				continue
+			}
+			resources = append(resources, res)
+		}
+	}
+
+	sort.SliceStable(resources, func(i, j int) bool { return resources[i].ID < resources[j].ID })
+	return resources, nil
+}
+
+// resolveResource finds the resource a kind argument refers to, the way kubectl get does:
+// plural, singular, Kind, short name, or plural.group. Core group matches win ties.
+func resolveResource(resources []apiResource, kind string) (apiResource, bool) {
+	kind = strings.ToLower(kind)
+	var found *apiResource
+	for i := range resources {
+		r := resources[i]
+		match := kind == r.ID || kind == r.Name || kind == r.singular || kind == strings.ToLower(r.Kind)
+		for _, sn := range r.ShortNames {
+			match = match || kind == sn
+		}
+		if !match {
+			continue
+		}
+		if r.Group == "" {
+			return r, true
+		}
+		if found == nil {
+			found = &resources[i]
+		}
+	}
+	if found == nil {
+		return apiResource{}, false
+	}
+	return *found, true
+}
+
+// Built-in API groups without a dot; every other group (including all CRD groups) is dotted
+var dotlessGroups = map[string]bool{
+	"apps":        true,
+	"batch":       true,
+	"autoscaling": true,
+	"policy":      true,
+	"extensions":  true,
+}
+
+var kindArgPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// validKindArg rejects kind arguments that cannot name a resource before touching the cluster
+func validKindArg(kind string) bool {
+	if !kindArgPattern.MatchString(kind) {
+		return false
+	}
+	_, group, hasGroup := strings.Cut(kind, ".")
+	if !hasGroup {
+		return true
+	}
+	return strings.Contains(group, ".") || dotlessGroups[group]
+}
+
+// resourcePolicy decides which discovered kinds can be browsed. Patterns are path.Match
+// globs against the resource ID (e.g. "secrets", "*.cert-manager.io", "rollouts.argoproj.io").
+type resourcePolicy struct {
+	allow []string
+	deny  []string
+}
+
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// loadResourcePolicy reads STERN_UI_RESOURCES_ALLOW / STERN_UI_RESOURCES_DENY (comma-separated globs).
+// Secrets are denied when the secrets feature is off.
+func loadResourcePolicy(features featureSet) resourcePolicy {
+	allow := splitPatterns(os.Getenv("STERN_UI_RESOURCES_ALLOW"))
+	if len(allow) == 0 {
+		allow = []string{"*"}
+	}
+	deny := splitPatterns(os.Getenv("STERN_UI_RESOURCES_DENY"))
+	if !features.enabled(featureSecrets) {
+		deny = append(deny, "secrets")
+	}
+	return resourcePolicy{allow: allow, deny: deny}
+}
+
+func matchesAny(patterns []string, r apiResource) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, r.ID); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, r.Name); ok && r.Group == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p resourcePolicy) allows(r apiResource) bool {
+	return matchesAny(p.allow, r) && !matchesAny(p.deny, r)
+}
+
+// Resource policy of the browser, built by newRouter from the same features it registers routes for
+var resourceAccess resourcePolicy
+
+const discoveryTTL = 5 * time.Minute
+
+type discoveryEntry struct {
+	resources []apiResource
+	fetched   time.Time
+}
+
+// Discovery results per context, refreshed after discoveryTTL so new CRDs show up
+var (
+	discoveryMu    sync.Mutex
+	discoveryCache = map[string]discoveryEntry{}
+)
+
+func cachedResources(contextName string, disco discovery.DiscoveryInterface) ([]apiResource, error) {
+	discoveryMu.Lock()
+	entry, ok := discoveryCache[contextName]
+	discoveryMu.Unlock()
+	if ok && time.Since(entry.fetched) < discoveryTTL {
+		return entry.resources, nil
+	}
+
+	resources, err := discoverResources(disco)
+	if err != nil {
+		return nil, err
+	}
+	discoveryMu.Lock()
+	discoveryCache[contextName] = discoveryEntry{resources: resources, fetched: time.Now()}
+	discoveryMu.Unlock()
+	return resources, nil
+}
+
+// refreshResources drops the cached discovery of a context and discovers it again
+func refreshResources(contextName string, disco discovery.DiscoveryInterface) ([]apiResource, error) {
+	discoveryMu.Lock()
+	delete(discoveryCache, contextName)
+	discoveryMu.Unlock()
+	return cachedResources(contextName, disco)
+}
+
+func createDynamicClient(contextName string, user *authUser) (dynamic.Interface, discovery.DiscoveryInterface, error) {
+	restConfig, _, err := createRestConfig(contextName, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	disco, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	return dyn, disco, nil
+}
+
+// lookupResource validates, resolves and policy-checks a kind argument.
+// It writes the error response itself and returns false when the request should stop.
+func lookupResource(c *gin.Context, contextName, kind string) (dynamic.Interface, apiResource, bool) {
+	if !validKindArg(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported resource kind %q", kind)})
+		return nil, apiResource{}, false
+	}
+
+	dyn, disco, err := createDynamicClient(contextName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, apiResource{}, false
+	}
+	resources, err := cachedResources(contextName, disco)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, apiResource{}, false
+	}
+
+	res, ok := resolveResource(resources, kind)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported resource kind %q", kind)})
+		return nil, apiResource{}, false
+	}
+	if !resourceAccess.allows(res) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("resource kind %q is not allowed by policy", res.ID)})
+		return nil, apiResource{}, false
+	}
+	// The middleware checked ?namespace=, which handlers ignore for cluster-scoped kinds
+	if !res.Namespaced {
+		if err := checkPolicy(c, capView, contextName, ""); err != nil {
+			denyPolicy(c, err)
+			return nil, apiResource{}, false
+		}
+	}
+	return dyn, res, true
+}
+
+// listableKinds keeps the resources the policy allows and the identity may list in namespace.
+// When the rules review fails or is incomplete (webhook authorizers) RBAC filtering is skipped
+// and listing a kind decides, as with checkAccess.
+func listableKinds(ctx context.Context, clientset kubernetes.Interface, namespace string, resources []apiResource) []apiResource {
+	review, err := clientset.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, &authorizationv1.SelfSubjectRulesReview{
+		Spec: authorizationv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}, metav1.CreateOptions{})
+	filter := err == nil && !review.Status.Incomplete
+	if !filter {
+		debugLog("Skipping RBAC filtering of resource kinds in %q: err=%v", namespace, err)
+	}
+
+	kinds := make([]apiResource, 0, len(resources))
+	for _, r := range resources {
+		if !resourceAccess.allows(r) {
+			continue
+		}
+		if filter && !rulesAllow(review.Status.ResourceRules, "list", r.Group, r.Name) {
+			continue
+		}
+		kinds = append(kinds, r)
+	}
+	return kinds
+}
+
+// getResourceKinds lists every resource kind the server can list, the policy allows and the
+// caller may list in ?namespace= (default "default")
+func getResourceKinds(c *gin.Context) {
+	ctxName := c.Query("context")
+	namespace := c.Query("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	_, disco, err := createDynamicClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	resources, err := cachedResources(ctxName, disco)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	clientset, _, err := createKubeClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, listableKinds(c.Request.Context(), clientset, namespace, resources))
+}
+
+// getClusterResources lists any discovered resource kind for a context
+func getClusterResources(c *gin.Context) {
+	ctxName := c.Query("context")
+	kind := strings.ToLower(strings.TrimSpace(c.Query("kind")))
+	namespace := strings.TrimSpace(c.Query("namespace"))
+
+	dyn, res, ok := lookupResource(c, ctxName, kind)
+	if !ok {
+		return
+	}
+	listNamespace := ""
+	if res.Namespaced {
+		listNamespace = namespace
+	}
+	if !preflight(c, ctxName, authorizationv1.ResourceAttributes{Verb: "list", Group: res.Group, Resource: res.Name, Namespace: listNamespace}) {
+		return
+	}
+
+	var client dynamic.ResourceInterface = dyn.Resource(res.gvr())
+	if res.Namespaced && namespace != "" {
+		client = dyn.Resource(res.gvr()).Namespace(namespace)
+	}
+	list, err := client.List(c.Request.Context(), metav1.ListOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := make([]gin.H, 0, len(list.Items))
+	for _, it := range list.Items {
+		items = append(items, gin.H{
+			"name":      it.GetName(),
+			"namespace": it.GetNamespace(),
+			"created":   it.GetCreationTimestamp().UTC().Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"kind": kind, "resource": res.ID, "namespaced": res.Namespaced, "items": items})
+}
+
+// getResourceDetail returns the full YAML of a single resource
+func getResourceDetail(c *gin.Context) {
+	ctxName := c.Query("context")
+	kind := strings.ToLower(strings.TrimSpace(c.Query("kind")))
+	name := strings.TrimSpace(c.Query("name"))
+	namespace := strings.TrimSpace(c.Query("namespace"))
+
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid resource name"})
+		return
+	}
+
+	dyn, res, ok := lookupResource(c, ctxName, kind)
+	if !ok {
+		return
+	}
+
+	var client dynamic.ResourceInterface = dyn.Resource(res.gvr())
+	if res.Namespaced {
+		if namespace == "" {
+			namespace = "default"
+		}
+		client = dyn.Resource(res.gvr()).Namespace(namespace)
+	} else {
+		namespace = ""
+	}
+	if !preflight(c, ctxName, authorizationv1.ResourceAttributes{Verb: "get", Group: res.Group, Resource: res.Name, Name: name, Namespace: namespace}) {
+		return
+	}
+	obj, err := client.Get(c.Request.Context(), name, metav1.GetOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Match kubectl get -o yaml, which hides managed fields by default
+	obj.SetManagedFields(nil)
+	masked := maskSensitiveData(obj, res)
+	out, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render yaml: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"kind": kind, "name": name, "yaml": string(out), "masked": masked})
+}
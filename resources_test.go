@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func fakeDiscovery() *fakediscovery.FakeDiscovery {
+	listVerbs := metav1.Verbs{"get", "list", "watch"}
+	return &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Verbs: listVerbs},
+				{Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+				{Name: "secrets", SingularName: "secret", Kind: "Secret", Namespaced: true, Verbs: listVerbs},
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, Verbs: listVerbs},
+				{Name: "nodes", SingularName: "node", Kind: "Node", Namespaced: false, ShortNames: []string{"no"}, Verbs: listVerbs},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+			},
+		},
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, Verbs: listVerbs},
+			},
+		},
+		{
+			GroupVersion: "cert-manager.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "certificates", SingularName: "certificate", Kind: "Certificate", Namespaced: true, ShortNames: []string{"cert"}, Verbs: listVerbs},
+			},
+		},
+	}}}
+}
+
+// TestDiscoverResources verifies subresources and non-listable kinds are skipped
+func TestDiscoverResources(t *testing.T) {
+	resources, err := discoverResources(fakeDiscovery())
+	require.NoError(t, err)
+
+	var ids []string
+	for _, r := range resources {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []string{"certificates.cert-manager.io", "events", "events.events.k8s.io", "nodes", "pods", "secrets"}, ids)
+}
+
+// TestResolveResource verifies kubectl-style kind resolution, including CRDs
+func TestResolveResource(t *testing.T) {
+	resources, err := discoverResources(fakeDiscovery())
+	require.NoError(t, err)
+
+	for arg, want := range map[string]string{
+		"pods":                         "pods",
+		"po":                           "pods",
+		"Pod":                          "pods",
+		"events":                       "events",
+		"events.events.k8s.io":         "events.events.k8s.io",
+		"cert":                         "certificates.cert-manager.io",
+		"certificates.cert-manager.io": "certificates.cert-manager.io",
+	} {
+		r, ok := resolveResource(resources, arg)
+		require.True(t, ok, arg)
+		assert.Equal(t, want, r.ID, arg)
+	}
+
+	nodes, _ := resolveResource(resources, "nodes")
+	assert.False(t, nodes.Namespaced, "cluster scope comes from discovery")
+
+	_, ok := resolveResource(resources, "rollouts")
+	assert.False(t, ok)
+}
+
+// TestValidKindArg verifies malformed kinds are rejected without a cluster round-trip
+func TestValidKindArg(t *testing.T) {
+	assert.True(t, validKindArg("configmaps"))
+	assert.True(t, validKindArg("deployments.apps"))
+	assert.True(t, validKindArg("rollouts.argoproj.io"))
+	assert.False(t, validKindArg("deployments.replicasets"))
+	assert.False(t, validKindArg("-f"))
+	assert.False(t, validKindArg("pods/log"))
+}
+
+// TestResourcePolicy verifies allow/deny globs
+func TestResourcePolicy(t *testing.T) {
+	resources, err := discoverResources(fakeDiscovery())
+	require.NoError(t, err)
+	secrets, _ := resolveResource(resources, "secrets")
+	certs, _ := resolveResource(resources, "certificates")
+	pods, _ := resolveResource(resources, "pods")
+
+	t.Setenv("STERN_UI_RESOURCES_DENY", "secrets, *.cert-manager.io")
+	p := loadResourcePolicy(featureSet{})
+	assert.False(t, p.allows(secrets))
+	assert.False(t, p.allows(certs))
+	assert.True(t, p.allows(pods))
+
+	t.Setenv("STERN_UI_RESOURCES_ALLOW", "pods,nodes")
+	t.Setenv("STERN_UI_RESOURCES_DENY", "")
+	p = loadResourcePolicy(featureSet{})
+	assert.True(t, p.allows(pods))
+	assert.False(t, p.allows(certs))
+}
+
+// TestListableKinds verifies kinds are filtered by the rules the identity holds in the namespace
+func TestListableKinds(t *testing.T) {
+	previous := resourceAccess
+	resourceAccess = loadResourcePolicy(featureSet{})
+	t.Cleanup(func() { resourceAccess = previous })
+	resources, err := discoverResources(fakeDiscovery())
+	require.NoError(t, err)
+	rulesClient := func(status authorizationv1.SubjectRulesReviewStatus, err error) *fake.Clientset {
+		clientset := fake.NewClientset()
+		clientset.PrependReactor("create", "selfsubjectrulesreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectRulesReview)
+			assert.Equal(t, "shop", review.Spec.Namespace)
+			review.Status = status
+			return true, review, err
+		})
+		return clientset
+	}
+	ids := func(kinds []apiResource) []string {
+		var ids []string
+		for _, k := range kinds {
+			ids = append(ids, k.ID)
+		}
+		return ids
+	}
+
+	kinds := listableKinds(context.Background(), rulesClient(authorizationv1.SubjectRulesReviewStatus{ResourceRules: []authorizationv1.ResourceRule{
+		{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "events"}},
+		{Verbs: []string{"*"}, APIGroups: []string{"cert-manager.io"}, Resources: []string{"*"}},
+		{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"db"}},
+		{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"nodes"}},
+	}}, nil), "shop", resources)
+	assert.ElementsMatch(t, []string{"pods", "events", "certificates.cert-manager.io"}, ids(kinds))
+
+	all := listableKinds(context.Background(), rulesClient(authorizationv1.SubjectRulesReviewStatus{Incomplete: true}, nil), "shop", resources)
+	assert.Len(t, all, len(resources), "incomplete rules are not used to filter")
+	all = listableKinds(context.Background(), rulesClient(authorizationv1.SubjectRulesReviewStatus{}, errors.New("not supported")), "shop", resources)
+	assert.Len(t, all, len(resources))
+}
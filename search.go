@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Terms longer than this are not indexed; they are almost always hashes or payloads
+const maxTermLength = 64
+
+// Maximum hits a search collects; total reports at most this many
+const searchMaxHits = 10000
+
+// Postings live in one sub-bucket per segment, keyed like the segment index, so pruning
+// a segment drops its postings with a single DeleteBucket
+var archiveTermsBucket = []byte("archive_terms")
+
+func isTermRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokenize splits text into lowercase terms, in order
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !isTermRune(r) })
+}
+
+// messageTerms returns the distinct indexable terms of a message
+func messageTerms(message string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range tokenize(message) {
+		if len(term) <= maxTermLength && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// appendPostings adds the line numbers of new lines to the postings of a segment
+func appendPostings(tx *bolt.Tx, segmentKey []byte, postings map[string][]uint32) error {
+	if len(postings) == 0 {
+		return nil
+	}
+	root, err := tx.CreateBucketIfNotExists(archiveTermsBucket)
+	if err != nil {
+		return err
+	}
+	b, err := root.CreateBucketIfNotExists(segmentKey)
+	if err != nil {
+		return err
+	}
+	for term, lines := range postings {
+		value := append([]byte(nil), b.Get([]byte(term))...)
+		for _, line := range lines {
+			value = binary.AppendUvarint(value, uint64(line))
+		}
+		if err := b.Put([]byte(term), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodePostings(value []byte) []uint32 {
+	var lines []uint32
+	for len(value) > 0 {
+		line, n := binary.Uvarint(value)
+		if n <= 0 {
+			break
+		}
+		lines = append(lines, uint32(line))
+		value = value[n:]
+	}
+	return lines
+}
+
+// searchClause is a single term or a phrase of consecutive terms; all clauses must match
+type searchClause []string
+
+// parseSearchQuery splits q into terms and "quoted phrases"
+func parseSearchQuery(q string) ([]searchClause, error) {
+	if strings.Count(q, `"`)%2 != 0 {
+		return nil, errors.New("unbalanced quote in q")
+	}
+	var clauses []searchClause
+	for i, part := range strings.Split(q, `"`) {
+		terms := tokenize(part)
+		if i%2 == 1 && len(terms) > 1 {
+			clauses = append(clauses, terms)
+			continue
+		}
+		for _, term := range terms {
+			clauses = append(clauses, searchClause{term})
+		}
+	}
+	if len(clauses) == 0 {
+		return nil, errors.New("q needs at least one term or phrase")
+	}
+	return clauses, nil
+}
+
+// clausesMatch verifies the clauses against a message; postings cannot tell phrases apart
+func clausesMatch(clauses []searchClause, message string) bool {
+	tokens := tokenize(message)
+	for _, clause := range clauses {
+		found := false
+		for i := 0; i+len(clause) <= len(tokens) && !found; i++ {
+			found = slices.Equal(tokens[i:i+len(clause)], clause)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// clauseRegex matches a clause in a message the way tokenize reads it
+func clauseRegex(clause searchClause) string {
+	parts := make([]string, len(clause))
+	for i, term := range clause {
+		parts[i] = regexp.QuoteMeta(term)
+	}
+	pattern := strings.Join(parts, `[^\pL\pN_]+`)
+	// \b only knows ASCII word characters
+	if first, _ := utf8.DecodeRuneInString(clause[0]); first < utf8.RuneSelf {
+		pattern = `\b` + pattern
+	}
+	if last, _ := utf8.DecodeLastRuneInString(clause[len(clause)-1]); last < utf8.RuneSelf {
+		pattern += `\b`
+	}
+	return "(?i)" + pattern
+}
+
+// highlightRegex combines patterns the way stern highlights include and highlight matches:
+// one alternation, longest pattern first. Each pattern is grouped so its flags, such as the
+// (?i) of clauseRegex, stay within it.
+func highlightRegex(patterns []string) *regexp.Regexp {
+	if len(patterns) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(patterns)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for i, pattern := range sorted {
+		sorted[i] = "(?:" + pattern + ")"
+	}
+	return regexp.MustCompile("(" + strings.Join(sorted, "|") + ")")
+}
+
+// searchHit is a matching archived line with the byte ranges to highlight
+type searchHit struct {
+	archiveRecord
+	Highlights [][]int `json:"highlights"`
+}
+
+// segmentCandidates returns the lines of a segment holding every indexed term, or nil for
+// every line when the segment has no postings; ok is false when no line can match
+func segmentCandidates(tx *bolt.Tx, seg archiveSegment, clauses []searchClause) (candidates map[uint32]bool, ok bool) {
+	if !seg.Indexed {
+		return nil, true
+	}
+	root := tx.Bucket(archiveTermsBucket)
+	if root == nil {
+		return nil, false
+	}
+	b := root.Bucket(seg.key)
+	if b == nil {
+		return nil, false
+	}
+	for _, clause := range clauses {
+		for _, term := range clause {
+			if len(term) > maxTermLength {
+				continue
+			}
+			next := map[uint32]bool{}
+			for _, line := range decodePostings(b.Get([]byte(term))) {
+				if candidates == nil || candidates[line] {
+					next[line] = true
+				}
+			}
+			if len(next) == 0 {
+				return nil, false
+			}
+			candidates = next
+		}
+	}
+	return candidates, true
+}
+
+// search finds archived lines containing every clause that pass the filter, newest first.
+// It stops collecting at searchMaxHits; capped reports whether it did.
+func (a *logArchive) search(f *archiveFilter, clauses []searchClause) (hits []archiveRecord, searched int, capped bool, err error) {
+	if err := a.flush(); err != nil {
+		return nil, 0, false, err
+	}
+	segments, err := a.segments()
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	hits = []archiveRecord{}
+	for _, seg := range slices.Backward(segments) {
+		if !f.segmentMatches(seg) {
+			continue
+		}
+		var candidates map[uint32]bool
+		var ok bool
+		if err := a.db.View(func(tx *bolt.Tx) error {
+			candidates, ok = segmentCandidates(tx, seg, clauses)
+			return nil
+		}); err != nil {
+			return nil, 0, false, err
+		}
+		if !ok {
+			continue
+		}
+		searched++
+		err := a.readSegment(seg, candidates, func(rec archiveRecord) {
+			if f.matches(rec) && clausesMatch(clauses, rec.Message) {
+				hits = append(hits, rec)
+			}
+		})
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if len(hits) >= searchMaxHits {
+			capped = true
+			break
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Time.After(hits[j].Time) })
+	if len(hits) > searchMaxHits {
+		hits = hits[:searchMaxHits]
+	}
+	return hits, searched, capped, nil
+}
+
+// searchLogs runs a full-text query (?q=, terms and "quoted phrases") over the archive.
+// Filters and time range use the /ws/logs parameters; hits are paged with limit/offset and
+// carry highlight ranges for the query, include and highlight patterns.
+func searchLogs(c *gin.Context) {
+	clauses, err := parseSearchQuery(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params := parseStreamParams(c)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: params.contextName})
+
+	filter, err := newArchiveFilter(params, kubeConfig, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !preflightCollectedLogs(c, filter.context, filter.namespaces) {
+		return
+	}
+	highlightPatterns := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		highlightPatterns = append(highlightPatterns, clauseRegex(clause))
+	}
+	for _, raw := range []string{params.include, params.highlight} {
+		regexes, err := compileRegexList(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid highlight filter: %v", err)})
+			return
+		}
+		for _, re := range regexes {
+			highlightPatterns = append(highlightPatterns, re.String())
+		}
+	}
+	highlight := highlightRegex(highlightPatterns)
+
+	archive, err := openLogArchive()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	records, searched, capped, err := archive.search(filter, clauses)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, end, pagination := paginate(c, len(records))
+	hits := make([]searchHit, 0, end-start)
+	for _, rec := range records[start:end] {
+		hits = append(hits, searchHit{archiveRecord: rec, Highlights: highlight.FindAllStringIndex(rec.Message, -1)})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"context":          filter.context,
+		"from":             filter.from,
+		"to":               filter.to,
+		"hits":             hits,
+		"totalCapped":      capped,
+		"segmentsSearched": searched,
+		"pagination":       pagination,
+	})
+}
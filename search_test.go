@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestParseSearchQuery verifies terms, phrases and invalid queries
+func TestParseSearchQuery(t *testing.T) {
+	clauses, err := parseSearchQuery(`Timeout "connection refused" db-01 "single"`)
+	require.NoError(t, err)
+	assert.Equal(t, []searchClause{{"timeout"}, {"connection", "refused"}, {"db"}, {"01"}, {"single"}}, clauses)
+
+	_, err = parseSearchQuery(`"unbalanced`)
+	assert.ErrorContains(t, err, "unbalanced quote")
+	_, err = parseSearchQuery(` -- `)
+	assert.ErrorContains(t, err, "at least one term")
+}
+
+// TestArchiveSearch verifies postings narrow segments and lines, phrases are verified and filters apply
+func TestArchiveSearch(t *testing.T) {
+	a := testArchive(t)
+	now := time.Now()
+	records := []archiveRecord{
+		testRecord(now.Add(-50*time.Minute), "prod", "shop", "web-1", "app", "ERROR connection refused by db"),
+		testRecord(now.Add(-40*time.Minute), "prod", "shop", "web-1", "app", "refused: connection pool exhausted"),
+		testRecord(now.Add(-30*time.Minute), "prod", "shop", "web-2", "sidecar", "upstream connection refused"),
+	}
+	require.NoError(t, a.append("shop", "prod", records[0]))
+	require.NoError(t, a.flush())
+	// Postings written after a flush are appended to the ones already stored
+	require.NoError(t, a.append("shop", "prod", records[1]))
+	require.NoError(t, a.append("shop", "prod", records[2]))
+	require.NoError(t, a.append("other", "prod", testRecord(now, "prod", "shop", "web-3", "app", "nothing to see")))
+
+	phrase, err := parseSearchQuery(`"connection refused"`)
+	require.NoError(t, err)
+	hits, searched, capped, err := a.search(testArchiveFilter(t, map[string]string{"context": "prod", "namespace": "shop"}), phrase)
+	require.NoError(t, err)
+	assert.False(t, capped)
+	assert.Equal(t, 1, searched, "the segment without both terms is skipped")
+	require.Len(t, hits, 2)
+	assert.Equal(t, "upstream connection refused", hits[0].Message, "newest first")
+	assert.Equal(t, "ERROR connection refused by db", hits[1].Message)
+
+	terms, err := parseSearchQuery(`REFUSED connection`)
+	require.NoError(t, err)
+	hits, _, _, err = a.search(testArchiveFilter(t, map[string]string{"context": "prod", "namespace": "shop", "container": "app", "since": "45m"}), terms)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "refused: connection pool exhausted", hits[0].Message)
+
+	var postings []uint32
+	require.NoError(t, a.db.View(func(tx *bolt.Tx) error {
+		segments, err := a.segments()
+		require.NoError(t, err)
+		postings = decodePostings(tx.Bucket(archiveTermsBucket).Bucket(segments[0].key).Get([]byte("refused")))
+		return nil
+	}))
+	assert.Equal(t, []uint32{0, 1, 2}, postings)
+}
+
+// TestHighlightRegex verifies query clauses and highlight patterns combine like stern highlights,
+// without the case-insensitivity of a clause leaking into the other patterns
+func TestHighlightRegex(t *testing.T) {
+	re := highlightRegex([]string{clauseRegex(searchClause{"connection", "refused"}), clauseRegex(searchClause{"db"}), "ERR"})
+	message := "ERROR Connection  refused by db, dbx untouched, err kept case-sensitive"
+	assert.Equal(t, [][]int{{0, 3}, {6, 25}, {29, 31}}, re.FindAllStringIndex(message, -1))
+}
+
+// TestSearchLogsRequiresQuery verifies q is required
+func TestSearchLogsRequiresQuery(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/api/logs/search?context=minikube&namespace=shop", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "at least one term")
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const maskedValue = "********"
+
+// Annotation written by kubectl apply; it holds the full manifest, secret values included
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+var defaultSensitiveKeyPatterns = []string{
+	"*password*",
+	"*passwd*",
+	"*secret*",
+	"*token*",
+	"*apikey*",
+	"*api_key*",
+	"*api-key*",
+	"*credential*",
+	"*private*key*",
+}
+
+// loadSensitiveKeyPatterns reads STERN_UI_SENSITIVE_KEYS (comma-separated globs, case-insensitive)
+// used to mask ConfigMap keys
+func loadSensitiveKeyPatterns() []string {
+	if patterns := splitPatterns(os.Getenv("STERN_UI_SENSITIVE_KEYS")); len(patterns) > 0 {
+		return patterns
+	}
+	return defaultSensitiveKeyPatterns
+}
+
+var sensitiveKeyPatterns = loadSensitiveKeyPatterns()
+
+// Secret values can only be revealed when the server explicitly opts in
+var secretRevealEnabled = os.Getenv("STERN_UI_SECRET_REVEAL") == "true"
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range sensitiveKeyPatterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecret(res apiResource) bool {
+	return res.Group == "" && res.Name == "secrets"
+}
+
+func isConfigMap(res apiResource) bool {
+	return res.Group == "" && res.Name == "configmaps"
+}
+
+// maskFields replaces the values of a string map field, returning the masked keys
+func maskFields(obj *unstructured.Unstructured, field string, shouldMask func(string) bool) []string {
+	values, found, err := unstructured.NestedMap(obj.Object, field)
+	if err != nil || !found {
+		return nil
+	}
+	var masked []string
+	for key := range values {
+		if shouldMask(key) {
+			values[key] = maskedValue
+			masked = append(masked, key)
+		}
+	}
+	if len(masked) > 0 {
+		_ = unstructured.SetNestedMap(obj.Object, values, field)
+	}
+	return masked
+}
+
+// maskSensitiveData masks every Secret value and the ConfigMap values whose key looks sensitive.
+// It returns the sorted list of masked keys.
+func maskSensitiveData(obj *unstructured.Unstructured, res apiResource) []string {
+	var masked []string
+	switch {
+	case isSecret(res):
+		all := func(string) bool { return true }
+		masked = append(masked, maskFields(obj, "data", all)...)
+		masked = append(masked, maskFields(obj, "stringData", all)...)
+	case isConfigMap(res):
+		masked = append(masked, maskFields(obj, "data", isSensitiveKey)...)
+		masked = append(masked, maskFields(obj, "binaryData", isSensitiveKey)...)
+	default:
+		return nil
+	}
+
+	if annotations := obj.GetAnnotations(); annotations[lastAppliedAnnotation] != "" && (isSecret(res) || len(masked) > 0) {
+		annotations[lastAppliedAnnotation] = maskedValue
+		obj.SetAnnotations(annotations)
+	}
+
+	sort.Strings(masked)
+	return masked
+}
+
+// Kinds of the objects whose values can be revealed, by resource name
+var revealKinds = map[string]string{"secrets": "Secret", "configmaps": "ConfigMap"}
+
+// revealSecretValue returns a single Secret or ConfigMap value in clear text.
+// It is disabled unless STERN_UI_SECRET_REVEAL=true, the caller needs get on the object, and
+// every reveal is written to the audit log.
+func revealSecretValue(c *gin.Context) {
+	ctxName := c.Query("context")
+
+	var req struct {
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Key       string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	if !secretRevealEnabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "revealing secret values is disabled on this server (set STERN_UI_SECRET_REVEAL=true)"})
+		return
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if _, ok := revealKinds[kind]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be 'secrets' or 'configmaps'"})
+		return
+	}
+	if req.Name == "" || req.Key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and key are required"})
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = "default"
+	}
+	if err := checkPolicy(c, capSecrets, ctxName, req.Namespace); err != nil {
+		denyPolicy(c, err)
+		return
+	}
+
+	clientset, _, err := createKubeClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The server-wide switch is not enough: the caller must be allowed to read the object
+	if err := checkAccess(c.Request.Context(), clientset, authorizationv1.ResourceAttributes{
+		Verb: "get", Resource: kind, Name: req.Name, Namespace: req.Namespace,
+	}); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var value string
+	var found bool
+	if kind == "secrets" {
+		secret, err := clientset.CoreV1().Secrets(req.Namespace).Get(c.Request.Context(), req.Name, metav1.GetOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var data []byte
+		if data, found = secret.Data[req.Key]; found {
+			value = string(data)
+		} else {
+			value, found = secret.StringData[req.Key]
+		}
+	} else {
+		cm, err := clientset.CoreV1().ConfigMaps(req.Namespace).Get(c.Request.Context(), req.Name, metav1.GetOptions{})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var data []byte
+		if value, found = cm.Data[req.Key]; !found {
+			if data, found = cm.BinaryData[req.Key]; found {
+				value = string(data)
+			}
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("key %q not found in %s %s/%s", req.Key, kind, req.Namespace, req.Name)})
+		return
+	}
+
+	recordAudit(c, auditEvent{
+		Verb:      "reveal",
+		Context:   currentContextName(ctxName),
+		Namespace: req.Namespace,
+		Objects:   []auditObject{{APIVersion: "v1", Kind: revealKinds[kind], Namespace: req.Namespace, Name: req.Name}},
+		Details:   map[string]string{"key": req.Key},
+	})
+	c.JSON(http.StatusOK, gin.H{"key": req.Key, "value": value})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// TestMaskSensitiveDataSecret verifies every Secret value and last-applied annotation is masked
+func TestMaskSensitiveDataSecret(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":        "db",
+			"annotations": map[string]interface{}{lastAppliedAnnotation: `{"data":{"password":"aHVudGVyMg=="}}`},
+		},
+		"data":       map[string]interface{}{"password": "aHVudGVyMg==", "user": "YWRtaW4="},
+		"stringData": map[string]interface{}{"token": "plain"},
+	}}
+
+	masked := maskSensitiveData(obj, apiResource{Name: "secrets"})
+
+	assert.Equal(t, []string{"password", "token", "user"}, masked)
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	assert.Equal(t, maskedValue, data["password"])
+	assert.Equal(t, maskedValue, data["user"])
+	assert.Equal(t, maskedValue, obj.GetAnnotations()[lastAppliedAnnotation])
+}
+
+// TestMaskSensitiveDataConfigMap verifies only ConfigMap keys matching sensitive patterns are masked
+func TestMaskSensitiveDataConfigMap(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "ConfigMap",
+		"data": map[string]interface{}{"DB_PASSWORD": "hunter2", "LOG_LEVEL": "debug", "github-token": "ghp_x"},
+	}}
+
+	masked := maskSensitiveData(obj, apiResource{Name: "configmaps"})
+
+	assert.Equal(t, []string{"DB_PASSWORD", "github-token"}, masked)
+	data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+	assert.Equal(t, "debug", data["LOG_LEVEL"])
+	assert.Equal(t, maskedValue, data["DB_PASSWORD"])
+
+	other := &unstructured.Unstructured{Object: map[string]interface{}{"data": map[string]interface{}{"password": "x"}}}
+	assert.Empty(t, maskSensitiveData(other, apiResource{Name: "configmaps", Group: "example.com"}))
+}
+
+// TestRevealSecretDisabledByDefault verifies reveal requires the server opt-in
+func TestRevealSecretDisabledByDefault(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/clusters/secret-reveal?context=minikube", strings.NewReader(`{"kind":"secrets","namespace":"default","name":"db","key":"password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestRevealSecretValue verifies the caller's own get access is checked and the reveal is audited with the object's kind
+func TestRevealSecretValue(t *testing.T) {
+	enabled := secretRevealEnabled
+	secretRevealEnabled = true
+	t.Cleanup(func() { secretRevealEnabled = enabled })
+
+	allowed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(body, nil, nil)
+			require.NoError(t, err)
+			review := obj.(*authorizationv1.SelfSubjectAccessReview)
+			review.Status.Allowed = allowed
+			_ = json.NewEncoder(w).Encode(review)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"},
+			Data:       map[string][]byte{"password": []byte("hunter2")},
+		})
+	}))
+	defer server.Close()
+	useTestCluster(t, server.URL)
+	r := setupRouter()
+	reveal := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/clusters/secret-reveal?context=dev", strings.NewReader(`{"kind":"secrets","namespace":"shop","name":"db","key":"password"}`))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := reveal()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `cannot get secrets db in namespace \"shop\"`)
+
+	allowed = true
+	w = reveal()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "hunter2")
+
+	events, err := auditLog.events(&auditFilter{verb: "reveal"})
+	require.NoError(t, err)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "Secret", events[0].Objects[0].Kind)
+}
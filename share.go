@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Share links stop resolving after this long
+var shareTTL = envDuration("STERN_UI_SHARE_TTL", 30*24*time.Hour)
+
+var sharesBucket = []byte("shares")
+
+// Format of the sinceTime and untilTime stream parameters (minute precision, UTC)
+const streamTimeFormat = "2006-01-02T15:04"
+
+// Parameters that only mean something relative to when a stream was opened
+var relativeTimeParams = []string{"since", "timeRangeMode", "sinceTime", "untilTime", "noFollow"}
+
+// sharedView is a log view frozen at the moment it was shared
+type sharedView struct {
+	ID        string            `json:"id"`
+	Params    map[string]string `json:"params"`
+	CreatedBy string            `json:"createdBy"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// freezeTimeWindow replaces a relative window (since, or the 48h default) with the absolute
+// sinceTime/untilTime it covers at now. The window is widened to whole minutes, the precision
+// of sinceTime and untilTime. Absolute windows without an end are closed at now.
+func freezeTimeWindow(values map[string]string, now time.Time) error {
+	since, until := now.Add(-48*time.Hour), now
+	if values["timeRangeMode"] == "absolute" && values["sinceTime"] != "" {
+		t, err := time.Parse(streamTimeFormat, values["sinceTime"])
+		if err != nil {
+			return fmt.Errorf("invalid sinceTime: %w", err)
+		}
+		since = t
+		if values["untilTime"] != "" {
+			if until, err = time.Parse(streamTimeFormat, values["untilTime"]); err != nil {
+				return fmt.Errorf("invalid untilTime: %w", err)
+			}
+		}
+	} else if values["since"] != "" {
+		d, err := time.ParseDuration(values["since"])
+		if err != nil {
+			return fmt.Errorf("invalid since: %w", err)
+		}
+		since = now.Add(-d)
+	}
+	if !until.After(since) {
+		return errors.New("untilTime must be after sinceTime")
+	}
+
+	for _, key := range relativeTimeParams {
+		delete(values, key)
+	}
+	values["timeRangeMode"] = "absolute"
+	values["sinceTime"] = since.UTC().Truncate(time.Minute).Format(streamTimeFormat)
+	if rounded := until.UTC().Truncate(time.Minute); rounded.Before(until) {
+		until = rounded.Add(time.Minute)
+	}
+	values["untilTime"] = until.UTC().Format(streamTimeFormat)
+	return nil
+}
+
+// newSharedView validates the parameters, expands a preset so later edits to it do not change
+// the view, and freezes the time window
+func newSharedView(db *bolt.DB, values map[string]string, owner string, now time.Time) (*sharedView, error) {
+	params := map[string]string{}
+	if name := values["preset"]; name != "" {
+		base, err := presetParams(db, name, owner)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range base {
+			params[key] = value
+		}
+	}
+	for key, value := range values {
+		if key != "preset" && value != "" {
+			params[key] = value
+		}
+	}
+	if err := validateStreamParams(params); err != nil {
+		return nil, err
+	}
+	if err := freezeTimeWindow(params, now); err != nil {
+		return nil, err
+	}
+	return &sharedView{ID: randomID(6), Params: params, CreatedBy: owner, CreatedAt: now, ExpiresAt: now.Add(shareTTL)}, nil
+}
+
+func putSharedView(db *bolt.DB, view *sharedView) error {
+	data, err := json.Marshal(view)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(sharesBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(view.ID), data)
+	})
+}
+
+func loadSharedView(db *bolt.DB, id string) (*sharedView, error) {
+	var view *sharedView
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sharesBucket)
+		if b == nil {
+			return nil
+		}
+		if data := b.Get([]byte(id)); data != nil {
+			view = &sharedView{}
+			return json.Unmarshal(data, view)
+		}
+		return nil
+	})
+	return view, err
+}
+
+// shareResponse adds the /ws/logs query string that reopens the view
+func shareResponse(view *sharedView) gin.H {
+	query := url.Values{}
+	for key, value := range view.Params {
+		query.Set(key, value)
+	}
+	return gin.H{
+		"id":        view.ID,
+		"params":    view.Params,
+		"query":     query.Encode(),
+		"createdAt": view.CreatedAt,
+		"expiresAt": view.ExpiresAt,
+	}
+}
+
+// createShare turns the posted /ws/logs parameters into a short ID with a frozen time window
+func createShare(c *gin.Context) {
+	var body struct {
+		Params map[string]string `json:"params"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON body: " + err.Error()})
+		return
+	}
+	if len(body.Params) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "params are required"})
+		return
+	}
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	view, err := newSharedView(db, body.Params, requestOwner(c), time.Now())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errPresetNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if err := putSharedView(db, view); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(c, auditEvent{Verb: "share", Context: view.Params["context"], Namespace: view.Params["namespace"], Details: map[string]string{"id": view.ID}})
+	c.JSON(http.StatusCreated, shareResponse(view))
+}
+
+// resolveShare returns the frozen parameters of a shared view
+func resolveShare(c *gin.Context) {
+	db, err := openStore()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	view, err := loadSharedView(db, c.Param("id"))
+	switch {
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case view == nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+	case time.Now().After(view.ExpiresAt):
+		c.JSON(http.StatusGone, gin.H{"error": "share link expired"})
+	default:
+		c.JSON(http.StatusOK, shareResponse(view))
+	}
+}
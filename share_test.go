@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFreezeTimeWindow verifies relative windows become absolute ones covering the same span
+func TestFreezeTimeWindow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 30, 45, 0, time.UTC)
+
+	values := map[string]string{"since": "15m", "noFollow": "false"}
+	require.NoError(t, freezeTimeWindow(values, now))
+	assert.Equal(t, map[string]string{"timeRangeMode": "absolute", "sinceTime": "2026-03-01T12:15", "untilTime": "2026-03-01T12:31"}, values)
+
+	values = map[string]string{}
+	require.NoError(t, freezeTimeWindow(values, now))
+	assert.Equal(t, "2026-02-27T12:30", values["sinceTime"], "48h default")
+
+	values = map[string]string{"timeRangeMode": "absolute", "sinceTime": "2026-03-01T08:00", "untilTime": "2026-03-01T09:00"}
+	require.NoError(t, freezeTimeWindow(values, now))
+	assert.Equal(t, "2026-03-01T09:00", values["untilTime"])
+
+	values = map[string]string{"timeRangeMode": "absolute", "sinceTime": "2026-03-01T08:00"}
+	require.NoError(t, freezeTimeWindow(values, now))
+	assert.Equal(t, "2026-03-01T12:31", values["untilTime"], "open absolute window closes at now")
+
+	assert.ErrorContains(t, freezeTimeWindow(map[string]string{"since": "soon"}, now), "invalid since")
+	assert.ErrorContains(t, freezeTimeWindow(map[string]string{"timeRangeMode": "absolute", "sinceTime": "2026-03-01T10:00", "untilTime": "2026-03-01T09:00"}, now), "after sinceTime")
+}
+
+// TestNewSharedView verifies presets are expanded into the share and the result is stored
+func TestNewSharedView(t *testing.T) {
+	db := testStore(t)
+	require.NoError(t, savePreset(db, &preset{Name: "errors", Owner: "alice", Visibility: presetTeam, Params: map[string]string{"namespace": "shop", "include": "ERROR"}}, true))
+	now := time.Now()
+
+	view, err := newSharedView(db, map[string]string{"preset": "errors", "context": "prod", "since": "1h"}, "bob", now)
+	require.NoError(t, err)
+	assert.Len(t, view.ID, 12)
+	assert.Equal(t, "shop", view.Params["namespace"])
+	assert.Equal(t, "prod", view.Params["context"])
+	assert.Equal(t, "absolute", view.Params["timeRangeMode"])
+	assert.NotContains(t, view.Params, "preset")
+	assert.NotContains(t, view.Params, "since")
+
+	require.NoError(t, putSharedView(db, view))
+	loaded, err := loadSharedView(db, view.ID)
+	require.NoError(t, err)
+	assert.Equal(t, view.Params, loaded.Params)
+	missing, err := loadSharedView(db, "nope")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	_, err = newSharedView(db, map[string]string{"preset": "missing"}, "bob", now)
+	assert.ErrorIs(t, err, errPresetNotFound)
+	_, err = newSharedView(db, map[string]string{"include": "("}, "bob", now)
+	assert.ErrorContains(t, err, "invalid include")
+}
+
+// TestCreateShareRejectsMissingParams verifies an empty share is refused
+func TestCreateShareRejectsMissingParams(t *testing.T) {
+	r := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/api/share", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "params are required")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Directory holding stern-ui's local database; defaults to ~/.local/share/stern-ui
+var dataDir = func() string {
+	if dir := os.Getenv("STERN_UI_DATA_DIR"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "stern-ui")
+	}
+	return "stern-ui-data"
+}()
+
+var (
+	storeOnce sync.Once
+	storeDB   *bolt.DB
+	storeErr  error
+)
+
+// openStore opens the embedded bbolt database on first use. Features that persist
+// data share this one file, each under its own top-level bucket.
+func openStore() (*bolt.DB, error) {
+	storeOnce.Do(func() {
+		if err := os.MkdirAll(dataDir, 0o700); err != nil {
+			storeErr = fmt.Errorf("cannot create data directory: %w", err)
+			return
+		}
+		path := filepath.Join(dataDir, "stern-ui.db")
+		storeDB, storeErr = bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+		if storeErr != nil {
+			storeErr = fmt.Errorf("cannot open %s: %w", path, storeErr)
+		}
+	})
+	return storeDB, storeErr
+}
+
+// timeKey encodes a timestamp so bbolt's byte ordering is chronological
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
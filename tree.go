@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// treeNode is one object in the ownership graph returned by /api/clusters/tree
+type treeNode struct {
+	Kind      string      `json:"kind"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Status    string      `json:"status"`
+	Healthy   bool        `json:"healthy"`
+	Ready     string      `json:"ready,omitempty"`
+	Restarts  int32       `json:"restarts,omitempty"`
+	Created   string      `json:"created,omitempty"`
+	Children  []*treeNode `json:"children,omitempty"`
+
+	uid   types.UID
+	owner types.UID
+}
+
+func newTreeNode(kind string, meta metav1.ObjectMeta) *treeNode {
+	n := &treeNode{
+		Kind:      kind,
+		Name:      meta.Name,
+		Namespace: meta.Namespace,
+		Created:   meta.CreationTimestamp.UTC().Format(time.RFC3339),
+		uid:       meta.UID,
+	}
+	if ref := metav1.GetControllerOfNoCopy(&meta); ref != nil {
+		n.owner = ref.UID
+	} else if len(meta.OwnerReferences) > 0 {
+		n.owner = meta.OwnerReferences[0].UID
+	}
+	return n
+}
+
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+	return *r
+}
+
+func deploymentNode(d appsv1.Deployment) *treeNode {
+	n := newTreeNode("Deployment", d.ObjectMeta)
+	desired := replicas(d.Spec.Replicas)
+	n.Ready = fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, desired)
+
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			n.Status = cond.Reason
+			return n
+		}
+	}
+	switch {
+	case d.Status.UpdatedReplicas < desired || d.Status.Replicas > d.Status.UpdatedReplicas:
+		n.Status = "Progressing"
+		n.Healthy = d.Status.AvailableReplicas > 0 || desired == 0
+	case d.Status.AvailableReplicas < desired:
+		n.Status = "Degraded"
+	default:
+		n.Status = "Available"
+		n.Healthy = true
+	}
+	return n
+}
+
+func replicaSetNode(rs appsv1.ReplicaSet) *treeNode {
+	n := newTreeNode("ReplicaSet", rs.ObjectMeta)
+	desired := replicas(rs.Spec.Replicas)
+	n.Ready = fmt.Sprintf("%d/%d", rs.Status.ReadyReplicas, desired)
+	n.Healthy = rs.Status.ReadyReplicas >= desired
+	switch {
+	case desired == 0:
+		n.Status = "ScaledDown"
+	case n.Healthy:
+		n.Status = "Ready"
+	default:
+		n.Status = "NotReady"
+	}
+	return n
+}
+
+func statefulSetNode(s appsv1.StatefulSet) *treeNode {
+	n := newTreeNode("StatefulSet", s.ObjectMeta)
+	desired := replicas(s.Spec.Replicas)
+	n.Ready = fmt.Sprintf("%d/%d", s.Status.ReadyReplicas, desired)
+	n.Healthy = s.Status.ReadyReplicas >= desired
+	switch {
+	case s.Status.UpdateRevision != "" && s.Status.CurrentRevision != s.Status.UpdateRevision:
+		n.Status = "Progressing"
+	case n.Healthy:
+		n.Status = "Ready"
+	default:
+		n.Status = "NotReady"
+	}
+	return n
+}
+
+func daemonSetNode(ds appsv1.DaemonSet) *treeNode {
+	n := newTreeNode("DaemonSet", ds.ObjectMeta)
+	n.Ready = fmt.Sprintf("%d/%d", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+	n.Healthy = ds.Status.NumberReady >= ds.Status.DesiredNumberScheduled
+	switch {
+	case ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled:
+		n.Status = "Progressing"
+	case n.Healthy:
+		n.Status = "Ready"
+	default:
+		n.Status = "NotReady"
+	}
+	return n
+}
+
+func jobNode(j batchv1.Job) *treeNode {
+	n := newTreeNode("Job", j.ObjectMeta)
+	n.Ready = fmt.Sprintf("%d/%d", j.Status.Succeeded, replicas(j.Spec.Completions))
+	for _, cond := range j.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			n.Status = "Complete"
+			n.Healthy = true
+			return n
+		case batchv1.JobFailed:
+			n.Status = "Failed"
+			return n
+		}
+	}
+	if j.Spec.Suspend != nil && *j.Spec.Suspend {
+		n.Status = "Suspended"
+		n.Healthy = true
+		return n
+	}
+	n.Status = "Running"
+	n.Healthy = true
+	return n
+}
+
+func cronJobNode(cj batchv1.CronJob) *treeNode {
+	n := newTreeNode("CronJob", cj.ObjectMeta)
+	n.Healthy = true
+	switch {
+	case cj.Spec.Suspend != nil && *cj.Spec.Suspend:
+		n.Status = "Suspended"
+	case len(cj.Status.Active) > 0:
+		n.Status = fmt.Sprintf("Active (%d)", len(cj.Status.Active))
+	case cj.Status.LastScheduleTime != nil:
+		n.Status = "Last scheduled " + cj.Status.LastScheduleTime.UTC().Format(time.RFC3339)
+	default:
+		n.Status = "Scheduled"
+	}
+	return n
+}
+
+func podNode(p corev1.Pod) *treeNode {
+	n := newTreeNode("Pod", p.ObjectMeta)
+	ready := 0
+	for _, cs := range p.Status.ContainerStatuses {
+		n.Restarts += cs.RestartCount
+		if cs.Ready {
+			ready++
+		}
+	}
+	n.Ready = fmt.Sprintf("%d/%d", ready, len(p.Spec.Containers))
+	if reason := podIssueReason(p); reason != "" {
+		n.Status = reason
+	} else {
+		n.Status = string(p.Status.Phase)
+		n.Healthy = true
+	}
+
+	statuses := make(map[string]corev1.ContainerStatus, len(p.Status.ContainerStatuses))
+	for _, cs := range p.Status.ContainerStatuses {
+		statuses[cs.Name] = cs
+	}
+	for _, c := range p.Spec.Containers {
+		child := &treeNode{Kind: "Container", Name: c.Name, Namespace: p.Namespace, Status: "Waiting"}
+		if cs, ok := statuses[c.Name]; ok {
+			child.Restarts = cs.RestartCount
+			child.Healthy = cs.Ready
+			switch {
+			case cs.State.Running != nil:
+				child.Status = "Running"
+			case cs.State.Waiting != nil && cs.State.Waiting.Reason != "":
+				child.Status = cs.State.Waiting.Reason
+			case cs.State.Terminated != nil:
+				child.Status = cs.State.Terminated.Reason
+				child.Healthy = cs.State.Terminated.ExitCode == 0
+			}
+		}
+		n.Children = append(n.Children, child)
+	}
+	return n
+}
+
+// buildOwnerTree lists workloads and pods in a namespace and links them by owner reference.
+// Objects whose owner is not part of the listing (or that have none) become roots.
+func buildOwnerTree(ctx context.Context, clientset kubernetes.Interface, namespace string) ([]*treeNode, error) {
+	opts := metav1.ListOptions{}
+	var nodes []*treeNode
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		nodes = append(nodes, deploymentNode(d))
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+	for _, rs := range replicaSets.Items {
+		// Old revisions scaled to zero only clutter the tree
+		if replicas(rs.Spec.Replicas) == 0 && rs.Status.Replicas == 0 && len(rs.OwnerReferences) > 0 {
+			continue
+		}
+		nodes = append(nodes, replicaSetNode(rs))
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		nodes = append(nodes, statefulSetNode(s))
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets: %w", err)
+	}
+	for _, ds := range daemonSets.Items {
+		nodes = append(nodes, daemonSetNode(ds))
+	}
+
+	cronJobs, err := clientset.BatchV1().CronJobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %w", err)
+	}
+	for _, cj := range cronJobs.Items {
+		nodes = append(nodes, cronJobNode(cj))
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	for _, j := range jobs.Items {
+		nodes = append(nodes, jobNode(j))
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, p := range pods.Items {
+		nodes = append(nodes, podNode(p))
+	}
+
+	byUID := make(map[types.UID]*treeNode, len(nodes))
+	for _, n := range nodes {
+		byUID[n.uid] = n
+	}
+
+	roots := make([]*treeNode, 0)
+	for _, n := range nodes {
+		if parent, ok := byUID[n.owner]; ok && n.owner != "" {
+			parent.Children = append(parent.Children, n)
+			continue
+		}
+		roots = append(roots, n)
+	}
+
+	sortTree(roots)
+	return roots, nil
+}
+
+// Workload kinds first, then pods; alphabetical within a kind
+var treeKindOrder = map[string]int{
+	"Deployment":  0,
+	"StatefulSet": 1,
+	"DaemonSet":   2,
+	"CronJob":     3,
+	"Job":         4,
+	"ReplicaSet":  5,
+	"Pod":         6,
+	"Container":   7,
+}
+
+func sortTree(nodes []*treeNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Kind != nodes[j].Kind {
+			return treeKindOrder[nodes[i].Kind] < treeKindOrder[nodes[j].Kind]
+		}
+		if nodes[i].Kind == "Container" {
+			return false // keep spec order
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, n := range nodes {
+		sortTree(n.Children)
+	}
+}
+
+// getClusterTree returns the owner-reference graph of workloads, pods and containers in a namespace
+func getClusterTree(c *gin.Context) {
+	ctxName := c.Query("context")
+	namespace := c.Query("namespace")
+
+	clientset, kubeConfig, err := createKubeClient(ctxName, currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if namespace == "" {
+		namespace, _, _ = kubeConfig.Namespace()
+		if namespace == "" {
+			namespace = "default"
+		}
+	}
+
+	roots, err := buildOwnerTree(c.Request.Context(), clientset, namespace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"namespace": namespace, "items": roots})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// TestBuildOwnerTree verifies Deployment -> ReplicaSet -> Pod -> container linking
+func TestBuildOwnerTree(t *testing.T) {
+	controller := true
+	clientset := fake.NewClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", UID: "d1"},
+			Spec:       appsv1.DeploymentSpec{Replicas: int32Ptr(2)},
+			Status:     appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 1, AvailableReplicas: 1},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "web-abc", Namespace: "prod", UID: "rs1",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", UID: "d1", Controller: &controller}},
+			},
+			Spec:   appsv1.ReplicaSetSpec{Replicas: int32Ptr(2)},
+			Status: appsv1.ReplicaSetStatus{Replicas: 2, ReadyReplicas: 1},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "web-old", Namespace: "prod", UID: "rs0",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", UID: "d1", Controller: &controller}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Replicas: int32Ptr(0)},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "web-abc-1", Namespace: "prod", UID: "p1",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-abc", UID: "rs1", Controller: &controller}},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "app", Ready: false, RestartCount: 4, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+					{Name: "sidecar", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "prod", UID: "p2"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "shell"}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "elsewhere", Namespace: "staging", UID: "p3"},
+		},
+	)
+
+	roots, err := buildOwnerTree(context.Background(), clientset, "prod")
+	require.NoError(t, err)
+	require.Len(t, roots, 2)
+
+	deploy := roots[0]
+	assert.Equal(t, "Deployment", deploy.Kind)
+	assert.Equal(t, "Degraded", deploy.Status)
+	assert.Equal(t, "1/2", deploy.Ready)
+	require.Len(t, deploy.Children, 1, "scaled-down ReplicaSets are hidden")
+
+	rs := deploy.Children[0]
+	assert.Equal(t, "web-abc", rs.Name)
+	require.Len(t, rs.Children, 1)
+
+	pod := rs.Children[0]
+	assert.Equal(t, "CrashLoopBackOff", pod.Status)
+	assert.False(t, pod.Healthy)
+	assert.Equal(t, int32(4), pod.Restarts)
+	require.Len(t, pod.Children, 2)
+	assert.Equal(t, "app", pod.Children[0].Name)
+	assert.Equal(t, "CrashLoopBackOff", pod.Children[0].Status)
+	assert.Equal(t, "Running", pod.Children[1].Status)
+
+	assert.Equal(t, "Pod", roots[1].Kind)
+	assert.Equal(t, "debug", roots[1].Name)
+}
+
+// TestDeploymentNodeStuckRollout verifies a stalled rollout is reported as unhealthy
+func TestDeploymentNodeStuckRollout(t *testing.T) {
+	n := deploymentNode(appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{Replicas: int32Ptr(3)},
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}},
+		},
+	})
+	assert.Equal(t, "ProgressDeadlineExceeded", n.Status)
+	assert.False(t, n.Healthy)
+}
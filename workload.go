@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Workload kinds accepted by the workload parameter, keyed by every alias kubectl understands
+var workloadKindAliases = map[string]string{
+	"deployment":   "deployment",
+	"deployments":  "deployment",
+	"deploy":       "deployment",
+	"statefulset":  "statefulset",
+	"statefulsets": "statefulset",
+	"sts":          "statefulset",
+	"daemonset":    "daemonset",
+	"daemonsets":   "daemonset",
+	"ds":           "daemonset",
+	"replicaset":   "replicaset",
+	"replicasets":  "replicaset",
+	"rs":           "replicaset",
+	"job":          "job",
+	"jobs":         "job",
+	"cronjob":      "cronjob",
+	"cronjobs":     "cronjob",
+	"cj":           "cronjob",
+	"service":      "service",
+	"services":     "service",
+	"svc":          "service",
+}
+
+// parseWorkloadRef splits a "kind/name" reference and normalizes the kind
+func parseWorkloadRef(workload string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(workload), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid workload %q: expected kind/name", workload)
+	}
+	kind, ok := workloadKindAliases[strings.ToLower(parts[0])]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported workload kind %q", parts[0])
+	}
+	return kind, parts[1], nil
+}
+
+// resolveWorkloadSelector returns the label selector matching every pod of a workload,
+// like kubectl logs deploy/foo but across all replicas. The warning is set when the selector
+// cannot follow pods the workload creates later.
+func resolveWorkloadSelector(ctx context.Context, clientset kubernetes.Interface, namespace, workload string) (labels.Selector, string, error) {
+	kind, name, err := parseWorkloadRef(workload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var labelSelector *metav1.LabelSelector
+	switch kind {
+	case "deployment":
+		d, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get deployment %s/%s: %w", namespace, name, err)
+		}
+		labelSelector = d.Spec.Selector
+	case "statefulset":
+		s, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get statefulset %s/%s: %w", namespace, name, err)
+		}
+		labelSelector = s.Spec.Selector
+	case "daemonset":
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get daemonset %s/%s: %w", namespace, name, err)
+		}
+		labelSelector = ds.Spec.Selector
+	case "replicaset":
+		rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get replicaset %s/%s: %w", namespace, name, err)
+		}
+		labelSelector = rs.Spec.Selector
+	case "job":
+		j, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get job %s/%s: %w", namespace, name, err)
+		}
+		labelSelector = j.Spec.Selector
+	case "cronjob":
+		return resolveCronJobSelector(ctx, clientset, namespace, name)
+	case "service":
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get service %s/%s: %w", namespace, name, err)
+		}
+		if len(svc.Spec.Selector) == 0 {
+			return nil, "", fmt.Errorf("service %s/%s has no pod selector", namespace, name)
+		}
+		return labels.SelectorFromSet(svc.Spec.Selector), "", nil
+	}
+
+	if labelSelector == nil {
+		return nil, "", fmt.Errorf("%s %s/%s has no pod selector", kind, namespace, name)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid selector on %s %s/%s: %w", kind, namespace, name, err)
+	}
+	return selector, "", nil
+}
+
+// resolveCronJobSelector matches the pods of a CronJob's Jobs. When the job template labels its
+// pods, those labels plus job-name (which only Job pods carry) also match runs started later.
+// Otherwise the Jobs owned right now are looked up by owner reference and the warning says later
+// runs are missed.
+func resolveCronJobSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (labels.Selector, string, error) {
+	cj, err := clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get cronjob %s/%s: %w", namespace, name, err)
+	}
+
+	if podLabels := cj.Spec.JobTemplate.Spec.Template.Labels; len(podLabels) > 0 {
+		jobPods, err := labels.NewRequirement("job-name", selection.Exists, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		return labels.SelectorFromSet(podLabels).Add(*jobPods), "", nil
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list jobs in %s: %w", namespace, err)
+	}
+
+	var jobNames []string
+	for _, j := range jobs.Items {
+		for _, ref := range j.OwnerReferences {
+			if ref.Kind == "CronJob" && ref.UID == cj.UID {
+				jobNames = append(jobNames, j.Name)
+				break
+			}
+		}
+	}
+	if len(jobNames) == 0 {
+		return nil, "", fmt.Errorf("cronjob %s/%s has no jobs and its job template sets no pod labels", namespace, name)
+	}
+	sort.Strings(jobNames)
+
+	req, err := labels.NewRequirement("job-name", selection.In, jobNames)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid job names for cronjob %s/%s: %w", namespace, name, err)
+	}
+	warning := fmt.Sprintf("cronjob %s/%s sets no pod labels in its job template; following only jobs %s, later runs are not streamed", namespace, name, strings.Join(jobNames, ", "))
+	return labels.NewSelector().Add(*req), warning, nil
+}
+
+// mergeSelectors ANDs the requirements of extra into base
+func mergeSelectors(base, extra labels.Selector) labels.Selector {
+	reqs, _ := extra.Requirements()
+	return base.Add(reqs...)
+}
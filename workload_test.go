@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestParseWorkloadRef verifies kind aliases and malformed references
+func TestParseWorkloadRef(t *testing.T) {
+	kind, name, err := parseWorkloadRef("deploy/web")
+	require.NoError(t, err)
+	assert.Equal(t, "deployment", kind)
+	assert.Equal(t, "web", name)
+
+	kind, _, err = parseWorkloadRef("SVC/api")
+	require.NoError(t, err)
+	assert.Equal(t, "service", kind)
+
+	for _, bad := range []string{"web", "deployment/", "configmap/web"} {
+		_, _, err := parseWorkloadRef(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+// TestResolveWorkloadSelector verifies selectors are resolved for each supported kind
+func TestResolveWorkloadSelector(t *testing.T) {
+	clientset := fake.NewClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+			Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "api", "tier": "backend"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "external", Namespace: "prod"},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "prod", UID: "cron-uid"},
+		},
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "report", Namespace: "prod", UID: "report-uid"},
+			Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "report"}}},
+			}}},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "nightly-1",
+				Namespace:       "prod",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: "nightly", UID: "cron-uid"}},
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: "prod"},
+		},
+	)
+	ctx := context.Background()
+
+	sel, warning, err := resolveWorkloadSelector(ctx, clientset, "prod", "deployment/web")
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+	assert.True(t, sel.Matches(labels.Set{"app": "web", "pod-template-hash": "abc"}))
+	assert.False(t, sel.Matches(labels.Set{"app": "api"}))
+
+	sel, _, err = resolveWorkloadSelector(ctx, clientset, "prod", "svc/api")
+	require.NoError(t, err)
+	assert.True(t, sel.Matches(labels.Set{"app": "api", "tier": "backend"}))
+	assert.False(t, sel.Matches(labels.Set{"app": "api"}))
+
+	_, _, err = resolveWorkloadSelector(ctx, clientset, "prod", "service/external")
+	assert.ErrorContains(t, err, "no pod selector")
+
+	// Template labels follow runs that do not exist yet
+	sel, warning, err = resolveWorkloadSelector(ctx, clientset, "prod", "cronjob/report")
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+	assert.True(t, sel.Matches(labels.Set{"app": "report", "job-name": "report-29000000"}))
+	assert.False(t, sel.Matches(labels.Set{"app": "report"}), "only Job pods")
+
+	// Without template labels only the current jobs are matched, with a warning
+	sel, warning, err = resolveWorkloadSelector(ctx, clientset, "prod", "cronjob/nightly")
+	require.NoError(t, err)
+	assert.Contains(t, warning, "later runs are not streamed")
+	assert.True(t, sel.Matches(labels.Set{"job-name": "nightly-1"}))
+	assert.False(t, sel.Matches(labels.Set{"job-name": "manual"}))
+
+	_, _, err = resolveWorkloadSelector(ctx, clientset, "prod", "deployment/missing")
+	assert.Error(t, err)
+}
+
+// TestMergeSelectors verifies workload selectors are ANDed with user selectors
+func TestMergeSelectors(t *testing.T) {
+	user, err := labels.Parse("env=prod")
+	require.NoError(t, err)
+	merged := mergeSelectors(user, labels.SelectorFromSet(labels.Set{"app": "web"}))
+
+	assert.True(t, merged.Matches(labels.Set{"env": "prod", "app": "web"}))
+	assert.False(t, merged.Matches(labels.Set{"env": "prod"}))
+	assert.True(t, mergeSelectors(labels.Everything(), labels.SelectorFromSet(labels.Set{"app": "web"})).Matches(labels.Set{"app": "web"}))
+}